@@ -0,0 +1,261 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// affectedCluster is a cluster impacted by a change range
+type affectedCluster struct {
+	Name string `json:"name"`
+	Site string `json:"site"`
+	// Full is set when the site.yaml or shared stack content changed and the whole cluster must be rendered
+	Full bool `json:"full"`
+	// Apps lists the enabled apps with changed stack content (all enabled apps when Full is set)
+	Apps []string `json:"apps"`
+}
+
+// affectedChanges is the set of changes relevant for rendering in a change range
+type affectedChanges struct {
+	// sites holds the changed clusters/<name>/site.yaml paths
+	sites map[string]bool
+	// apps holds the apps with changed content below stack/apps/<app>/
+	apps map[string]bool
+	// shared is set when stack content used by every cluster changed (stack/templates, stack/infra)
+	shared bool
+}
+
+func newAffectedCmd() *cobra.Command {
+
+	var sinceRef, untilRef, stackFrom string
+	var render bool
+
+	cmd := &cobra.Command{
+		Use:   "affected",
+		Short: "List the clusters and apps affected by a git change range",
+		Long: `Determine which clusters and apps are affected by the changes between two git refs.
+
+A cluster is affected when its clusters/<name>/site.yaml changed, or when stack content
+in the same repository changed that it renders:
+  - stack/apps/<app>/...              affects clusters enabling <app>
+  - stack/templates/..., stack/infra/... affects all clusters
+
+The affected set is printed as JSON to stdout. With --render only the affected
+clusters and apps are generated, from the stack selected by --stack-from:
+  - cache     the cached spec.stack.ref of each site, refreshed from the remote first so
+              a branch ref includes the pushed changes (default)
+  - worktree  the stack/ directory of the working tree, so unpushed changes are rendered
+              regardless of spec.stack.ref
+
+Examples:
+  # List clusters affected by the changes on a branch
+  klabctl affected --since-ref origin/main
+
+  # Render only what changed between two commits
+  klabctl affected --since-ref HEAD~1 --until-ref HEAD --render
+
+  # Render the changes of the working tree before pushing them
+  klabctl affected --since-ref origin/main --render --stack-from worktree`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if sinceRef == "" {
+				return newValidationError("--since-ref is required")
+			}
+			if stackFrom != stackFromCache && stackFrom != stackFromWorktree {
+				return newValidationError("unsupported --stack-from '%s' (supported: %s, %s)", stackFrom, stackFromCache, stackFromWorktree)
+			}
+
+			changedFiles, err := gitChangedFiles(sinceRef, untilRef)
+			if err != nil {
+				return err
+			}
+
+			affected, err := findAffectedClusters(classifyChanges(changedFiles))
+			if err != nil {
+				return err
+			}
+
+			if render {
+				var stackRepo string
+				if stackFrom == stackFromWorktree {
+					if _, err := os.Stat(filepath.Join("stack", "templates")); err != nil {
+						return newValidationError("--stack-from worktree needs a stack/ directory in the working directory")
+					}
+					stackRepo = "."
+				}
+
+				refreshed := make(map[string]bool)
+				for _, cluster := range affected {
+					if err := renderAffectedCluster(cluster, stackRepo, refreshed); err != nil {
+						return fmt.Errorf("render %s: %w", cluster.Name, err)
+					}
+				}
+			}
+
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(affected)
+		},
+	}
+
+	cmd.Flags().StringVar(&sinceRef, "since-ref", "", "Git ref to compare from (e.g. origin/main)")
+	cmd.Flags().StringVar(&untilRef, "until-ref", "HEAD", "Git ref to compare to")
+	cmd.Flags().BoolVar(&render, "render", false, "Generate the affected clusters and apps")
+	cmd.Flags().StringVar(&stackFrom, "stack-from", stackFromCache, "Stack rendered with --render: cache (refreshed spec.stack.ref) or worktree (stack/ of the working tree)")
+
+	return cmd
+}
+
+// gitChangedFiles returns the files changed between two refs of the repository in the working directory
+func gitChangedFiles(sinceRef, untilRef string) ([]string, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, &ToolNotFoundError{Tool: "git"}
+	}
+
+	output, err := exec.Command("git", "diff", "--name-only", sinceRef+".."+untilRef).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, fmt.Errorf("git diff %s..%s failed: %s", sinceRef, untilRef, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, fmt.Errorf("git diff %s..%s failed: %w", sinceRef, untilRef, err)
+	}
+
+	var files []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			files = append(files, line)
+		}
+	}
+
+	return files, nil
+}
+
+// classifyChanges maps changed repository paths to the sites and stack content they affect
+func classifyChanges(changedFiles []string) affectedChanges {
+	changes := affectedChanges{
+		sites: make(map[string]bool),
+		apps:  make(map[string]bool),
+	}
+
+	for _, file := range changedFiles {
+		parts := strings.Split(filepath.ToSlash(file), "/")
+		switch {
+		case len(parts) == 3 && parts[0] == "clusters" && parts[2] == "site.yaml":
+			changes.sites[filepath.Join(parts...)] = true
+		case len(parts) >= 3 && parts[0] == "stack" && parts[1] == "apps":
+			changes.apps[parts[2]] = true
+		case len(parts) >= 2 && parts[0] == "stack" && (parts[1] == "templates" || parts[1] == "infra"):
+			changes.shared = true
+		}
+	}
+
+	return changes
+}
+
+// findAffectedClusters returns the clusters in clusters/*/site.yaml affected by the changes
+func findAffectedClusters(changes affectedChanges) ([]affectedCluster, error) {
+	sitePaths, err := discoverClusterSites()
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover clusters: %w", err)
+	}
+
+	affected := []affectedCluster{}
+	for _, path := range sitePaths {
+		// A removed cluster has nothing left to render
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue
+		}
+
+		site, err := loadSite(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", path, err)
+		}
+
+		full := changes.shared || changes.sites[path]
+		var apps []string
+		for appName, component := range site.Spec.Apps.Catalog {
+			if component.Enabled && (full || changes.apps[appName]) {
+				apps = append(apps, appName)
+			}
+		}
+		sort.Strings(apps)
+
+		if !full && len(apps) == 0 {
+			continue
+		}
+
+		affected = append(affected, affectedCluster{
+			Name: site.Metadata.Name,
+			Site: path,
+			Full: full,
+			Apps: apps,
+		})
+	}
+
+	return affected, nil
+}
+
+// Stacks affected --render can render from
+const (
+	stackFromCache    = "cache"
+	stackFromWorktree = "worktree"
+)
+
+// renderAffectedCluster generates a whole cluster, or only its affected apps
+// stackRepo is a checkout of the stack repository to render from, empty renders the cached ref
+// Without a worktree stack the cached ref is refreshed once per run, refreshed records the refs already done
+func renderAffectedCluster(cluster affectedCluster, stackRepo string, refreshed map[string]bool) error {
+	site, err := loadSite(cluster.Site)
+	if err != nil {
+		return err
+	}
+
+	if err := applyRenderIf(site); err != nil {
+		return err
+	}
+
+	if stackRepo == "" {
+		if site.Spec.Stack.Source == "" || site.Spec.Stack.Ref == "" {
+			return newValidationError("stack.source and stack.ref are required in site.yaml")
+		}
+		// The change range was taken from the repository, a stale cache would miss those changes
+		if !refreshed[site.Spec.Stack.Ref] {
+			if err := refreshStack(site.Spec.Stack.Ref); err != nil {
+				return err
+			}
+			refreshed[site.Spec.Stack.Ref] = true
+		}
+		if err := EnsureStackAvailable(site.Spec.Stack.Source, site.Spec.Stack.Ref, site.Spec.Stack.Subdir, false); err != nil {
+			return fmt.Errorf("failed to ensure stack is available: %w", err)
+		}
+	}
+
+	opts := generateOptions{
+		manifestFormat:    "kustomize",
+		infraModuleSource: "local",
+		stackRepo:         stackRepo,
+	}
+
+	if cluster.Full {
+		if err := generateInfraManifests(site, opts); err != nil {
+			return fmt.Errorf("failed to generate infrastructure manifests: %w", err)
+		}
+	} else {
+		opts.onlyApps = cluster.Apps
+	}
+
+	renderedCount, err := generateAppManifests(site, opts)
+	if err != nil {
+		return fmt.Errorf("generate apps: %w", err)
+	}
+	statusf(os.Stderr, "✓ Generated %s (%d application components)\n", cluster.Name, renderedCount)
+
+	return nil
+}
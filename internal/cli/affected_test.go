@@ -0,0 +1,153 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestClassifyChanges(t *testing.T) {
+	tests := []struct {
+		name       string
+		files      []string
+		wantSites  []string
+		wantApps   []string
+		wantShared bool
+	}{
+		{name: "site", files: []string{"clusters/demo/site.yaml"}, wantSites: []string{filepath.Join("clusters", "demo", "site.yaml")}},
+		{name: "app template", files: []string{"stack/apps/pihole/templates/kustomization.yaml.tmpl"}, wantApps: []string{"pihole"}},
+		{name: "shared templates", files: []string{"stack/templates/helm.kustomization.yaml.tmpl"}, wantShared: true},
+		{name: "infra", files: []string{"stack/infra/providers/proxmox/base/main.tf"}, wantShared: true},
+		{name: "unrelated", files: []string{"README.md", "clusters/demo/apps/system/apps/pihole/custom/values.yaml"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := classifyChanges(tt.files)
+			if got := sortedKeys(changes.sites); !reflect.DeepEqual(got, tt.wantSites) {
+				t.Errorf("sites = %v, want %v", got, tt.wantSites)
+			}
+			if got := sortedKeys(changes.apps); !reflect.DeepEqual(got, tt.wantApps) {
+				t.Errorf("apps = %v, want %v", got, tt.wantApps)
+			}
+			if changes.shared != tt.wantShared {
+				t.Errorf("shared = %t, want %t", changes.shared, tt.wantShared)
+			}
+		})
+	}
+}
+
+func TestFindAffectedClusters(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeTestFile(t, filepath.Join("clusters", "demo", "site.yaml"), testSiteYaml)
+	writeTestFile(t, filepath.Join("clusters", "other", "site.yaml"), strings.NewReplacer("name: demo", "name: other", "      pihole:\n        enabled: true", "      pihole:\n        enabled: false").Replace(testSiteYaml))
+
+	tests := []struct {
+		name  string
+		files []string
+		want  []affectedCluster
+	}{
+		{
+			name:  "app template affects the clusters enabling the app",
+			files: []string{"stack/apps/pihole/templates/kustomization.yaml.tmpl"},
+			want:  []affectedCluster{{Name: "demo", Site: filepath.Join("clusters", "demo", "site.yaml"), Apps: []string{"pihole"}}},
+		},
+		{
+			name:  "site affects its cluster",
+			files: []string{"clusters/other/site.yaml"},
+			want:  []affectedCluster{{Name: "other", Site: filepath.Join("clusters", "other", "site.yaml"), Full: true, Apps: []string{"external-dns"}}},
+		},
+		{
+			name:  "shared templates affect every cluster",
+			files: []string{"stack/templates/base.kustomization.yaml.tmpl"},
+			want: []affectedCluster{
+				{Name: "demo", Site: filepath.Join("clusters", "demo", "site.yaml"), Full: true, Apps: []string{"external-dns", "pihole"}},
+				{Name: "other", Site: filepath.Join("clusters", "other", "site.yaml"), Full: true, Apps: []string{"external-dns"}},
+			},
+		},
+		{
+			name:  "nothing affected",
+			files: []string{"README.md"},
+			want:  []affectedCluster{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findAffectedClusters(classifyChanges(tt.files))
+			if err != nil {
+				t.Fatalf("findAffectedClusters: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("affected = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderAffectedClusterStackFrom(t *testing.T) {
+	tests := []struct {
+		name     string
+		worktree bool
+	}{
+		{name: "refreshed cache", worktree: false},
+		{name: "worktree", worktree: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := newTestUpstream(t, testStackApps, 1)
+			templatePath := filepath.Join("stack", "apps", "external-dns", "templates", "kustomization.yaml.tmpl")
+			cluster := affectedCluster{Name: "demo", Site: filepath.Join("clusters", "demo", "site.yaml"), Apps: []string{"external-dns"}}
+			writeTestFile(t, cluster.Site, strings.Replace(testSiteYaml, "https://example.com/stack.git", source, 1))
+
+			// Cache the stack, then change the template after the cache was taken
+			cacheDir := filepath.Join(stackCacheDirRoot, testStackRef)
+			if err := os.RemoveAll(cacheDir); err != nil {
+				t.Fatal(err)
+			}
+			if err := EnsureStackAvailable(source, testStackRef, "", false); err != nil {
+				t.Fatalf("EnsureStackAvailable: %v", err)
+			}
+			var stackRepo string
+			if tt.worktree {
+				runTestGit(t, ".", "clone", "-q", source, "checkout")
+				t.Chdir("checkout")
+				writeTestFile(t, cluster.Site, readTestFile(t, filepath.Join("..", cluster.Site)))
+				if err := copyDir(filepath.Join("..", hiddenKlabctlDir), hiddenKlabctlDir); err != nil {
+					t.Fatal(err)
+				}
+				writeTestFile(t, templatePath, readTestFile(t, templatePath)+"# changed\n")
+				stackRepo = "."
+			} else {
+				pushDir := filepath.Join(t.TempDir(), "push")
+				runTestGit(t, ".", "clone", "-q", source, pushDir)
+				writeTestFile(t, filepath.Join(pushDir, templatePath), readTestFile(t, filepath.Join(pushDir, templatePath))+"# changed\n")
+				runTestGit(t, pushDir, "commit", "-q", "-am", "change template")
+				runTestGit(t, pushDir, "push", "-q", "origin", testStackRef)
+			}
+
+			if err := renderAffectedCluster(cluster, stackRepo, make(map[string]bool)); err != nil {
+				t.Fatalf("renderAffectedCluster: %v", err)
+			}
+
+			kustomization := readTestFile(t, filepath.Join("clusters", "demo", "apps", "system", "apps", "external-dns", "generated", "kustomization.yaml"))
+			if !strings.Contains(kustomization, "# changed") {
+				t.Errorf("rendered output misses the template change:\n%s", kustomization)
+			}
+		})
+	}
+}
+
+// sortedKeys returns the keys of a set in sorted order, nil when empty
+func sortedKeys(set map[string]bool) []string {
+	var keys []string
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bamaas/klabctl/internal/config"
+)
+
+// appsRootKustomizationName is the kustomization tying all enabled apps of a cluster together
+const appsRootKustomizationName = "kustomization.yaml"
+
+// writeAppsRootKustomization writes clusters/<name>/apps/kustomization.yaml listing the directory of
+// every enabled app, so 'kustomize build clusters/<name>/apps' builds the whole cluster
+func writeAppsRootKustomization(site *config.Site) error {
+	var resources []string
+	for name, component := range site.Spec.Apps.Catalog {
+		if component.Enabled {
+			resources = append(resources, path.Join(component.Project, component.Namespace, name))
+		}
+	}
+	sort.Strings(resources)
+
+	var b strings.Builder
+	b.WriteString("---\n")
+	b.WriteString("# Generated by klabctl - all enabled apps of the cluster\n")
+	b.WriteString("apiVersion: kustomize.config.k8s.io/v1beta1\n")
+	b.WriteString("kind: Kustomization\n")
+	if len(resources) == 0 {
+		b.WriteString("\nresources: []\n")
+	} else {
+		b.WriteString("\nresources:\n")
+		for _, resource := range resources {
+			fmt.Fprintf(&b, "  - %s\n", resource)
+		}
+	}
+
+	rootPath := filepath.Join("clusters", site.Metadata.Name, "apps", appsRootKustomizationName)
+	if err := writeFileIfChanged(rootPath, []byte(b.String())); err != nil {
+		return fmt.Errorf("failed to write apps root kustomization: %w", err)
+	}
+	return nil
+}
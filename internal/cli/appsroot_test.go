@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteAppsRootKustomization(t *testing.T) {
+	const header = "---\n# Generated by klabctl - all enabled apps of the cluster\napiVersion: kustomize.config.k8s.io/v1beta1\nkind: Kustomization\n\n"
+
+	tests := []struct {
+		name    string
+		disable []string
+		want    string
+	}{
+		{name: "all enabled", want: header + "resources:\n  - system/apps/external-dns\n  - system/apps/pihole\n"},
+		{name: "disabled app", disable: []string{"external-dns"}, want: header + "resources:\n  - system/apps/pihole\n"},
+		{name: "no enabled apps", disable: []string{"external-dns", "pihole"}, want: header + "resources: []\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			site := parseTestSite(t, testSiteYaml)
+			for _, name := range tt.disable {
+				component := site.Spec.Apps.Catalog[name]
+				component.Enabled = false
+				site.Spec.Apps.Catalog[name] = component
+			}
+			appsPath := filepath.Join("clusters", "demo", "apps")
+			if err := os.MkdirAll(appsPath, 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := writeAppsRootKustomization(site); err != nil {
+				t.Fatalf("writeAppsRootKustomization: %v", err)
+			}
+			if got := readTestFile(t, filepath.Join(appsPath, appsRootKustomizationName)); got != tt.want {
+				t.Errorf("apps root kustomization =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bamaas/klabctl/internal/config"
+)
+
+// App types detected from the contents of an app base
+const (
+	// appTypeHelm is a base shipping a Helm chart, either a chart (Chart.yaml) or a kustomize helm generator (helm-chart.yaml)
+	appTypeHelm = "helm"
+	// appTypeKustomize is a plain kustomize base (kustomization.yaml)
+	appTypeKustomize = "kustomize"
+)
+
+// appBase describes the detected type of an app base
+type appBase struct {
+	Type string
+	// RawChart is set when the base is a Helm chart without a kustomization.yaml,
+	// it is wrapped with a helmCharts kustomization instead of being referenced as a resource
+	RawChart bool
+}
+
+// detectAppBase detects the type of an app base from its contents in cache
+func detectAppBase(site *config.Site, opts generateOptions, appName string) (*appBase, error) {
+	baseDir, err := getAppBaseDir(site, opts, appName)
+	if err != nil {
+		return nil, err
+	}
+
+	hasChart := fileExists(filepath.Join(baseDir, "Chart.yaml"))
+	hasHelmChart := fileExists(filepath.Join(baseDir, "helm-chart.yaml"))
+	hasKustomization := fileExists(filepath.Join(baseDir, "kustomization.yaml"))
+
+	switch {
+	case hasChart || hasHelmChart:
+		return &appBase{Type: appTypeHelm, RawChart: hasChart && !hasKustomization}, nil
+	case hasKustomization:
+		return &appBase{Type: appTypeKustomize}, nil
+	default:
+		return nil, fmt.Errorf("cannot detect the type of app base %s: no Chart.yaml, helm-chart.yaml or kustomization.yaml", baseDir)
+	}
+}
+
+// fileExists reports whether path exists and is a regular file
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDetectAppBase(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    []string
+		wantType string
+		wantRaw  bool
+		wantErr  bool
+	}{
+		{name: "kustomize base", files: []string{"kustomization.yaml"}, wantType: appTypeKustomize},
+		{name: "raw chart", files: []string{"Chart.yaml"}, wantType: appTypeHelm, wantRaw: true},
+		{name: "chart with kustomization", files: []string{"Chart.yaml", "kustomization.yaml"}, wantType: appTypeHelm},
+		{name: "helm generator", files: []string{"helm-chart.yaml", "kustomization.yaml"}, wantType: appTypeHelm},
+		{name: "unknown base", files: []string{"README.md"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestStack(t, map[string]testApp{"pihole": {}})
+			site := parseTestSite(t, testSiteYaml)
+			baseDir, err := getAppBaseDir(site, generateOptions{}, "pihole")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Remove(filepath.Join(baseDir, "kustomization.yaml")); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range tt.files {
+				writeTestFile(t, filepath.Join(baseDir, name), "# "+name+"\n")
+			}
+
+			base, err := detectAppBase(site, generateOptions{}, "pihole")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("detectAppBase = %+v, want an error", base)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("detectAppBase: %v", err)
+			}
+			if base.Type != tt.wantType || base.RawChart != tt.wantRaw {
+				t.Errorf("detectAppBase = %+v, want type %s raw chart %t", base, tt.wantType, tt.wantRaw)
+			}
+		})
+	}
+}
+
+func TestRawChartIsWrapped(t *testing.T) {
+	useTestStack(t, map[string]testApp{"pihole": {}, "external-dns": {}})
+	site := parseTestSite(t, testSiteYaml)
+	baseDir, err := getAppBaseDir(site, generateOptions{}, "pihole")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(baseDir, "kustomization.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(baseDir, "Chart.yaml"), "apiVersion: v2\nname: pihole\nversion: 1.0.0\n")
+
+	if _, err := generateAppManifests(site, generateOptions{}); err != nil {
+		t.Fatalf("generateAppManifests: %v", err)
+	}
+
+	tests := []struct {
+		app         string
+		wantHelm    bool
+		wantRelease string
+	}{
+		{app: "pihole", wantHelm: true, wantRelease: "releaseName: pihole"},
+		{app: "external-dns", wantHelm: false},
+	}
+	for _, tt := range tests {
+		kustomization := readTestFile(t, filepath.Join("clusters", "demo", "apps", "system", "apps", tt.app, "generated", "kustomization.yaml"))
+		if helm := strings.Contains(kustomization, "helmCharts:"); helm != tt.wantHelm {
+			t.Errorf("%s wrapped as a helm chart = %t, want %t:\n%s", tt.app, helm, tt.wantHelm, kustomization)
+		}
+		if tt.wantRelease != "" && !strings.Contains(kustomization, tt.wantRelease) {
+			t.Errorf("%s kustomization misses %q:\n%s", tt.app, tt.wantRelease, kustomization)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bamaas/klabctl/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// checkBaseNamespace warns when the app base declares a namespace that differs from the configured one,
+// the base's resources would then target another namespace than the app directory suggests
+func checkBaseNamespace(site *config.Site, opts generateOptions, appName, namespace string) error {
+	baseDir, err := getAppBaseDir(site, opts, appName)
+	if err != nil {
+		return err
+	}
+
+	// The kustomization namespace and the helm generator namespace both override the app namespace
+	for _, fileName := range []string{"kustomization.yaml", "helm-chart.yaml"} {
+		baseNamespace, err := readBaseNamespace(filepath.Join(baseDir, fileName))
+		if err != nil {
+			return err
+		}
+		if baseNamespace != "" && baseNamespace != namespace {
+			warnf("%s is configured for namespace '%s' but its base %s declares namespace '%s'", appName, namespace, fileName, baseNamespace)
+		}
+	}
+
+	return nil
+}
+
+// readBaseNamespace returns the top-level namespace of a base file, or "" if the file or field is missing
+func readBaseNamespace(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var doc struct {
+		Namespace string `yaml:"namespace"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	return doc.Namespace, nil
+}
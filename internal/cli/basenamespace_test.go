@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckBaseNamespace(t *testing.T) {
+	tests := []struct {
+		name         string
+		files        map[string]string
+		wantWarnings int
+		wantErr      bool
+	}{
+		{name: "no namespace", files: map[string]string{"kustomization.yaml": "resources: []\n"}},
+		{name: "same namespace", files: map[string]string{"kustomization.yaml": "namespace: apps\n"}},
+		{name: "kustomization namespace differs", files: map[string]string{"kustomization.yaml": "namespace: dns\n"}, wantWarnings: 1},
+		{name: "helm chart namespace differs", files: map[string]string{"helm-chart.yaml": "namespace: dns\n"}, wantWarnings: 1},
+		{name: "both differ", files: map[string]string{"kustomization.yaml": "namespace: dns\n", "helm-chart.yaml": "namespace: dns\n"}, wantWarnings: 2},
+		{name: "invalid base", files: map[string]string{"kustomization.yaml": "namespace: [\n"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestStack(t, map[string]testApp{"pihole": {}})
+			site := parseTestSite(t, testSiteYaml)
+			baseDir, err := getAppBaseDir(site, generateOptions{}, "pihole")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, content := range tt.files {
+				writeTestFile(t, filepath.Join(baseDir, name), content)
+			}
+			warningCount = 0
+			t.Cleanup(func() { warningCount = 0 })
+
+			var checkErr error
+			captureStderr(t, func() { checkErr = checkBaseNamespace(site, generateOptions{}, "pihole", "apps") })
+			if (checkErr != nil) != tt.wantErr {
+				t.Fatalf("checkBaseNamespace error = %v, want an error: %t", checkErr, tt.wantErr)
+			}
+			if warningCount != tt.wantWarnings {
+				t.Errorf("warnings = %d, want %d", warningCount, tt.wantWarnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// stackValidationFile records the last full validation of a cached stack, it lives in .git so it
+	// doesn't show up as a modification and is removed together with the cache
+	stackValidationFile = "klabctl-validated.json"
+	// stackValidationTTL is how long a validated cache is used without running git again
+	stackValidationTTL = 5 * time.Minute
+	// stackRemoteCheckTTL is how long a cached tag is trusted before its upstream commit is checked again
+	stackRemoteCheckTTL = 24 * time.Hour
+)
+
+// stackValidation is the recorded result of a full cache validation
+type stackValidation struct {
+	Ref         string    `json:"ref"`
+	Subdir      string    `json:"subdir"`
+	Commit      string    `json:"commit"`
+	ValidatedAt time.Time `json:"validatedAt"`
+	// RemoteCheckedAt is when the cached ref was last compared with the remote
+	RemoteCheckedAt time.Time `json:"remoteCheckedAt,omitempty"`
+}
+
+// stackValidationPath returns the path of the validation record of a cached stack
+func stackValidationPath(stackDir string) string {
+	return filepath.Join(stackDir, ".git", stackValidationFile)
+}
+
+// recordStackValidation writes the validation record after the cache passed the full check
+// Unless the remote was checked in this run, the time of the previous remote check is kept
+// Failing to record only costs the fast path of the next run, so errors are ignored
+func recordStackValidation(stackDir, ref, subdir string, remoteChecked bool) {
+	commit, err := resolveCachedCommit(stackDir)
+	if err != nil {
+		return
+	}
+	record := stackValidation{Ref: ref, Subdir: subdir, Commit: commit, ValidatedAt: time.Now()}
+	if remoteChecked {
+		record.RemoteCheckedAt = record.ValidatedAt
+	} else if previous, ok := readStackValidation(stackDir); ok {
+		record.RemoteCheckedAt = previous.RemoteCheckedAt
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	_ = os.WriteFile(stackValidationPath(stackDir), data, 0644)
+}
+
+// forgetStackValidation removes the validation record so the next run does the full check
+func forgetStackValidation(stackDir string) {
+	_ = os.Remove(stackValidationPath(stackDir))
+}
+
+// isRecentlyValidated reports whether the cache passed the full check within stackValidationTTL
+// for the same ref and subdir and is still checked out at the recorded commit. Only files are read,
+// no git subprocess is started. Edits made to the cache within the TTL are caught once it expires.
+func isRecentlyValidated(stackDir, ref, subdir string) bool {
+	record, ok := readStackValidation(stackDir)
+	if !ok {
+		return false
+	}
+	if record.Ref != ref || record.Subdir != subdir || time.Since(record.ValidatedAt) > stackValidationTTL {
+		return false
+	}
+
+	head, ok := readHeadCommit(stackDir)
+	return ok && head == record.Commit
+}
+
+// remoteCheckDue reports whether the cached ref should be compared with the remote, which is the case
+// without a validation record (a new cache or an explicit pull) or once stackRemoteCheckTTL has passed
+func remoteCheckDue(stackDir string) bool {
+	record, ok := readStackValidation(stackDir)
+	return !ok || time.Since(record.RemoteCheckedAt) > stackRemoteCheckTTL
+}
+
+// readStackValidation reads the validation record of a cached stack
+func readStackValidation(stackDir string) (stackValidation, bool) {
+	var record stackValidation
+	data, err := os.ReadFile(stackValidationPath(stackDir))
+	if err != nil {
+		return record, false
+	}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return record, false
+	}
+	return record, true
+}
+
+// readHeadCommit reads the commit HEAD points to from the .git directory
+// A branch stored only in packed-refs is reported as unknown
+func readHeadCommit(stackDir string) (string, bool) {
+	gitDir := filepath.Join(stackDir, ".git")
+	data, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return "", false
+	}
+	head := strings.TrimSpace(string(data))
+
+	// A branch checkout holds a symbolic ref, a tag or commit checkout the commit itself
+	if ref, ok := strings.CutPrefix(head, "ref: "); ok {
+		data, err = os.ReadFile(filepath.Join(gitDir, filepath.FromSlash(ref)))
+		if err != nil {
+			return "", false
+		}
+		head = strings.TrimSpace(string(data))
+	}
+
+	return head, head != ""
+}
@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withoutGit empties PATH so every git subprocess fails
+func withoutGit(t testing.TB) {
+	t.Helper()
+	t.Setenv("PATH", t.TempDir())
+}
+
+func TestEnsureStackAvailableFastPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		subdir   string
+		change   func(t *testing.T, cacheDir string)
+		wantFast bool
+	}{
+		{
+			name:     "recently validated",
+			change:   func(t *testing.T, cacheDir string) {},
+			wantFast: true,
+		},
+		{
+			name: "expired record",
+			change: func(t *testing.T, cacheDir string) {
+				var record stackValidation
+				if err := json.Unmarshal([]byte(readTestFile(t, stackValidationPath(cacheDir))), &record); err != nil {
+					t.Fatal(err)
+				}
+				record.ValidatedAt = time.Now().Add(-2 * stackValidationTTL)
+				data, err := json.Marshal(record)
+				if err != nil {
+					t.Fatal(err)
+				}
+				writeTestFile(t, stackValidationPath(cacheDir), string(data))
+			},
+			wantFast: false,
+		},
+		{
+			name:     "other subdir",
+			subdir:   "other",
+			change:   func(t *testing.T, cacheDir string) {},
+			wantFast: false,
+		},
+		{
+			name: "moved ref",
+			change: func(t *testing.T, cacheDir string) {
+				runTestGit(t, cacheDir, "commit", "-q", "--allow-empty", "-m", "first")
+				runTestGit(t, cacheDir, "commit", "-q", "--allow-empty", "-m", "second")
+				runTestGit(t, cacheDir, "checkout", "-q", "--detach", "HEAD~1")
+				// The full check refuses a cache that isn't on the requested ref
+				err := verifyCachedRef(cacheDir, testStackRef)
+				if err == nil || !strings.Contains(err.Error(), "instead of the requested ref") {
+					t.Errorf("verifyCachedRef = %v, want the moved ref to be reported", err)
+				}
+			},
+			wantFast: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := newTestUpstream(t, testStackApps, 2)
+			t.Chdir(t.TempDir())
+			if err := EnsureStackAvailable(source, testStackRef, "", false); err != nil {
+				t.Fatalf("EnsureStackAvailable: %v", err)
+			}
+			cacheDir := filepath.Join(stackCacheDirRoot, testStackRef)
+
+			tt.change(t, cacheDir)
+			if got := isRecentlyValidated(cacheDir, testStackRef, tt.subdir); got != tt.wantFast {
+				t.Errorf("isRecentlyValidated = %t, want %t", got, tt.wantFast)
+			}
+
+			// Only the fast path succeeds without git
+			withoutGit(t)
+			err := EnsureStackAvailable(source, testStackRef, tt.subdir, false)
+			if tt.wantFast && err != nil {
+				t.Errorf("fast path ran git: %v", err)
+			}
+			if !tt.wantFast && err == nil {
+				t.Error("full check was skipped")
+			}
+		})
+	}
+}
+
+func BenchmarkEnsureStackAvailable(b *testing.B) {
+	source := newTestUpstream(b, testStackApps, 1)
+	b.Chdir(b.TempDir())
+	if err := EnsureStackAvailable(source, testStackRef, "", false); err != nil {
+		b.Fatalf("EnsureStackAvailable: %v", err)
+	}
+
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer devNull.Close()
+	stderr := os.Stderr
+	os.Stderr = devNull
+	defer func() { os.Stderr = stderr }()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := EnsureStackAvailable(source, testStackRef, "", false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package cli
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/bamaas/klabctl/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func newCheckTemplatesCmd() *cobra.Command {
+
+	var stackDir string
+	var delims []string
+
+	cmd := &cobra.Command{
+		Use:   "check-templates",
+		Short: "Check that all stack templates compile",
+		Long: `Parse every template of a stack without rendering or writing anything.
+
+Templates are parsed with the same functions used by 'klabctl generate', so
+parse errors are caught before a stack ref is shipped.
+
+Examples:
+  # Check the stack referenced by a site.yaml
+  klabctl check-templates --site clusters/production/site.yaml
+
+  # Check a local stack checkout (directory containing stack/)
+  klabctl check-templates --stack-dir .
+
+  # Check a stack using custom template delimiters
+  klabctl check-templates --stack-dir . --delims '[[,]]'`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := config.ValidateDelimiters(delims); err != nil {
+				return &ValidationError{Err: err}
+			}
+			templating := config.Templating{Delimiters: delims}
+
+			if stackDir == "" {
+				site, err := loadSite(sitePath)
+				if err != nil {
+					return fmt.Errorf("failed to load site.yaml: %w", err)
+				}
+				if err := EnsureStackAvailable(site.Spec.Stack.Source, site.Spec.Stack.Ref, site.Spec.Stack.Subdir, false); err != nil {
+					return fmt.Errorf("failed to ensure stack is available: %w", err)
+				}
+				stackDir = filepath.Join(getStackCacheDir(site), site.Spec.Stack.Subdir)
+				if len(delims) == 0 {
+					templating = site.Spec.Templating
+				}
+			}
+
+			return checkStackTemplates(stackDir, templating)
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&delims, "delims", nil, "Left and right template delimiters, e.g. '[[,]]' (default: spec.templating.delimiters, else {{ and }})")
+	cmd.Flags().StringVar(&stackDir, "stack-dir", "", "Path to a local stack checkout (directory containing stack/) instead of the site's cached stack")
+
+	return cmd
+}
+
+// checkStackTemplates parses all general, app and infra templates of a stack and reports parse errors per file
+func checkStackTemplates(stackDir string, templating config.Templating) error {
+	stackRoot := filepath.Join(stackDir, "stack")
+	if _, err := os.Stat(stackRoot); err != nil {
+		return fmt.Errorf("stack directory not found at %s", stackRoot)
+	}
+
+	// All templates are parsed with the render functions, only app templates inherit the header and base
+	var templateFiles, appTemplateFiles, infraTemplateFiles []string
+	general, err := findTemplateFiles(filepath.Join(stackRoot, "templates"))
+	if err != nil {
+		return err
+	}
+	templateFiles = append(templateFiles, general...)
+
+	appTemplateDirs, err := filepath.Glob(filepath.Join(stackRoot, "apps", "*", "templates"))
+	if err != nil {
+		return err
+	}
+	for _, dir := range appTemplateDirs {
+		appTemplates, err := findTemplateFiles(dir)
+		if err != nil {
+			return err
+		}
+		appTemplateFiles = append(appTemplateFiles, appTemplates...)
+	}
+
+	infraTemplateDirs, err := filepath.Glob(filepath.Join(stackRoot, "infra", "providers", "*", "templates"))
+	if err != nil {
+		return err
+	}
+	for _, dir := range infraTemplateDirs {
+		infraTemplates, err := findTemplateFiles(dir)
+		if err != nil {
+			return err
+		}
+		infraTemplateFiles = append(infraTemplateFiles, infraTemplates...)
+	}
+
+	failed := 0
+	check := func(path string, funcMap template.FuncMap, inherits bool) {
+		tmpl, err := parseTemplateFile(path, funcMap, templating)
+		// App templates inherit header and base and may not redefine them
+		if err == nil && inherits {
+			err = checkReservedTemplates(tmpl)
+		}
+		if err != nil {
+			failed++
+			statusf(os.Stdout, "✗ %s: %v\n", path, err)
+		}
+	}
+	for _, path := range templateFiles {
+		check(path, templateFuncMap(), false)
+	}
+	for _, path := range appTemplateFiles {
+		check(path, templateFuncMap(), true)
+	}
+	for _, path := range infraTemplateFiles {
+		check(path, templateFuncMap(), false)
+	}
+
+	total := len(templateFiles) + len(appTemplateFiles) + len(infraTemplateFiles)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d templates failed to parse", failed, total)
+	}
+
+	statusf(os.Stdout, "✓ All %d templates parsed successfully\n", total)
+	return nil
+}
+
+// findTemplateFiles returns all .tmpl files below dir, or none if dir doesn't exist
+func findTemplateFiles(dir string) ([]string, error) {
+	var files []string
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return files, nil
+	}
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(path, ".tmpl") {
+			files = append(files, path)
+		}
+		return nil
+	})
+
+	return files, err
+}
+
+// parseTemplateFile parses a single template file without executing it
+func parseTemplateFile(path string, funcMap template.FuncMap, templating config.Templating) (*template.Template, error) {
+	content, err := readTemplateFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl := template.New(filepath.Base(path)).Delims(templating.Delims())
+	if funcMap != nil {
+		tmpl = tmpl.Funcs(funcMap)
+	}
+	return tmpl.Parse(string(content))
+}
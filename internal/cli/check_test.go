@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bamaas/klabctl/internal/config"
+)
+
+func TestCheckStackTemplates(t *testing.T) {
+	tests := []struct {
+		name       string
+		template   string
+		templating config.Templating
+		wantError  string
+	}{
+		{name: "valid", template: "{{- template \"base\" . }}\n# {{ .Values.host | quote }}\n"},
+		{name: "parse error", template: "{{ .Values.host \n", wantError: "1 of"},
+		{name: "unknown function", template: "{{ .Values.host | shout }}\n", wantError: "1 of"},
+		{name: "redefines base", template: "{{- define \"base\" }}resources: []{{ end }}\n", wantError: "1 of"},
+		{name: "redefines header", template: "{{- define \"header\" }}# header{{ end }}\n{{- template \"base\" . }}\n", wantError: "1 of"},
+		{name: "custom delimiters", template: "[[- template \"base\" . ]]\n# {{ .Values.host | shout }}\n", templating: config.Templating{Delimiters: []string{"[[", "]]"}}},
+		{name: "custom delimiters with an error", template: "[[ .Values.host | shout ]]\n", templating: config.Templating{Delimiters: []string{"[[", "]]"}}, wantError: "1 of"},
+		{name: "extends additional resources", template: "{{- define \"additional-resources\" }}\n  - extra.yaml\n{{- end }}\n{{- template \"base\" . }}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := useTestStack(t, map[string]testApp{"pihole": {Template: tt.template}})
+
+			var err error
+			output := captureStdout(t, func() { err = checkStackTemplates(cacheDir, tt.templating) })
+			if tt.wantError == "" {
+				if err != nil {
+					t.Fatalf("checkStackTemplates: %v\n%s", err, output)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+			}
+			if !strings.Contains(output, "pihole") {
+				t.Errorf("output doesn't name the failing template:\n%s", output)
+			}
+		})
+	}
+}
+
+func TestCheckStackTemplatesMissingStack(t *testing.T) {
+	if err := checkStackTemplates(t.TempDir(), config.Templating{}); err == nil || !strings.Contains(err.Error(), "stack directory not found") {
+		t.Errorf("error = %v, want the missing stack directory to be reported", err)
+	}
+}
+
+func TestGenerateRejectsReservedTemplates(t *testing.T) {
+	tests := []struct {
+		name      string
+		template  string
+		wantError string
+	}{
+		{name: "base", template: "{{- define \"base\" }}resources: []{{ end }}\n", wantError: `redefines the reserved template "base"`},
+		{name: "kustomization header", template: "{{- define \"kustomization-header\" }}{{ end }}\n{{- template \"base\" . }}\n", wantError: `redefines the reserved template "kustomization-header"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestStack(t, map[string]testApp{
+				"pihole":       testStackApps["pihole"],
+				"external-dns": {Template: tt.template},
+			})
+			site := parseTestSite(t, testSiteYaml)
+
+			_, err := generateAppManifests(site, generateOptions{})
+			if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantError)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// valueChange describes a single difference between two values trees
+type valueChange struct {
+	Path string
+	// Kind is one of "added" (only in the new tree), "removed" (only in the old tree) or "changed"
+	Kind string
+	Old  interface{}
+	New  interface{}
+}
+
+// diffValues compares two values trees and returns the differences sorted by path
+// Nested maps are compared key by key, any other value is compared as a whole
+func diffValues(path string, oldValue, newValue interface{}) []valueChange {
+	oldMap, oldIsMap := oldValue.(map[string]interface{})
+	newMap, newIsMap := newValue.(map[string]interface{})
+
+	if !oldIsMap || !newIsMap {
+		if reflect.DeepEqual(oldValue, newValue) {
+			return nil
+		}
+		return []valueChange{{Path: path, Kind: "changed", Old: oldValue, New: newValue}}
+	}
+
+	keys := make(map[string]bool)
+	for key := range oldMap {
+		keys[key] = true
+	}
+	for key := range newMap {
+		keys[key] = true
+	}
+
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	var changes []valueChange
+	for _, key := range sortedKeys {
+		keyPath := key
+		if path != "" {
+			keyPath = path + "." + key
+		}
+
+		oldChild, inOld := oldMap[key]
+		newChild, inNew := newMap[key]
+
+		// An empty map carries no values, treat it the same as an absent key
+		if isEmptyValuesMap(oldChild) {
+			inOld = false
+		}
+		if isEmptyValuesMap(newChild) {
+			inNew = false
+		}
+
+		switch {
+		case !inOld && !inNew:
+			continue
+		case !inOld:
+			changes = append(changes, valueChange{Path: keyPath, Kind: "added", New: newChild})
+		case !inNew:
+			changes = append(changes, valueChange{Path: keyPath, Kind: "removed", Old: oldChild})
+		default:
+			changes = append(changes, diffValues(keyPath, oldChild, newChild)...)
+		}
+	}
+
+	return changes
+}
+
+// isEmptyValuesMap reports whether value is a map without any keys
+func isEmptyValuesMap(value interface{}) bool {
+	m, ok := value.(map[string]interface{})
+	return ok && len(m) == 0
+}
+
+// formatDiffValue formats a value for diff output, nested values are printed as compact JSON
+func formatDiffValue(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Sprintf("%v", value)
+		}
+		return string(data)
+	default:
+		return fmt.Sprintf("%v", value)
+	}
+}
+
+// printValueChanges prints changes using the given labels for the old and new side
+func printValueChanges(w io.Writer, changes []valueChange, oldLabel, newLabel string) {
+	for _, change := range changes {
+		switch change.Kind {
+		case "added":
+			fmt.Fprintf(w, "+ %s: %s (only in %s)\n", change.Path, formatDiffValue(change.New), newLabel)
+		case "removed":
+			fmt.Fprintf(w, "- %s: %s (only in %s)\n", change.Path, formatDiffValue(change.Old), oldLabel)
+		default:
+			fmt.Fprintf(w, "~ %s: %s=%s %s=%s\n", change.Path, oldLabel, formatDiffValue(change.Old), newLabel, formatDiffValue(change.New))
+		}
+	}
+}
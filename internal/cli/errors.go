@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Exit codes returned by klabctl, see the root command help
+const (
+	exitCodeGeneric      = 1
+	exitCodeValidation   = 2
+	exitCodeCacheMissing = 3
+	exitCodeToolMissing  = 4
+)
+
+// ValidationError reports an invalid site configuration
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string { return e.Err.Error() }
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+// newValidationError creates a ValidationError from a formatted message
+func newValidationError(format string, args ...interface{}) error {
+	return &ValidationError{Err: fmt.Errorf(format, args...)}
+}
+
+// CacheError reports that the stack cache is missing or could not be made available
+type CacheError struct {
+	Err error
+}
+
+func (e *CacheError) Error() string { return e.Err.Error() }
+func (e *CacheError) Unwrap() error { return e.Err }
+
+// ToolNotFoundError reports that a required external tool is not installed
+type ToolNotFoundError struct {
+	Tool string
+}
+
+func (e *ToolNotFoundError) Error() string { return fmt.Sprintf("%s not found in PATH", e.Tool) }
+
+// exitCode maps an error returned by a command to the documented exit code
+func exitCode(err error) int {
+	var toolErr *ToolNotFoundError
+	var validationErr *ValidationError
+	var cacheErr *CacheError
+
+	switch {
+	case errors.As(err, &toolErr):
+		return exitCodeToolMissing
+	case errors.As(err, &validationErr):
+		return exitCodeValidation
+	case errors.As(err, &cacheErr):
+		return exitCodeCacheMissing
+	default:
+		return exitCodeGeneric
+	}
+}
@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "generic", err: errors.New("boom"), want: exitCodeGeneric},
+		{name: "validation", err: newValidationError("invalid %s", "site"), want: exitCodeValidation},
+		{name: "wrapped validation", err: fmt.Errorf("load site: %w", newValidationError("invalid")), want: exitCodeValidation},
+		{name: "cache", err: &CacheError{Err: errors.New("unavailable")}, want: exitCodeCacheMissing},
+		{name: "tool", err: &ToolNotFoundError{Tool: "terraform"}, want: exitCodeToolMissing},
+		{name: "tool inside a cache error", err: &CacheError{Err: fmt.Errorf("failed to pull stack: %w", &ToolNotFoundError{Tool: "git"})}, want: exitCodeToolMissing},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.err); got != tt.want {
+				t.Errorf("exitCode = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateExitCodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		siteYaml string
+		noStack  bool
+		want     int
+	}{
+		{name: "invalid site", siteYaml: strings.Replace(testSiteYaml, "  apps:\n", "  layout:\n    generatedDir: base\n  apps:\n", 1), want: exitCodeValidation},
+		{name: "site in another cluster directory", siteYaml: strings.Replace(testSiteYaml, "name: demo", "name: other", 1), want: exitCodeValidation},
+		{name: "stack unavailable", siteYaml: strings.Replace(testSiteYaml, "https://example.com/stack.git", "file:///nonexistent/stack.git", 1), noStack: true, want: exitCodeCacheMissing},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.noStack {
+				if _, err := exec.LookPath("git"); err != nil {
+					t.Skip("git is not installed")
+				}
+				t.Chdir(t.TempDir())
+			} else {
+				useTestStack(t, testStackApps)
+			}
+			writeTestSite(t, tt.siteYaml)
+
+			_, err := runTestGenerate(t)
+			if err == nil {
+				t.Fatal("generate succeeded, want an error")
+			}
+			if got := exitCode(err); got != tt.want {
+				t.Errorf("exit code = %d, want %d (%v)", got, tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bamaas/klabctl/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// externalSecretsFileName is the file in a component's generated directory holding its ExternalSecrets
+const externalSecretsFileName = "external-secrets.yaml"
+
+// secretRef is a component value marked to be read from the secret store instead of being rendered:
+//
+//	values:
+//	  cloudflare:
+//	    apiToken:
+//	      secretRef:
+//	        key: cloudflare        # remote key in the store (required)
+//	        property: api-token    # property of the remote key (optional)
+//	        secretName: cloudflare # target Secret (default: <component>-secrets)
+//	        secretKey: api-token   # key in the target Secret (default: the value path, e.g. cloudflare.apiToken)
+type secretRef struct {
+	Path       string
+	Key        string
+	Property   string
+	SecretName string
+	SecretKey  string
+}
+
+// ExternalSecret is the subset of the external-secrets.io ExternalSecret rendered by klabctl
+type ExternalSecret struct {
+	APIVersion string             `yaml:"apiVersion"`
+	Kind       string             `yaml:"kind"`
+	Metadata   ExternalSecretMeta `yaml:"metadata"`
+	Spec       ExternalSecretSpec `yaml:"spec"`
+}
+
+// ExternalSecretMeta is the metadata of an ExternalSecret
+type ExternalSecretMeta struct {
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// ExternalSecretSpec is the spec of an ExternalSecret
+type ExternalSecretSpec struct {
+	RefreshInterval string                 `yaml:"refreshInterval"`
+	SecretStoreRef  ExternalSecretStoreRef `yaml:"secretStoreRef"`
+	Target          ExternalSecretTarget   `yaml:"target"`
+	Data            []ExternalSecretData   `yaml:"data"`
+}
+
+// ExternalSecretStoreRef references the SecretStore or ClusterSecretStore
+type ExternalSecretStoreRef struct {
+	Name string `yaml:"name"`
+	Kind string `yaml:"kind"`
+}
+
+// ExternalSecretTarget is the Secret created by the ExternalSecret
+type ExternalSecretTarget struct {
+	Name string `yaml:"name"`
+}
+
+// ExternalSecretData maps a remote key to a key of the target Secret
+type ExternalSecretData struct {
+	SecretKey string                  `yaml:"secretKey"`
+	RemoteRef ExternalSecretRemoteRef `yaml:"remoteRef"`
+}
+
+// ExternalSecretRemoteRef is the key (and optional property) in the secret store
+type ExternalSecretRemoteRef struct {
+	Key      string `yaml:"key"`
+	Property string `yaml:"property,omitempty"`
+}
+
+// asSecretRef returns the secretRef marker of a value, or nil if the value isn't marked
+func asSecretRef(value interface{}) map[string]interface{} {
+	marker, ok := value.(map[string]interface{})
+	if !ok || len(marker) != 1 {
+		return nil
+	}
+	ref, _ := marker["secretRef"].(map[string]interface{})
+	return ref
+}
+
+// findSecretRefs returns the values marked as secretRef, sorted by path
+func findSecretRefs(componentName string, values map[string]interface{}) ([]secretRef, error) {
+	var refs []secretRef
+
+	var walk func(prefix string, values map[string]interface{}) error
+	walk = func(prefix string, values map[string]interface{}) error {
+		for key, value := range values {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+
+			if marker := asSecretRef(value); marker != nil {
+				ref := secretRef{Path: path, SecretName: componentName + "-secrets", SecretKey: path}
+				ref.Key, _ = marker["key"].(string)
+				if ref.Key == "" {
+					return newValidationError("secretRef at %s.values.%s has no key", componentName, path)
+				}
+				ref.Property, _ = marker["property"].(string)
+				if name, _ := marker["secretName"].(string); name != "" {
+					ref.SecretName = name
+				}
+				if secretKey, _ := marker["secretKey"].(string); secretKey != "" {
+					ref.SecretKey = secretKey
+				}
+				refs = append(refs, ref)
+				continue
+			}
+
+			if nested, ok := value.(map[string]interface{}); ok {
+				if err := walk(path, nested); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := walk("", values); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Path < refs[j].Path })
+	return refs, nil
+}
+
+// stripSecretRefs returns a copy of values with every secretRef marker replaced by an empty string,
+// so no secret material or marker reaches the templates
+func stripSecretRefs(values map[string]interface{}) map[string]interface{} {
+	if values == nil {
+		return nil
+	}
+
+	stripped := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		if asSecretRef(value) != nil {
+			stripped[key] = ""
+			continue
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			stripped[key] = stripSecretRefs(nested)
+			continue
+		}
+		stripped[key] = value
+	}
+	return stripped
+}
+
+// writeExternalSecrets writes <generatedPath>/external-secrets.yaml with an ExternalSecret per target Secret
+// A stale file is removed when the component has no secretRef values
+func writeExternalSecrets(site *config.Site, componentName string, component *config.Component, generatedPath string) error {
+	outputPath := filepath.Join(generatedPath, externalSecretsFileName)
+
+	refs, err := findSecretRefs(componentName, component.Values)
+	if err != nil {
+		return err
+	}
+	if len(refs) == 0 {
+		if err := os.Remove(outputPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	if site.Spec.Secrets.Store == "" {
+		return newValidationError("%s has secretRef values but spec.secrets.store is not set", componentName)
+	}
+
+	// Group the refs by target Secret, in order of first appearance
+	var secretNames []string
+	bySecret := make(map[string][]secretRef)
+	for _, ref := range refs {
+		if _, ok := bySecret[ref.SecretName]; !ok {
+			secretNames = append(secretNames, ref.SecretName)
+		}
+		bySecret[ref.SecretName] = append(bySecret[ref.SecretName], ref)
+	}
+
+	var documents []string
+	for _, secretName := range secretNames {
+		externalSecret := ExternalSecret{
+			APIVersion: "external-secrets.io/v1beta1",
+			Kind:       "ExternalSecret",
+			Metadata: ExternalSecretMeta{
+				Name:      secretName,
+				Namespace: component.Namespace,
+			},
+			Spec: ExternalSecretSpec{
+				RefreshInterval: site.Spec.Secrets.RefreshInterval,
+				SecretStoreRef: ExternalSecretStoreRef{
+					Name: site.Spec.Secrets.Store,
+					Kind: site.Spec.Secrets.StoreKind,
+				},
+				Target: ExternalSecretTarget{Name: secretName},
+			},
+		}
+		for _, ref := range bySecret[secretName] {
+			externalSecret.Spec.Data = append(externalSecret.Spec.Data, ExternalSecretData{
+				SecretKey: ref.SecretKey,
+				RemoteRef: ExternalSecretRemoteRef{Key: ref.Key, Property: ref.Property},
+			})
+		}
+
+		data, err := yaml.Marshal(externalSecret)
+		if err != nil {
+			return fmt.Errorf("failed to marshal ExternalSecret %s: %w", secretName, err)
+		}
+		documents = append(documents, "---\n"+string(data))
+	}
+
+	return writeOutputFile(outputPath, []byte(strings.Join(documents, "")))
+}
@@ -0,0 +1,160 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bamaas/klabctl/internal/config"
+)
+
+func TestFindSecretRefs(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  map[string]interface{}
+		want    []secretRef
+		wantErr bool
+	}{
+		{
+			name:   "no markers",
+			values: map[string]interface{}{"host": "pihole.lan"},
+		},
+		{
+			name: "defaults",
+			values: map[string]interface{}{
+				"cloudflare": map[string]interface{}{
+					"apiToken": map[string]interface{}{"secretRef": map[string]interface{}{"key": "cloudflare"}},
+				},
+			},
+			want: []secretRef{{Path: "cloudflare.apiToken", Key: "cloudflare", SecretName: "external-dns-secrets", SecretKey: "cloudflare.apiToken"}},
+		},
+		{
+			name: "configured and sorted",
+			values: map[string]interface{}{
+				"token": map[string]interface{}{"secretRef": map[string]interface{}{"key": "b"}},
+				"auth": map[string]interface{}{"secretRef": map[string]interface{}{
+					"key": "a", "property": "password", "secretName": "auth", "secretKey": "pass",
+				}},
+			},
+			want: []secretRef{
+				{Path: "auth", Key: "a", Property: "password", SecretName: "auth", SecretKey: "pass"},
+				{Path: "token", Key: "b", SecretName: "external-dns-secrets", SecretKey: "token"},
+			},
+		},
+		{
+			name: "map with other keys is not a marker",
+			values: map[string]interface{}{
+				"token": map[string]interface{}{"secretRef": map[string]interface{}{"key": "b"}, "other": true},
+			},
+		},
+		{
+			name: "missing key",
+			values: map[string]interface{}{
+				"token": map[string]interface{}{"secretRef": map[string]interface{}{"property": "x"}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findSecretRefs("external-dns", tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("findSecretRefs error = %v, want an error: %t", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findSecretRefs = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripSecretRefs(t *testing.T) {
+	values := map[string]interface{}{
+		"host": "pihole.lan",
+		"cloudflare": map[string]interface{}{
+			"apiToken": map[string]interface{}{"secretRef": map[string]interface{}{"key": "cloudflare"}},
+			"zone":     "example.com",
+		},
+	}
+	want := map[string]interface{}{
+		"host":       "pihole.lan",
+		"cloudflare": map[string]interface{}{"apiToken": "", "zone": "example.com"},
+	}
+
+	if got := stripSecretRefs(values); !reflect.DeepEqual(got, want) {
+		t.Errorf("stripSecretRefs = %v, want %v", got, want)
+	}
+	if _, ok := values["cloudflare"].(map[string]interface{})["apiToken"].(map[string]interface{}); !ok {
+		t.Error("stripSecretRefs modified the input values")
+	}
+}
+
+func TestWriteExternalSecrets(t *testing.T) {
+	marked := map[string]interface{}{
+		"apiToken": map[string]interface{}{"secretRef": map[string]interface{}{"key": "cloudflare", "property": "token"}},
+	}
+
+	tests := []struct {
+		name      string
+		store     string
+		values    map[string]interface{}
+		stale     bool
+		want      []string
+		wantFile  bool
+		wantError string
+	}{
+		{
+			name:     "renders an ExternalSecret",
+			store:    "vault",
+			values:   marked,
+			wantFile: true,
+			want:     []string{"kind: ExternalSecret", "name: external-dns-secrets", "namespace: apps", "name: vault", "kind: ClusterSecretStore", "refreshInterval: 1h", "secretKey: apiToken", "property: token"},
+		},
+		{name: "no store", values: marked, wantError: "spec.secrets.store is not set"},
+		{name: "stale file is removed", store: "vault", values: map[string]interface{}{"interval": "1m"}, stale: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			site := parseTestSite(t, testSiteYaml)
+			site.Spec.Secrets.Store = tt.store
+			component := config.Component{Namespace: "apps", Values: tt.values}
+			outputPath := filepath.Join("generated", externalSecretsFileName)
+			if err := os.MkdirAll("generated", 0755); err != nil {
+				t.Fatal(err)
+			}
+			if tt.stale {
+				writeTestFile(t, outputPath, "stale\n")
+			}
+
+			err := writeExternalSecrets(site, "external-dns", &component, "generated")
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("writeExternalSecrets: %v", err)
+			}
+
+			_, statErr := os.Stat(outputPath)
+			if exists := statErr == nil; exists != tt.wantFile {
+				t.Fatalf("%s exists = %t, want %t", outputPath, exists, tt.wantFile)
+			}
+			if !tt.wantFile {
+				return
+			}
+			content := readTestFile(t, outputPath)
+			for _, want := range tt.want {
+				if !strings.Contains(content, want) {
+					t.Errorf("external secrets miss %q:\n%s", want, content)
+				}
+			}
+		})
+	}
+}
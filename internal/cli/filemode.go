@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"os"
+
+	"github.com/bamaas/klabctl/internal/config"
+)
+
+// outputFileMode and outputDirMode are the permissions of generated files and directories (--file-mode, --dir-mode)
+// Zero keeps the defaults: 0644 files and 0755 directories before umask, copied stack files keep their mode
+var outputFileMode, outputDirMode os.FileMode
+
+// createOutputFile creates or truncates a generated file with the configured file mode
+func createOutputFile(path string) (*os.File, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := chmodOutput(path, outputFileMode); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// writeOutputFile writes a generated file with the configured file mode
+func writeOutputFile(path string, data []byte) error {
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	return chmodOutput(path, outputFileMode)
+}
+
+// mkdirOutput creates a generated directory and its parents with the configured directory mode
+func mkdirOutput(path string) error {
+	mode := outputDirMode
+	if mode == 0 {
+		mode = 0755
+	}
+	if err := os.MkdirAll(path, mode); err != nil {
+		return err
+	}
+	return chmodOutput(path, outputDirMode)
+}
+
+// chmodOutput sets mode on path regardless of the umask and of the mode of an existing file
+// A zero mode leaves the permissions as they are
+func chmodOutput(path string, mode os.FileMode) error {
+	if mode == 0 {
+		return nil
+	}
+	return os.Chmod(path, mode)
+}
+
+// applyOutputModes sets the output modes from --file-mode and --dir-mode, falling back to spec.layout
+func applyOutputModes(site *config.Site, opts generateOptions) error {
+	fileMode, dirMode := site.Spec.Layout.FileMode, site.Spec.Layout.DirMode
+	if opts.fileMode != "" {
+		fileMode = opts.fileMode
+	}
+	if opts.dirMode != "" {
+		dirMode = opts.dirMode
+	}
+
+	var err error
+	if outputFileMode, err = config.ParseFileMode(fileMode); err != nil {
+		return newValidationError("invalid file mode: %v", err)
+	}
+	if outputDirMode, err = config.ParseFileMode(dirMode); err != nil {
+		return newValidationError("invalid directory mode: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateOutputModes(t *testing.T) {
+	tests := []struct {
+		name      string
+		layout    string
+		args      []string
+		wantFile  os.FileMode
+		wantDir   os.FileMode
+		wantError string
+	}{
+		{name: "flags", args: []string{"--file-mode", "0600", "--dir-mode", "0700"}, wantFile: 0600, wantDir: 0700},
+		{name: "site layout", layout: "    fileMode: \"0640\"\n    dirMode: \"0750\"\n", wantFile: 0640, wantDir: 0750},
+		{name: "flags over site layout", layout: "    fileMode: \"0640\"\n", args: []string{"--file-mode", "0600"}, wantFile: 0600},
+		{name: "invalid flag", args: []string{"--file-mode", "0999"}, wantError: "invalid file mode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := useTestStack(t, testStackApps)
+			commitTestStack(t, cacheDir)
+			siteYaml := testSiteYaml
+			if tt.layout != "" {
+				siteYaml = strings.Replace(siteYaml, "  apps:\n", "  layout:\n"+tt.layout+"  apps:\n", 1)
+			}
+			writeTestSite(t, siteYaml)
+			t.Cleanup(func() { outputFileMode, outputDirMode = 0, 0 })
+
+			_, err := runTestGenerate(t, tt.args...)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("generate: %v", err)
+			}
+
+			generatedDir := filepath.Join("clusters", "demo", "apps", "system", "apps", "pihole", "generated")
+			for path, want := range map[string]os.FileMode{
+				filepath.Join(generatedDir, "kustomization.yaml"): tt.wantFile,
+				generatedDir: tt.wantDir,
+			} {
+				// Without a configured mode the permissions depend on the umask
+				if want == 0 {
+					continue
+				}
+				info, err := os.Stat(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := info.Mode().Perm(); got != want {
+					t.Errorf("%s mode = %o, want %o", path, got, want)
+				}
+			}
+		})
+	}
+}
@@ -1,104 +1,431 @@
 package cli
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"text/template"
 
 	"github.com/bamaas/klabctl/internal/config"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
+// generateOptions holds the flags of the generate command
+type generateOptions struct {
+	// assumeRef overrides the stack ref from site.yaml for this run
+	assumeRef string
+	// manifestFormat selects the application output format (kustomize or helmfile)
+	manifestFormat string
+	// infraModuleSource selects the terraform module source (local or git)
+	infraModuleSource string
+	// failOnWarning makes the command fail when any warning was emitted
+	failOnWarning bool
+	// index writes a README.md inventory of the enabled apps to the cluster directory
+	index bool
+	// trace dumps the template data of each component to stderr
+	trace bool
+	// outFormats lists additional per-component outputs (json-patch)
+	outFormats []string
+	// printTfvars prints the rendered terraform.tfvars.json to stdout without writing any files
+	printTfvars bool
+	// verifyVersions fails when an app base doesn't render the version pinned in the catalog
+	verifyVersions bool
+	// traceDir, when set, writes the traced template data to <traceDir>/<component>.yaml instead of stderr
+	traceDir string
+	// renderCache restores unchanged component outputs from .klabctl/cache/render instead of re-rendering
+	renderCache bool
+	// validateYAML parses every generated .yaml file and fails on invalid YAML
+	validateYAML bool
+	// summaryOnly replaces the per-step output with a single summary line
+	summaryOnly bool
+	// enableHooks runs the stack's post-render hook for each generated component
+	enableHooks bool
+	// pruneEmptyDirs removes empty directories from the cluster apps tree after rendering
+	pruneEmptyDirs bool
+	// onlyApps restricts app generation to these apps, all enabled apps are generated when empty
+	onlyApps []string
+	// componentsOrder is the order components are generated in: alpha, dependency or a comma separated list
+	componentsOrder string
+	// warnUnusedValues warns about component values no stack template references
+	warnUnusedValues bool
+	// strictPaths checks all output paths for escapes and symlinks before anything is written
+	strictPaths bool
+	// fileMode and dirMode override the permissions of generated files and directories (octal, e.g. 0640)
+	fileMode string
+	dirMode  string
+	// terraformFmt formats the generated terraform with terraform fmt
+	terraformFmt bool
+	// checkFmt fails when the generated terraform isn't formatted, without changing it
+	checkFmt bool
+	// delims overrides spec.templating.delimiters
+	delims []string
+	// pruneReport lists the app directories not enabled in the catalog without rendering or removing anything
+	pruneReport bool
+	// sinceLastRender skips components whose inputs didn't change since the previous render
+	sinceLastRender bool
+	// resolveRef pins the stack ref to the commit of the cached stack in the generated output
+	resolveRef bool
+	// requireApps fails instead of warning when no app is enabled in the catalog
+	requireApps bool
+	// inputHashAnnotation stamps the hash of each component's render inputs as an annotation on its resources
+	inputHashAnnotation bool
+	// emitKustomizeLabels adds the klabctl default labels to the generated kustomizations
+	emitKustomizeLabels bool
+
+	// pinnedRef, when set, replaces stack.ref in the generated output (see --resolve-ref)
+	pinnedRef string
+	// inputHashes holds the render input hash of each component stamped as annotation
+	// (see --render-manifest-checksum-in-annotation), nil when the annotation is not emitted
+	inputHashes map[string]string
+	// stackRepo, when set, is a checkout of the stack repository whose stack/ directory is
+	// rendered instead of the cached ref (affected --render --stack-from worktree)
+	stackRepo string
+}
+
+// renderedStackRef returns the stack ref written to the generated output
+func renderedStackRef(site *config.Site, opts generateOptions) string {
+	if opts.pinnedRef != "" {
+		return opts.pinnedRef
+	}
+	return site.Spec.Stack.Ref
+}
+
 func newGenerateCmd() *cobra.Command {
 
+	var opts generateOptions
+
 	cmd := &cobra.Command{
 		Use:   "generate",
 		Short: "Generate cluster GitOps skeleton from site.yaml",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			site, err := config.LoadSiteFromFile(sitePath)
+			site, err := loadSite(sitePath)
 			if err != nil {
 				return err
 			}
+			setHistoryRef(cmd, site.Spec.Stack.Ref)
+
+			if opts.manifestFormat != "kustomize" && opts.manifestFormat != "helmfile" {
+				return fmt.Errorf("unsupported manifest format '%s' (supported: kustomize, helmfile)", opts.manifestFormat)
+			}
+
+			for _, format := range opts.outFormats {
+				if format != "json-patch" {
+					return fmt.Errorf("unsupported out format '%s' (supported: json-patch)", format)
+				}
+			}
+
+			if err := validateRenderFlags(opts); err != nil {
+				return err
+			}
+
+			// Components whose renderIf is false are treated as disabled from here on
+			if err := applyRenderIf(site); err != nil {
+				return err
+			}
+
+			// Only report the prune-eligible app directories, the stack isn't needed
+			if opts.pruneReport {
+				return printPruneReport(os.Stdout, site)
+			}
+
+			// A catalog without enabled apps renders nothing, usually a wrong site or all-disabled defaults
+			if !hasEnabledApps(site) {
+				if opts.requireApps {
+					return newValidationError("no apps are enabled in spec.apps.catalog and --require-apps is set (check the enabled: flags)")
+				}
+				warnf("no apps are enabled in spec.apps.catalog, check the enabled: flags")
+			}
+
+			// Override the stack ref for this run only, site.yaml is left untouched
+			if opts.assumeRef != "" && opts.assumeRef != site.Spec.Stack.Ref {
+				warnf("rendering from stack ref '%s' instead of '%s' recorded in site.yaml, the generated output will not match the recorded stack.ref", opts.assumeRef, site.Spec.Stack.Ref)
+				site.Spec.Stack.Ref = opts.assumeRef
+			}
 
 			// Ensure stack is available before rendering
 			if site.Spec.Stack.Source == "" || site.Spec.Stack.Ref == "" {
-				return fmt.Errorf("stack.source and stack.version are required in site.yaml")
+				return newValidationError("stack.source and stack.ref are required in site.yaml")
 			}
 
-			if err := EnsureStackAvailable(site.Spec.Stack.Source, site.Spec.Stack.Ref, false); err != nil {
+			if err := EnsureStackAvailable(site.Spec.Stack.Source, site.Spec.Stack.Ref, site.Spec.Stack.Subdir, false); err != nil {
 				return fmt.Errorf("failed to ensure stack is available: %w", err)
 			}
 
+			// Point the output at the commit of a moving ref, site.yaml stays on the ref
+			if opts.resolveRef {
+				commit, err := pinStackRef(site, &opts)
+				if err != nil {
+					return err
+				}
+				if !opts.summaryOnly {
+					statusf(os.Stdout, "✓ Pinned stack ref %s to commit %s\n", site.Spec.Stack.Ref, commit)
+				}
+			}
+
+			// Only preview the terraform variables
+			if opts.printTfvars {
+				return printTerraformVars(site, opts)
+			}
+
+			// Verify pinned versions before anything is written
+			if opts.verifyVersions {
+				if err := verifyComponentVersions(site, opts); err != nil {
+					return err
+				}
+			}
+
+			if len(opts.delims) > 0 {
+				if err := config.ValidateDelimiters(opts.delims); err != nil {
+					return &ValidationError{Err: err}
+				}
+				site.Spec.Templating.Delimiters = opts.delims
+			}
+
+			if opts.terraformFmt && opts.checkFmt {
+				return newValidationError("--terraform-fmt and --check-fmt cannot be combined")
+			}
+
+			if err := applyOutputModes(site, opts); err != nil {
+				return err
+			}
+
+			if opts.strictPaths {
+				if err := checkOutputPaths(site, opts); err != nil {
+					return err
+				}
+			}
+
+			// Per-step progress, replaced by a single summary line with --summary-only
+			progressf := func(format string, args ...interface{}) {
+				if !opts.summaryOnly {
+					statusf(os.Stdout, format, args...)
+				}
+			}
+
 			// Generate infrastructure if configured (check if provider is set)
-			if err := generateInfraManifests(site); err != nil {
+			if err := generateInfraManifests(site, opts); err != nil {
 				return fmt.Errorf("failed to generate infrastructure manifests: %w", err)
 			}
-			fmt.Printf("✓ Generated infrastructure configuration\n")
+			progressf("✓ Generated infrastructure configuration\n")
 
 			// Generate applications
-			renderedCount, err := generateAppManifests(site)
-			if err != nil {
-				return fmt.Errorf("generate apps: %w", err)
+			var renderedCount int
+			switch opts.manifestFormat {
+			case "kustomize":
+				renderedCount, err = generateAppManifests(site, opts)
+				if err != nil {
+					return fmt.Errorf("generate apps: %w", err)
+				}
+				progressf("✓ Generated %d application components\n", renderedCount)
+
+				if opts.pruneEmptyDirs {
+					removed, err := pruneEmptyDirs(filepath.Join("clusters", site.Metadata.Name, "apps"))
+					if err != nil {
+						return fmt.Errorf("prune empty directories: %w", err)
+					}
+					progressf("✓ Pruned %d empty directories\n", removed)
+				}
+
+				if opts.validateYAML {
+					if err := validateGeneratedYAML(site); err != nil {
+						return err
+					}
+					progressf("✓ Validated generated YAML\n")
+				}
+			case "helmfile":
+				renderedCount, err = generateHelmfile(site, opts)
+				if err != nil {
+					return fmt.Errorf("generate helmfile: %w", err)
+				}
+				progressf("✓ Generated helmfile with %d releases\n", renderedCount)
+			}
+
+			if opts.index {
+				if err := generateClusterIndex(site, opts); err != nil {
+					return fmt.Errorf("generate index: %w", err)
+				}
+				progressf("✓ Generated cluster index\n")
+			}
+
+			if err := checkWarnings(opts.failOnWarning); err != nil {
+				return err
+			}
+
+			if opts.summaryOnly {
+				fmt.Printf("cluster=%s ref=%s format=%s rendered=%d warnings=%d\n", site.Metadata.Name, site.Spec.Stack.Ref, opts.manifestFormat, renderedCount, warningCount)
 			}
-			fmt.Printf("✓ Generated %d application components\n", renderedCount)
 
 			return nil
 		},
 	}
 
+	cmd.Flags().StringVar(&opts.assumeRef, "assume-ref", "", "Render from this stack ref (branch, tag, or commit) instead of stack.ref, without modifying site.yaml")
+	cmd.Flags().StringVar(&opts.manifestFormat, "manifest-format", "kustomize", "Output format for applications: kustomize or helmfile")
+	cmd.Flags().BoolVar(&opts.trace, "trace", false, "Dump the template data passed to each component's templates to stderr")
+	cmd.Flags().StringVar(&opts.traceDir, "trace-dir", "", "Write the traced template data to <dir>/<component>.yaml (implies --trace)")
+	cmd.Flags().StringSliceVar(&opts.outFormats, "out-format", nil, "Additional per-component outputs: json-patch (values.patch.json with the changes relative to the stack default values)")
+	cmd.Flags().BoolVar(&opts.printTfvars, "print-tfvars", false, "Print the terraform.tfvars.json that would be generated and exit without writing files")
+	cmd.Flags().BoolVar(&opts.verifyVersions, "verify-versions", false, "Fail if an app base's chart version differs from the version pinned in the catalog")
+	cmd.Flags().BoolVar(&opts.failOnWarning, "fail-on-warning", false, "Exit with an error if any warning was emitted (warnings are still printed as warnings)")
+	cmd.Flags().BoolVar(&opts.index, "index", false, "Write a README.md to the cluster directory listing the enabled apps")
+	cmd.Flags().BoolVar(&opts.validateYAML, "validate-yaml", false, "Parse every generated .yaml file and fail with the component and file name on invalid YAML")
+	cmd.Flags().BoolVar(&opts.summaryOnly, "summary-only", false, "Print a single key=value summary line to stdout instead of per-step messages")
+	cmd.Flags().BoolVar(&opts.enableHooks, "enable-hooks", false, "Run the stack's hooks/post-render executable for each generated component (hooks run code from the stack repository)")
+	cmd.Flags().BoolVar(&opts.pruneEmptyDirs, "prune-empty-dirs", false, "Remove empty directories from the cluster apps tree after rendering (keep a directory with a .gitkeep)")
+	addRenderFlags(cmd, &opts)
+	cmd.Flags().BoolVar(&opts.warnUnusedValues, "warn-on-unused-values", false, "Warn about component values that no stack template references")
+	cmd.Flags().StringVar(&opts.componentsOrder, "components-order", componentsOrderAlpha, "Order components are generated in: alpha, dependency (after their dependsOn) or a comma separated list of components rendered first")
+	cmd.Flags().BoolVar(&opts.renderCache, "render-cache", false, "Restore component outputs from .klabctl/cache/render when the stack templates and site values are unchanged")
+	cmd.Flags().BoolVar(&opts.strictPaths, "strict-paths", false, "Abort before writing anything when an output path would leave clusters/<name> or pass through a symlink")
+	cmd.Flags().StringVar(&opts.fileMode, "file-mode", "", "Octal permissions of generated files, e.g. 0640 (default: spec.layout.fileMode, else 0644 before umask)")
+	cmd.Flags().StringVar(&opts.dirMode, "dir-mode", "", "Octal permissions of generated directories, e.g. 0750 (default: spec.layout.dirMode, else 0755 before umask)")
+	cmd.Flags().BoolVar(&opts.terraformFmt, "terraform-fmt", false, "Run terraform fmt on the generated terraform (skipped when terraform is not installed)")
+	cmd.Flags().BoolVar(&opts.checkFmt, "check-fmt", false, "Fail when the generated terraform is not formatted according to terraform fmt, without changing it")
+	cmd.Flags().StringSliceVar(&opts.delims, "delims", nil, "Left and right template delimiters of the stack, e.g. '[[,]]' (default: spec.templating.delimiters, else {{ and }})")
+	cmd.Flags().BoolVar(&opts.pruneReport, "prune-report", false, "List the app directories on disk that are not enabled in the catalog, with their size, and exit without rendering or removing anything")
+	cmd.Flags().BoolVar(&opts.sinceLastRender, "since-last-render", false, "Only re-render components whose stack commit, site (including the values of every app) or stack templates changed since the previous render")
+	cmd.Flags().BoolVar(&opts.requireApps, "require-apps", false, "Fail instead of warning when no app is enabled in spec.apps.catalog")
+
 	return cmd
 }
 
+// addRenderFlags registers the flags that change the rendered output, shared by generate and verify
+// so verify renders the cluster the way generate did
+func addRenderFlags(cmd *cobra.Command, opts *generateOptions) {
+	cmd.Flags().BoolVar(&opts.emitKustomizeLabels, "emit-kustomize-labels", false, "Label all generated resources with managed-by, cluster, app and stack ref (extend or override with spec.apps.commonLabels)")
+	cmd.Flags().StringVar(&opts.infraModuleSource, "infra-module-source", "local", "Terraform module source: local (copies infra/base next to the generated root) or git (pinned to stack.source and stack.ref, reproducible)")
+	cmd.Flags().BoolVar(&opts.resolveRef, "resolve-ref", false, "Write the commit SHA of the stack ref instead of the ref to the generated output (git module source, .Site.Spec.Stack.Ref in templates)")
+	cmd.Flags().BoolVar(&opts.inputHashAnnotation, "render-manifest-checksum-in-annotation", false, "Annotate the resources of each component with "+inputHashAnnotationKey+", a hash of the whole site (including the values of every app), the stack commit and every stack template")
+}
+
+// validateRenderFlags checks the values of the flags registered by addRenderFlags
+func validateRenderFlags(opts generateOptions) error {
+	if opts.infraModuleSource != "local" && opts.infraModuleSource != "git" {
+		return fmt.Errorf("unsupported infra module source '%s' (supported: local, git)", opts.infraModuleSource)
+	}
+	return nil
+}
+
+// pinStackRef points the output at the commit of the cached stack ref (see --resolve-ref) and returns the commit
+func pinStackRef(site *config.Site, opts *generateOptions) (string, error) {
+	commit, err := resolveCachedCommit(getStackRepoDir(site, *opts))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve stack ref '%s': %w", site.Spec.Stack.Ref, err)
+	}
+	opts.pinnedRef = commit
+	return commit, nil
+}
+
 // generateInfraManifests generates all infrastructure manifests from site configuration
-func generateInfraManifests(site *config.Site) error {
+func generateInfraManifests(site *config.Site, opts generateOptions) error {
 
 	// Fail fast, check if infrastructure provider is not configured
 	if site.Spec.Infra.Provider == "" {
-		return fmt.Errorf("no infrastructure provider configured in site.yaml")
+		return newValidationError("no infrastructure provider configured in site.yaml")
 	}
 
-	// Copy infra base from cache
-	if err := copyInfraBase(site); err != nil {
-		return fmt.Errorf("failed to copy infra base: %w", err)
+	// The local module source needs the infra base copied next to the generated root
+	if opts.infraModuleSource == "local" {
+		if err := copyInfraBase(site, opts); err != nil {
+			return fmt.Errorf("failed to copy infra base: %w", err)
+		}
+	}
+
+	moduleSource, err := resolveInfraModuleSource(site, opts)
+	if err != nil {
+		return fmt.Errorf("resolve module source: %w", err)
 	}
 
 	terraformDir := filepath.Join("clusters", site.Metadata.Name, "infra", "generated")
-	if err := os.MkdirAll(terraformDir, 0755); err != nil {
+	if err := mkdirOutput(terraformDir); err != nil {
 		return fmt.Errorf("create terraform dir: %w", err)
 	}
 
-	if err := generateTerraformRoot(terraformDir, site); err != nil {
+	if err := generateTerraformRoot(terraformDir, site, opts, moduleSource); err != nil {
 		return fmt.Errorf("generate terraform root: %w", err)
 	}
 
+	if opts.terraformFmt || opts.checkFmt {
+		if err := formatTerraform(terraformDir, opts.checkFmt); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 // generateApps generates all application components from site configuration
-func generateAppManifests(site *config.Site) (int, error) {
+func generateAppManifests(site *config.Site, opts generateOptions) (int, error) {
 	// Define path to components directory
 	appsPath := filepath.Join("clusters", site.Metadata.Name, "apps")
 
 	renderedCount := 0
 
 	// Create components directory if it doesn't exist
-	if err := os.MkdirAll(appsPath, 0755); err != nil {
+	if err := mkdirOutput(appsPath); err != nil {
 		return renderedCount, fmt.Errorf("failed to create apps directory: %w", err)
 	}
 
+	// Disabled components are skipped
+	componentNames, err := orderComponents(site, opts.componentsOrder)
+	if err != nil {
+		return renderedCount, err
+	}
+
+	// Components whose inputs match the previous render are left untouched
+	var snapshot *lastRender
+	var stackCommit string
+	var unchangedCount int
+	if opts.sinceLastRender {
+		if snapshot, err = loadLastRender(site); err != nil {
+			return renderedCount, fmt.Errorf("failed to load last render: %w", err)
+		}
+	}
+	if opts.sinceLastRender || opts.inputHashAnnotation {
+		if stackCommit, err = resolveCachedCommit(getStackRepoDir(site, opts)); err != nil {
+			return renderedCount, fmt.Errorf("failed to resolve stack commit: %w", err)
+		}
+	}
+	if opts.inputHashAnnotation {
+		opts.inputHashes = make(map[string]string)
+	}
+
 	// Render all templates for each component
 	copiedCount := 0
-	for componentName, component := range site.Spec.Apps.Catalog {
-		if !component.Enabled {
-			continue // Skip disabled components
+	for _, componentName := range componentNames {
+		component := site.Spec.Apps.Catalog[componentName]
+		if len(opts.onlyApps) > 0 && !containsString(opts.onlyApps, componentName) {
+			continue
+		}
+
+		if snapshot != nil || opts.inputHashAnnotation {
+			inputKey, err := componentInputKey(site, opts, stackCommit, componentName)
+			if err != nil {
+				return renderedCount, err
+			}
+			if opts.inputHashAnnotation {
+				opts.inputHashes[componentName] = inputKey
+			}
+			if snapshot != nil {
+				generatedPath := filepath.Join(appsPath, component.Project, component.Namespace, componentName, site.Spec.Layout.GeneratedDir)
+				if _, statErr := os.Stat(generatedPath); statErr == nil && snapshot.Components[componentName] == inputKey {
+					unchangedCount++
+					continue
+				}
+				snapshot.Components[componentName] = inputKey
+			}
 		}
 
 		// Copy app base from cache to cluster directory
 		// fmt.Printf("Copying base for %s...\n", componentName)
-		if err := copyAppBase(site, componentName); err != nil {
+		if err := copyAppBase(site, opts, componentName); err != nil {
 			return renderedCount, fmt.Errorf("failed to copy base for %s: %w", componentName, err)
 		}
 		copiedCount++
@@ -107,37 +434,53 @@ func generateAppManifests(site *config.Site) (int, error) {
 		project := site.Spec.Apps.Catalog[componentName].Project
 		namespace := site.Spec.Apps.Catalog[componentName].Namespace
 		if project == "" {
-			return renderedCount, fmt.Errorf("project is required for app %s", componentName)
+			return renderedCount, newValidationError("project is required for app %s (set it on the app or in spec.apps.defaults)", componentName)
 		}
 		if namespace == "" {
-			return renderedCount, fmt.Errorf("namespace is required for app %s", componentName)
+			return renderedCount, newValidationError("namespace is required for app %s (set it on the app or in spec.apps.defaults)", componentName)
+		}
+		if err := checkBaseNamespace(site, opts, componentName, namespace); err != nil {
+			return renderedCount, fmt.Errorf("failed to check base namespace of %s: %w", componentName, err)
 		}
 		componentPath := filepath.Join(appsPath, project, namespace, componentName)
-		generatedPath := filepath.Join(componentPath, "generated")
-		customPath := filepath.Join(componentPath, "custom")
+		generatedPath := filepath.Join(componentPath, site.Spec.Layout.GeneratedDir)
+		customPath := filepath.Join(componentPath, site.Spec.Layout.CustomDir)
 
-		if err := os.MkdirAll(generatedPath, 0755); err != nil {
+		if err := mkdirOutput(generatedPath); err != nil {
 			return renderedCount, fmt.Errorf("failed to create generated directory for %s: %w", componentName, err)
 		}
 
 		// Create root kustomization.yaml (only if it doesn't exist)
+		// An existing root only gets the directories of custom/components/ it doesn't list yet
 		rootKustomizationPath := filepath.Join(componentPath, "kustomization.yaml")
+		components, hasComponentsDir, err := findCustomComponents(customPath)
+		if err != nil {
+			return renderedCount, fmt.Errorf("failed to find custom components for %s: %w", componentName, err)
+		}
 		if _, err := os.Stat(rootKustomizationPath); os.IsNotExist(err) {
-			if err := createRootKustomization(site, componentName, rootKustomizationPath); err != nil {
+			if err := createRootKustomization(site, opts, componentName, components, rootKustomizationPath); err != nil {
 				return renderedCount, fmt.Errorf("failed to create root kustomization for %s: %w", componentName, err)
 			}
 			renderedCount++
+		} else if hasComponentsDir {
+			added, err := addRootKustomizationComponents(rootKustomizationPath, components)
+			if err != nil {
+				return renderedCount, fmt.Errorf("failed to add custom components to the root kustomization of %s: %w", componentName, err)
+			}
+			if added {
+				renderedCount++
+			}
 		}
 
 		// create custom/ directory if it doesn't exist
-		if err := os.MkdirAll(customPath, 0755); err != nil {
+		if err := mkdirOutput(customPath); err != nil {
 			return renderedCount, fmt.Errorf("failed to create custom directory for %s: %w", componentName, err)
 		}
 
 		// create custom/values.yaml if it doesn't exist
 		customValuesPath := filepath.Join(customPath, "values.yaml")
 		if _, err := os.Stat(customValuesPath); os.IsNotExist(err) {
-			if err := createCustomValuesTemplate(site, customValuesPath); err != nil {
+			if err := createCustomValuesTemplate(site, opts, customValuesPath); err != nil {
 				return renderedCount, fmt.Errorf("failed to create custom values template for %s: %w", componentName, err)
 			}
 		}
@@ -145,48 +488,153 @@ func generateAppManifests(site *config.Site) (int, error) {
 		// Create custom kustomization.yaml if it doesn't exist
 		customKustomizationPath := filepath.Join(customPath, "kustomization.yaml")
 		if _, err := os.Stat(customKustomizationPath); os.IsNotExist(err) {
-			if err := createCustomKustomizationTemplate(site, customKustomizationPath); err != nil {
+			if err := createCustomKustomizationTemplate(site, opts, customKustomizationPath); err != nil {
 				return renderedCount, fmt.Errorf("failed to create custom kustomization template for %s: %w", componentName, err)
 			}
 		}
 
+		// Dump the data the templates are executed with
+		if opts.trace || opts.traceDir != "" {
+			if err := traceTemplateData(site, opts, componentName, &component); err != nil {
+				return renderedCount, fmt.Errorf("failed to trace template data for %s: %w", componentName, err)
+			}
+		}
+
+		// Document the customizations relative to the stack defaults
+		if containsString(opts.outFormats, "json-patch") {
+			if err := writeValuesPatch(site, opts, componentName, &component, generatedPath); err != nil {
+				return renderedCount, fmt.Errorf("failed to write values patch for %s: %w", componentName, err)
+			}
+		}
+
+		// Render values marked as secretRef as ExternalSecrets
+		if err := writeExternalSecrets(site, componentName, &component, generatedPath); err != nil {
+			return renderedCount, fmt.Errorf("failed to write external secrets for %s: %w", componentName, err)
+		}
+
 		// Find all templates for this component
-		componentTemplates, err := FindAppTemplates(site, componentName)
+		componentTemplates, err := FindAppTemplates(site, opts, componentName)
 		if err != nil {
 			return renderedCount, fmt.Errorf("failed to find templates for component %s: %w", componentName, err)
 		}
 
-		// Render generated/kustomization.yaml
-		generatedKustomizationPath := filepath.Join(generatedPath, "kustomization.yaml")
+		count, err := renderComponentOutputs(site, componentName, &component, componentTemplates, generatedPath, opts)
+		renderedCount += count
+		if err != nil {
+			return renderedCount, err
+		}
 
-		// If no app specific templates found, use base template
-		if len(componentTemplates) == 0 {
-			templateName := "base.kustomization.yaml.tmpl"
-			if err := RenderKustomizationTemplate(site, componentName, &component, templateName, generatedKustomizationPath); err != nil {
-				return renderedCount, fmt.Errorf("failed to render base template for component %s: %w", componentName, err)
-			}
-			renderedCount++
-			continue
+		// Post-process the generated outputs with the stack's post-render hook
+		if err := runPostRenderHook(site, opts, componentName, generatedPath); err != nil {
+			return renderedCount, fmt.Errorf("post-render hook failed for %s: %w", componentName, err)
 		}
+	}
 
-		// Render all app specific templates into generated/ directory
-		for _, templateName := range componentTemplates {
-			// Convert template name to output filename
-			// e.g., "apps/pihole/kustomization.yaml.tmpl" -> "kustomization.yaml"
-			baseName := filepath.Base(templateName)
-			outputFileName := strings.TrimSuffix(baseName, ".tmpl")
-			outputPath := filepath.Join(generatedPath, outputFileName)
+	if opts.warnUnusedValues {
+		if err := warnUnusedValues(site, opts, componentNames); err != nil {
+			return renderedCount, fmt.Errorf("check unused values: %w", err)
+		}
+	}
 
-			if err := RenderTemplate(site, componentName, &component, templateName, outputPath); err != nil {
-				return renderedCount, fmt.Errorf("failed to render template %s for component %s: %w", templateName, componentName, err)
+	// A single entrypoint for building all apps of the cluster
+	if err := writeAppsRootKustomization(site); err != nil {
+		return renderedCount, err
+	}
+
+	if snapshot != nil {
+		for name := range snapshot.Components {
+			if !site.Spec.Apps.Catalog[name].Enabled {
+				delete(snapshot.Components, name)
 			}
-			renderedCount++
+		}
+		if err := saveLastRender(site, snapshot); err != nil {
+			return renderedCount, fmt.Errorf("failed to save last render: %w", err)
+		}
+		if !opts.summaryOnly {
+			statusf(os.Stdout, "✓ %d unchanged, %d re-rendered since the last render\n", unchangedCount, copiedCount)
 		}
 	}
 	return renderedCount, nil
 	
 }
 
+// renderComponentOutputs renders the templates of a component into its generated directory
+// Returns the number of rendered (or restored) files
+func renderComponentOutputs(site *config.Site, componentName string, component *config.Component, componentTemplates []string, generatedPath string, opts generateOptions) (int, error) {
+	count := 0
+
+	// Apps without specific templates are wrapped according to their base type
+	fallbackTemplate := "base.kustomization.yaml.tmpl"
+	if len(componentTemplates) == 0 {
+		base, err := detectAppBase(site, opts, componentName)
+		if err != nil {
+			return count, err
+		}
+		if base.RawChart {
+			fallbackTemplate = "helm.kustomization.yaml.tmpl"
+		}
+	}
+
+	// Restore the outputs of an unchanged component from the render cache
+	var cacheKey string
+	if opts.renderCache {
+		var err error
+		cacheTemplates := append([]string{fallbackTemplate}, componentTemplates...)
+		cacheKey, err = renderCacheKey(site, opts, componentName, cacheTemplates)
+		if err != nil {
+			return count, fmt.Errorf("failed to compute render cache key for %s: %w", componentName, err)
+		}
+		restored, err := restoreRenderCache(cacheKey, generatedPath)
+		if err != nil {
+			return count, err
+		}
+		if restored > 0 {
+			return restored, nil
+		}
+	}
+
+	// Render generated/kustomization.yaml
+	generatedKustomizationPath := filepath.Join(generatedPath, "kustomization.yaml")
+
+	// If no app specific templates found, use the base (or helm chart) template
+	if len(componentTemplates) == 0 {
+		if err := RenderKustomizationTemplate(site, opts, componentName, component, fallbackTemplate, generatedKustomizationPath); err != nil {
+			return count, fmt.Errorf("failed to render %s for component %s: %w", fallbackTemplate, componentName, err)
+		}
+		count++
+		if opts.renderCache {
+			if err := storeRenderCache(cacheKey, generatedPath, []string{"kustomization.yaml"}); err != nil {
+				return count, fmt.Errorf("failed to store render cache for %s: %w", componentName, err)
+			}
+		}
+		return count, nil
+	}
+
+	// Render all app specific templates into generated/ directory
+	var outputFileNames []string
+	for _, templateName := range componentTemplates {
+		// Convert template name to output filename
+		// e.g., "apps/pihole/kustomization.yaml.tmpl" -> "kustomization.yaml"
+		baseName := filepath.Base(templateName)
+		outputFileName := strings.TrimSuffix(baseName, ".tmpl")
+		outputPath := filepath.Join(generatedPath, outputFileName)
+
+		if err := RenderTemplate(site, opts, componentName, component, templateName, outputPath); err != nil {
+			return count, fmt.Errorf("failed to render template %s for component %s: %w", templateName, componentName, err)
+		}
+		outputFileNames = append(outputFileNames, outputFileName)
+		count++
+	}
+
+	if opts.renderCache {
+		if err := storeRenderCache(cacheKey, generatedPath, outputFileNames); err != nil {
+			return count, fmt.Errorf("failed to store render cache for %s: %w", componentName, err)
+		}
+	}
+
+	return count, nil
+}
+
 // TemplateData holds the data used for templating
 type TemplateData struct {
 	Site          *config.Site
@@ -194,52 +642,216 @@ type TemplateData struct {
 	Component     *config.Component
 	ComponentName string
 	AllComponents map[string]config.Component
+	// GeneratedResources lists the files klabctl writes to the generated directory next to the rendered templates
+	GeneratedResources []string
+	// Labels are added to all resources of the component by the generated kustomization
+	Labels map[string]string
+	// Annotations are added to all resources of the component by the generated kustomization
+	Annotations map[string]string
+	// Environment is spec.environment of the site, empty when not set
+	Environment string
+}
+
+// newTemplateData builds the data a component's templates are executed with
+// Values marked as secretRef are blanked in the component and the whole catalog
+func newTemplateData(site *config.Site, opts generateOptions, componentName string, component *config.Component) TemplateData {
+	catalog := make(map[string]config.Component, len(site.Spec.Apps.Catalog))
+	for name, c := range site.Spec.Apps.Catalog {
+		c.Values = stripSecretRefs(c.Values)
+		catalog[name] = c
+	}
+	templateSite := *site
+	templateSite.Spec.Apps.Catalog = catalog
+	templateSite.Spec.Stack.Ref = renderedStackRef(site, opts)
+
+	templateComponent := *component
+	templateComponent.Values = stripSecretRefs(component.Values)
+
+	data := TemplateData{
+		Site:          &templateSite,
+		Component:     &templateComponent,
+		ComponentName: componentName,
+		AllComponents: catalog,
+		Labels:        componentLabels(site, opts, componentName),
+		Annotations:   componentAnnotations(opts, componentName),
+		Environment:   site.Spec.Environment,
+	}
+
+	if refs, err := findSecretRefs(componentName, component.Values); err == nil && len(refs) > 0 {
+		data.GeneratedResources = append(data.GeneratedResources, externalSecretsFileName)
+	}
+
+	return data
+}
+
+// reservedTemplateNames are the templates component templates inherit from and may not redefine
+var reservedTemplateNames = []string{"header", "kustomization-header", "base"}
+
+// checkReservedTemplateNames rejects a component template that defines one of the reserved templates,
+// which would silently replace the header/base inheritance chain for that component
+func checkReservedTemplateNames(site *config.Site, templateName string, content []byte) error {
+	tmpl, err := newStackTemplate(site, templateName).Parse(string(content))
+	if err != nil {
+		return fmt.Errorf("failed to parse template %s: %w", templateName, err)
+	}
+
+	return checkReservedTemplates(tmpl)
+}
+
+// checkReservedTemplates rejects a parsed component template that defines one of the reserved templates
+func checkReservedTemplates(tmpl *template.Template) error {
+	for _, defined := range tmpl.Templates() {
+		if defined.Name() != tmpl.Name() && containsString(reservedTemplateNames, defined.Name()) {
+			return fmt.Errorf("template %s redefines the reserved template %q, use the \"additional-resources\" block to extend base", tmpl.Name(), defined.Name())
+		}
+	}
+
+	return nil
+}
+
+// templateFunc is a custom function available to stack templates next to the text/template builtins
+type templateFunc struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Func        interface{} `json:"-"`
+}
+
+// templateFuncs are the custom functions registered for all stack templates, listed by 'klabctl template-funcs'
+var templateFuncs = []templateFunc{
+	{
+		Name:        "quote",
+		Description: "Wrap a string in double quotes",
+		Func: func(s string) string {
+			return fmt.Sprintf(`"%s"`, s)
+		},
+	},
+	{
+		Name:        "toJson",
+		Description: "Encode a value as JSON (also valid YAML), e.g. for lists and maps",
+		Func: func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	},
+}
+
+// newStackTemplate returns a template with the custom functions and the delimiters of spec.templating
+func newStackTemplate(site *config.Site, name string) *template.Template {
+	return template.New(name).Delims(site.Spec.Templating.Delims()).Funcs(templateFuncMap())
+}
+
+// templateFuncMap returns the custom functions available to stack templates
+func templateFuncMap() template.FuncMap {
+	funcMap := make(template.FuncMap, len(templateFuncs))
+	for _, f := range templateFuncs {
+		funcMap[f.Name] = f.Func
+	}
+	return funcMap
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// traceTemplateData writes the template data of a component as YAML to stderr, or to <opts.traceDir>/<component>.yaml
+func traceTemplateData(site *config.Site, opts generateOptions, componentName string, component *config.Component) error {
+	data := newTemplateData(site, opts, componentName, component)
+
+	content, err := yaml.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal template data: %w", err)
+	}
+
+	if opts.traceDir == "" {
+		fmt.Fprintf(os.Stderr, "--- # trace: %s\n%s", componentName, content)
+		return nil
+	}
+
+	if err := os.MkdirAll(opts.traceDir, 0755); err != nil {
+		return fmt.Errorf("failed to create trace directory: %w", err)
+	}
+
+	return os.WriteFile(filepath.Join(opts.traceDir, componentName+".yaml"), content, 0644)
 }
 
 // readTemplateFromCache reads a template file from the cache
-func readTemplateFromCache(site *config.Site, templatePath string) ([]byte, error) {
+func readTemplateFromCache(site *config.Site, opts generateOptions, templatePath string) ([]byte, error) {
 	// Check if it's an app-specific template (apps/{appName}/templates/{file})
 	if strings.HasPrefix(templatePath, "apps/") {
-		fullPath := filepath.Join(getStackCacheDir(site), "stack", templatePath)
-		return os.ReadFile(fullPath)
+		fullPath := filepath.Join(getStackRoot(site, opts), templatePath)
+		return readTemplateFile(fullPath)
 	}
 
 	// Otherwise it's a general template (templates/{file})
-	fullPath := filepath.Join(getStackTemplatesDir(site), templatePath)
-	return os.ReadFile(fullPath)
+	fullPath := filepath.Join(getStackTemplatesDir(site, opts), templatePath)
+	return readTemplateFile(fullPath)
 }
 
-// RenderComponentKustomizationTemplate renders the kustomization.yaml.tmpl template for a specific component from cache
-func RenderKustomizationTemplate(site *config.Site, componentName string, component *config.Component, templateName, outputPath string) error {
+// readTemplateFile reads a template file, refusing files larger than --max-template-size
+func readTemplateFile(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("template %s is not a regular file", path)
+	}
+	if maxTemplateSize > 0 && info.Size() > maxTemplateSize {
+		return nil, fmt.Errorf("template %s is %d bytes, exceeds the maximum template size of %d bytes", path, info.Size(), maxTemplateSize)
+	}
 
-	// Create template with custom functions
-	funcMap := template.FuncMap{
-		"quote": func(s string) string {
-			return fmt.Sprintf(`"%s"`, s)
-		},
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
 	}
+	defer file.Close()
+
+	// Guard against a file growing after the size check
+	reader := io.Reader(file)
+	if maxTemplateSize > 0 {
+		reader = io.LimitReader(file, maxTemplateSize+1)
+	}
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if maxTemplateSize > 0 && int64(len(content)) > maxTemplateSize {
+		return nil, fmt.Errorf("template %s exceeds the maximum template size of %d bytes", path, maxTemplateSize)
+	}
+
+	return content, nil
+}
+
+// RenderComponentKustomizationTemplate renders the kustomization.yaml.tmpl template for a specific component from cache
+func RenderKustomizationTemplate(site *config.Site, opts generateOptions, componentName string, component *config.Component, templateName, outputPath string) error {
 
 	// Read header template first
-	headerContent, err := readTemplateFromCache(site, "header.kustomization.yaml.tmpl")
+	headerContent, err := readTemplateFromCache(site, opts, "header.kustomization.yaml.tmpl")
 	if err != nil {
 		return fmt.Errorf("failed to read header template: %w", err)
 	}
 
 	// Read base template
 	baseTemplatePath := "base.kustomization.yaml.tmpl"
-	baseContent, err := readTemplateFromCache(site, baseTemplatePath)
+	baseContent, err := readTemplateFromCache(site, opts, baseTemplatePath)
 	if err != nil {
 		return fmt.Errorf("failed to read base template %s: %w", baseTemplatePath, err)
 	}
 
 	// Read component-specific template
-	templateContent, err := readTemplateFromCache(site, templateName)
+	templateContent, err := readTemplateFromCache(site, opts, templateName)
 	if err != nil {
 		return fmt.Errorf("failed to read template %s: %w", templateName, err)
 	}
 
 	// Parse all templates together (header, base, and component-specific)
-	tmpl, err := template.New("header").Funcs(funcMap).Parse(string(headerContent))
+	tmpl, err := newStackTemplate(site, "header").Parse(string(headerContent))
 	if err != nil {
 		return fmt.Errorf("failed to parse header template: %w", err)
 	}
@@ -251,20 +863,18 @@ func RenderKustomizationTemplate(site *config.Site, componentName string, compon
 
 	// If using a component-specific template, parse it too
 	if templateName != baseTemplatePath {
+		if err := checkReservedTemplateNames(site, templateName, templateContent); err != nil {
+			return err
+		}
 		tmpl, err = tmpl.New(templateName).Parse(string(templateContent))
 		if err != nil {
 			return fmt.Errorf("failed to parse template %s: %w", templateName, err)
 		}
 	}
 
-	data := TemplateData{
-		Site:          site,
-		Component:     component,
-		ComponentName: componentName,
-		AllComponents: site.Spec.Apps.Catalog,
-	}
+	data := newTemplateData(site, opts, componentName, component)
 
-	outputFile, err := os.Create(outputPath)
+	outputFile, err := createOutputFile(outputPath)
 	if err != nil {
 		return fmt.Errorf("failed to create output file %s: %w", outputPath, err)
 	}
@@ -290,35 +900,28 @@ func RenderKustomizationTemplate(site *config.Site, componentName string, compon
 }
 
 // RenderTemplate renders any template to a file using cache templates
-func RenderTemplate(site *config.Site, componentName string, component *config.Component, templateName, outputPath string) error {
-	// Create template with custom functions
-	funcMap := template.FuncMap{
-		"quote": func(s string) string {
-			return fmt.Sprintf(`"%s"`, s)
-		},
-	}
-
+func RenderTemplate(site *config.Site, opts generateOptions, componentName string, component *config.Component, templateName, outputPath string) error {
 	// Read header template first
-	headerContent, err := readTemplateFromCache(site, "header.kustomization.yaml.tmpl")
+	headerContent, err := readTemplateFromCache(site, opts, "header.kustomization.yaml.tmpl")
 	if err != nil {
 		return fmt.Errorf("failed to read header template: %w", err)
 	}
 
 	// Read base template (for inheritance)
 	baseTemplatePath := "base.kustomization.yaml.tmpl"
-	baseContent, err := readTemplateFromCache(site, baseTemplatePath)
+	baseContent, err := readTemplateFromCache(site, opts, baseTemplatePath)
 	if err != nil {
 		return fmt.Errorf("failed to read base template %s: %w", baseTemplatePath, err)
 	}
 
 	// Read component-specific template
-	templateContent, err := readTemplateFromCache(site, templateName)
+	templateContent, err := readTemplateFromCache(site, opts, templateName)
 	if err != nil {
 		return fmt.Errorf("failed to read template %s: %w", templateName, err)
 	}
 
 	// Parse all templates together (header, base, and component-specific)
-	tmpl, err := template.New("header").Funcs(funcMap).Parse(string(headerContent))
+	tmpl, err := newStackTemplate(site, "header").Parse(string(headerContent))
 	if err != nil {
 		return fmt.Errorf("failed to parse header template: %w", err)
 	}
@@ -330,20 +933,18 @@ func RenderTemplate(site *config.Site, componentName string, component *config.C
 
 	// If using a component-specific template, parse it too
 	if templateName != baseTemplatePath {
+		if err := checkReservedTemplateNames(site, templateName, templateContent); err != nil {
+			return err
+		}
 		tmpl, err = tmpl.New(templateName).Parse(string(templateContent))
 		if err != nil {
 			return fmt.Errorf("failed to parse template %s: %w", templateName, err)
 		}
 	}
 
-	data := TemplateData{
-		Site:          site,
-		Component:     component,
-		ComponentName: componentName,
-		AllComponents: site.Spec.Apps.Catalog,
-	}
+	data := newTemplateData(site, opts, componentName, component)
 
-	outputFile, err := os.Create(outputPath)
+	outputFile, err := createOutputFile(outputPath)
 	if err != nil {
 		return fmt.Errorf("failed to create output file %s: %w", outputPath, err)
 	}
@@ -368,22 +969,44 @@ func RenderTemplate(site *config.Site, componentName string, component *config.C
 	return nil
 }
 
+// findCustomComponents returns the kustomize component directories in custom/components/,
+// relative to the component root. Also reports whether the custom/components/ directory exists.
+func findCustomComponents(customPath string) ([]string, bool, error) {
+	componentsPath := filepath.Join(customPath, "components")
+	entries, err := os.ReadDir(componentsPath)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var components []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			components = append(components, filepath.ToSlash(filepath.Join(filepath.Base(customPath), "components", entry.Name())))
+		}
+	}
+
+	return components, true, nil
+}
+
 // createRootKustomization creates the root kustomization.yaml that references generated + custom
-func createRootKustomization(site *config.Site, componentName, outputPath string) error {
+func createRootKustomization(site *config.Site, opts generateOptions, componentName string, components []string, outputPath string) error {
 	// Read header template first
-	headerContent, err := readTemplateFromCache(site, "header.kustomization.yaml.tmpl")
+	headerContent, err := readTemplateFromCache(site, opts, "header.kustomization.yaml.tmpl")
 	if err != nil {
 		return fmt.Errorf("failed to read header kustomization template: %w", err)
 	}
 
 	// Read root template
-	templateContent, err := readTemplateFromCache(site, "root.kustomization.yaml.tmpl")
+	templateContent, err := readTemplateFromCache(site, opts, "root.kustomization.yaml.tmpl")
 	if err != nil {
 		return fmt.Errorf("failed to read root kustomization template: %w", err)
 	}
 
 	// Parse both templates together
-	tmpl, err := template.New("header").Parse(string(headerContent))
+	tmpl, err := newStackTemplate(site, "header").Parse(string(headerContent))
 	if err != nil {
 		return fmt.Errorf("failed to parse header template: %w", err)
 	}
@@ -396,12 +1019,21 @@ func createRootKustomization(site *config.Site, componentName, outputPath string
 	data := struct {
 		Site          *config.Site
 		ComponentName string
+		Components    []string
+		GeneratedDir  string
+		CustomDir     string
+		// Labels and Annotations are empty, those of the generated kustomization cover the whole app
+		Labels      map[string]string
+		Annotations map[string]string
 	}{
 		Site:          site,
 		ComponentName: componentName,
+		Components:    components,
+		GeneratedDir:  site.Spec.Layout.GeneratedDir,
+		CustomDir:     site.Spec.Layout.CustomDir,
 	}
 
-	outputFile, err := os.Create(outputPath)
+	outputFile, err := createOutputFile(outputPath)
 	if err != nil {
 		return fmt.Errorf("failed to create root kustomization file: %w", err)
 	}
@@ -414,22 +1046,84 @@ func createRootKustomization(site *config.Site, componentName, outputPath string
 	return nil
 }
 
+// addRootKustomizationComponents appends the components missing from the components list of an existing
+// root kustomization.yaml, leaving the rest of the user's file as is. It reports whether the file was written.
+func addRootKustomizationComponents(rootPath string, components []string) (bool, error) {
+	data, err := os.ReadFile(rootPath)
+	if err != nil {
+		return false, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return false, fmt.Errorf("failed to parse %s: %w", rootPath, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return false, fmt.Errorf("failed to parse %s: not a mapping", rootPath)
+	}
+
+	mapping := doc.Content[0]
+	var list *yaml.Node
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == "components" {
+			list = mapping.Content[i+1]
+			break
+		}
+	}
+
+	existing := make(map[string]bool)
+	if list != nil {
+		if list.Kind != yaml.SequenceNode {
+			return false, fmt.Errorf("components of %s is not a list", rootPath)
+		}
+		for _, item := range list.Content {
+			existing[strings.TrimSuffix(item.Value, "/")] = true
+		}
+	}
+
+	var missing []string
+	for _, component := range components {
+		if !existing[component] {
+			missing = append(missing, component)
+		}
+	}
+	if len(missing) == 0 {
+		return false, nil
+	}
+
+	if list == nil {
+		list = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "components"}, list)
+	}
+	for _, component := range missing {
+		list.Content = append(list.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: component})
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return false, fmt.Errorf("failed to marshal %s: %w", rootPath, err)
+	}
+	return true, writeOutputFile(rootPath, buf.Bytes())
+}
+
 // createCustomKustomizationTemplate creates an empty custom kustomization.yaml template for users
-func createCustomKustomizationTemplate(site *config.Site, outputPath string) error {
+func createCustomKustomizationTemplate(site *config.Site, opts generateOptions, outputPath string) error {
 	// Read header template first
-	headerContent, err := readTemplateFromCache(site, "header.kustomization.yaml.tmpl")
+	headerContent, err := readTemplateFromCache(site, opts, "header.kustomization.yaml.tmpl")
 	if err != nil {
 		return fmt.Errorf("failed to read header kustomization template: %w", err)
 	}
 
 	// Read custom template
-	templateContent, err := readTemplateFromCache(site, "custom.kustomization.yaml.tmpl")
+	templateContent, err := readTemplateFromCache(site, opts, "custom.kustomization.yaml.tmpl")
 	if err != nil {
 		return fmt.Errorf("failed to read custom kustomization template: %w", err)
 	}
 
 	// Parse both templates together
-	tmpl, err := template.New("header").Parse(string(headerContent))
+	tmpl, err := newStackTemplate(site, "header").Parse(string(headerContent))
 	if err != nil {
 		return fmt.Errorf("failed to parse header template: %w", err)
 	}
@@ -439,7 +1133,7 @@ func createCustomKustomizationTemplate(site *config.Site, outputPath string) err
 		return fmt.Errorf("failed to parse custom kustomization template: %w", err)
 	}
 
-	outputFile, err := os.Create(outputPath)
+	outputFile, err := createOutputFile(outputPath)
 	if err != nil {
 		return fmt.Errorf("failed to create custom kustomization file: %w", err)
 	}
@@ -452,19 +1146,19 @@ func createCustomKustomizationTemplate(site *config.Site, outputPath string) err
 	return nil
 }
 
-func createCustomValuesTemplate(site *config.Site, outputPath string) error {
+func createCustomValuesTemplate(site *config.Site, opts generateOptions, outputPath string) error {
 	// Read custom values template
-	templateContent, err := readTemplateFromCache(site, "custom.values.yaml.tmpl")
+	templateContent, err := readTemplateFromCache(site, opts, "custom.values.yaml.tmpl")
 	if err != nil {
 		return fmt.Errorf("failed to read custom values template: %w", err)
 	}
 
-	tmpl, err := template.New("custom-values").Parse(string(templateContent))
+	tmpl, err := newStackTemplate(site, "custom-values").Parse(string(templateContent))
 	if err != nil {
 		return fmt.Errorf("failed to parse custom values template: %w", err)
 	}
 
-	outputFile, err := os.Create(outputPath)
+	outputFile, err := createOutputFile(outputPath)
 	if err != nil {
 		return fmt.Errorf("failed to create custom values file: %w", err)
 	}
@@ -478,11 +1172,11 @@ func createCustomValuesTemplate(site *config.Site, outputPath string) error {
 }
 
 // FindAppTemplates finds all templates for a specific component in the cache
-func FindAppTemplates(site *config.Site, componentName string) ([]string, error) {
+func FindAppTemplates(site *config.Site, opts generateOptions, componentName string) ([]string, error) {
 	var componentTemplates []string
 
 	// Check for component-specific templates in cache
-	componentDir := filepath.Join(getStackAppsDir(site), componentName, "templates")
+	componentDir := filepath.Join(getStackAppsDir(site, opts), componentName, "templates")
 
 	// Check if the templates directory exists
 	if _, err := os.Stat(componentDir); os.IsNotExist(err) {
@@ -498,7 +1192,7 @@ func FindAppTemplates(site *config.Site, componentName string) ([]string, error)
 		// Only include .tmpl files
 		if !d.IsDir() && strings.HasSuffix(path, ".tmpl") {
 			// Convert absolute path to relative path from stack directory
-			relPath, err := filepath.Rel(filepath.Join(getStackCacheDir(site), "stack"), path)
+			relPath, err := filepath.Rel(getStackRoot(site, opts), path)
 			if err != nil {
 				return err
 			}
@@ -510,40 +1204,120 @@ func FindAppTemplates(site *config.Site, componentName string) ([]string, error)
 	return componentTemplates, err
 }
 
-// generateTerraformRoot generates Terraform root module files from site configuration
-func generateTerraformRoot(dir string, site *config.Site) error {
+// resolveInfraModuleSource returns the terraform module source for the infra base
+// local points at the copied infra/base, git pins the provider base in the stack repository to stack.ref
+func resolveInfraModuleSource(site *config.Site, opts generateOptions) (string, error) {
+	switch opts.infraModuleSource {
+	case "local":
+		basePath := filepath.Join("clusters", site.Metadata.Name, "infra", "base")
+		if _, err := os.Stat(basePath); err != nil {
+			return "", fmt.Errorf("infra base not found at %s", basePath)
+		}
+		return "../base", nil
+	case "git":
+		// The cache holds the same ref, so the provider base must exist there
+		basePath := filepath.Join(getStackRoot(site, opts), "infra", "providers", site.Spec.Infra.Provider, "base")
+		if _, err := os.Stat(basePath); err != nil {
+			return "", fmt.Errorf("infra base for provider '%s' not found in stack %s", site.Spec.Infra.Provider, site.Spec.Stack.Ref)
+		}
+		source := strings.TrimPrefix(site.Spec.Stack.Source, "git::")
+		modulePath := path.Join(filepath.ToSlash(site.Spec.Stack.Subdir), "stack", "infra", "providers", site.Spec.Infra.Provider, "base")
+		return fmt.Sprintf("git::%s//%s?ref=%s", source, modulePath, renderedStackRef(site, opts)), nil
+	default:
+		return "", fmt.Errorf("unsupported infra module source '%s'", opts.infraModuleSource)
+	}
+}
 
+// InfraTemplateData holds the data used for infrastructure templates
+type InfraTemplateData struct {
+	Site           *config.Site
+	ProviderConfig map[string]interface{}
+	ModuleSource   string
+	// Provider is the typed configuration of the active provider (e.g. *config.ProxmoxConfig), nil when the provider has none
+	Provider interface{}
+	// NodeData holds the typed nodes of the active provider, use toJson to emit them with the terraform variable names
+	NodeData *config.NodeData
+}
+
+// newInfraTemplateData builds the infrastructure template data for the active provider
+func newInfraTemplateData(site *config.Site, opts generateOptions, moduleSource string) (*InfraTemplateData, error) {
 	providerConfig, err := site.Spec.Infra.GetActiveProviderConfig()
 	if err != nil {
-		return fmt.Errorf("get active provider config: %w", err)
+		return nil, fmt.Errorf("get active provider config: %w", err)
 	}
 
+	typedConfig, err := site.Spec.Infra.GetActiveTypedConfig()
+	if err != nil {
+		return nil, &ValidationError{Err: err}
+	}
+	nodeData, err := site.Spec.Infra.GetActiveNodeData()
+	if err != nil {
+		return nil, &ValidationError{Err: err}
+	}
+	if err := site.Spec.Infra.ValidateNodes(); err != nil {
+		return nil, &ValidationError{Err: err}
+	}
+
+	templateSite := *site
+	templateSite.Spec.Stack.Ref = renderedStackRef(site, opts)
+
+	return &InfraTemplateData{
+		Site:           &templateSite,
+		ProviderConfig: providerConfig,
+		ModuleSource:   moduleSource,
+		Provider:       typedConfig,
+		NodeData:       nodeData,
+	}, nil
+}
+
+// generateTerraformRoot generates Terraform root module files from site configuration
+func generateTerraformRoot(dir string, site *config.Site, opts generateOptions, moduleSource string) error {
+
 	// Template data - pass the active provider config
-	data := struct {
-		Site                  *config.Site
-		ProviderConfig        map[string]interface{}
-	}{
-		Site:                  site,
-		ProviderConfig:        providerConfig,
+	data, err := newInfraTemplateData(site, opts, moduleSource)
+	if err != nil {
+		return err
 	}
 
 	// Render main.tf
-	if err := renderInfraTemplate(site, "main.tf.tmpl", filepath.Join(dir, "main.tf"), data); err != nil {
+	if err := renderInfraTemplate(site, opts, "main.tf.tmpl", filepath.Join(dir, "main.tf"), data); err != nil {
 		return fmt.Errorf("render main.tf: %w", err)
 	}
 
 	// Render terraform.tfvars.json
-	if err := renderInfraTemplate(site, "terraform.tfvars.json.tmpl", filepath.Join(dir, "terraform.tfvars.json"), data); err != nil {
+	if err := renderInfraTemplate(site, opts, "terraform.tfvars.json.tmpl", filepath.Join(dir, "terraform.tfvars.json"), data); err != nil {
 		return fmt.Errorf("render terraform.tfvars.json: %w", err)
 	}
 
 	return nil
 }
 
+// printTerraformVars renders terraform.tfvars.json in memory and prints it to stdout
+func printTerraformVars(site *config.Site, opts generateOptions) error {
+	data, err := newInfraTemplateData(site, opts, "")
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := loadInfraTemplate(site, opts, "terraform.tfvars.json.tmpl")
+	if err != nil {
+		return err
+	}
+
+	if err := tmpl.Execute(os.Stdout, data); err != nil {
+		return fmt.Errorf("execute template terraform.tfvars.json.tmpl: %w", err)
+	}
+
+	return nil
+}
+
 // copyAppBase copies an app's base from cache to cluster directory
-func copyAppBase(site *config.Site, appName string) error {
-	// Source: cache/stack/{version}/stack/apps/{appName}/base
-	sourcePath := filepath.Join(getStackCacheDir(site), "stack", "apps", appName, "base")
+func copyAppBase(site *config.Site, opts generateOptions, appName string) error {
+	// Source: cache/stack/{version}/stack/apps/{appName}/base or the app's basePath
+	sourcePath, err := getAppBaseDir(site, opts, appName)
+	if err != nil {
+		return err
+	}
 
 	// Check if source exists
 	if _, err := os.Stat(sourcePath); os.IsNotExist(err) {
@@ -554,11 +1328,11 @@ func copyAppBase(site *config.Site, appName string) error {
 	clusterName := site.Metadata.Name
 	project := site.Spec.Apps.Catalog[appName].Project
 	if project == "" {
-		return fmt.Errorf("project is required for app %s", appName)
+		return newValidationError("project is required for app %s (set it on the app or in spec.apps.defaults)", appName)
 	}
 	namespace := site.Spec.Apps.Catalog[appName].Namespace
 	if namespace == "" {
-		return fmt.Errorf("namespace is required for app %s", appName)
+		return newValidationError("namespace is required for app %s (set it on the app or in spec.apps.defaults)", appName)
 	}
 	destPath := filepath.Join("clusters", clusterName, "apps", project, namespace, appName, "base")
 
@@ -567,18 +1341,89 @@ func copyAppBase(site *config.Site, appName string) error {
 		return fmt.Errorf("failed to remove existing base: %w", err)
 	}
 
+	// The app directory is created with the output mode, the base keeps the copied modes unless one is set
+	if err := mkdirOutput(filepath.Dir(destPath)); err != nil {
+		return fmt.Errorf("failed to create app directory: %w", err)
+	}
+
 	// Copy base
 	if err := copyDir(sourcePath, destPath); err != nil {
 		return fmt.Errorf("failed to copy app base: %w", err)
 	}
 
+	// Stack helm-chart.yaml files reference ../custom/, point them at the configured custom directory
+	if err := rewriteHelmChartCustomDir(filepath.Join(destPath, "helm-chart.yaml"), site.Spec.Layout.CustomDir); err != nil {
+		return fmt.Errorf("failed to set custom directory in helm-chart.yaml of %s: %w", appName, err)
+	}
+
 	return nil
 }
 
+// defaultCustomDir is the custom directory name the stack's helm-chart.yaml files are written for
+const defaultCustomDir = "custom"
+
+// rewriteHelmChartCustomDir replaces the ../custom/ prefix of valuesFile and additionalValuesFiles
+// in a copied helm-chart.yaml with ../<customDir>/. A missing file or the default directory is left alone.
+func rewriteHelmChartCustomDir(chartPath, customDir string) error {
+	if customDir == defaultCustomDir {
+		return nil
+	}
+	data, err := os.ReadFile(chartPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", chartPath, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil
+	}
+
+	oldPrefix := "../" + defaultCustomDir + "/"
+	newPrefix := "../" + customDir + "/"
+	rewrite := func(node *yaml.Node) bool {
+		if node.Kind != yaml.ScalarNode || !strings.HasPrefix(node.Value, oldPrefix) {
+			return false
+		}
+		node.Value = newPrefix + strings.TrimPrefix(node.Value, oldPrefix)
+		return true
+	}
+
+	changed := false
+	mapping := doc.Content[0]
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i].Value, mapping.Content[i+1]
+		switch key {
+		case "valuesFile":
+			changed = rewrite(value) || changed
+		case "additionalValuesFiles":
+			for _, item := range value.Content {
+				changed = rewrite(item) || changed
+			}
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(4)
+	if err := encoder.Encode(&doc); err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", chartPath, err)
+	}
+	return writeOutputFile(chartPath, buf.Bytes())
+}
+
 // copyBootstrapBase copies bootstrap base from cache to cluster directory
-func copyBootstrapBase(site *config.Site) error {
+func copyBootstrapBase(site *config.Site, opts generateOptions) error {
 	// Source: cache/stack/bootstrap/base
-	sourcePath := filepath.Join(getStackCacheDir(site), "stack", "bootstrap", "base")
+	sourcePath := filepath.Join(getStackRoot(site, opts), "bootstrap", "base")
 
 	// Check if source exists
 	if _, err := os.Stat(sourcePath); os.IsNotExist(err) {
@@ -602,7 +1447,7 @@ func copyBootstrapBase(site *config.Site) error {
 }
 
 // copyInfraBase copies infrastructure base from cache to cluster directory
-func copyInfraBase(site *config.Site) error {
+func copyInfraBase(site *config.Site, opts generateOptions) error {
 	// Determine the provider
 	providerName := site.Spec.Infra.Provider
 	if providerName == "" {
@@ -611,7 +1456,7 @@ func copyInfraBase(site *config.Site) error {
 
 	// Determine the infra base path in cache for the provider
 	// Path: stack/infra/providers/{provider}/base
-	sourcePath := filepath.Join(getStackCacheDir(site), "stack", "infra", "providers", providerName, "base")
+	sourcePath := filepath.Join(getStackRoot(site, opts), "infra", "providers", providerName, "base")
 
 	// Check if source exists
 	if _, err := os.Stat(sourcePath); os.IsNotExist(err) {
@@ -621,21 +1466,75 @@ func copyInfraBase(site *config.Site) error {
 	// Destination: clusters/{site}/infra/base
 	destPath := filepath.Join("clusters", site.Metadata.Name, "infra", "base")
 
-	// Remove existing base directory
-	if err := os.RemoveAll(destPath); err != nil {
-		return fmt.Errorf("failed to remove existing infra base: %w", err)
-	}
-
-	// Copy base
-	if err := copyDir(sourcePath, destPath); err != nil {
+	// Sync base, unchanged files keep their mtime like the generated terraform
+	if err := syncDir(sourcePath, destPath); err != nil {
 		return fmt.Errorf("failed to copy infra base: %w", err)
 	}
 
 	return nil
 }
 
-// copyDir recursively copies a directory
+// copyDir recursively copies a directory, skipping the files excluded by a .klabctlignore in src
 func copyDir(src, dst string) error {
+	rules, err := loadIgnoreRules(src)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", filepath.Join(src, ignoreFileName), err)
+	}
+
+	return copyDirIgnoring(src, dst, "", rules, copyFile)
+}
+
+// syncDir makes dst a copy of src like copyDir, but only writes the files whose content differs
+// and removes the files and directories of dst that src doesn't have
+func syncDir(src, dst string) error {
+	rules, err := loadIgnoreRules(src)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", filepath.Join(src, ignoreFileName), err)
+	}
+
+	if err := removeStaleEntries(src, dst, rules); err != nil {
+		return err
+	}
+	return copyDirIgnoring(src, dst, "", rules, copyFileIfChanged)
+}
+
+// removeStaleEntries removes the entries of dst that copying src wouldn't produce: missing or ignored in src,
+// or a file where src has a directory and the other way around
+func removeStaleEntries(src, dst string, rules ignoreRules) error {
+	err := filepath.WalkDir(dst, func(dstPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if dstPath == dst {
+			return nil
+		}
+		relPath, err := filepath.Rel(dst, dstPath)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		srcInfo, statErr := os.Stat(filepath.Join(src, relPath))
+		stale := statErr != nil || srcInfo.IsDir() != d.IsDir() || relPath == ignoreFileName || rules.ignored(relPath, d.IsDir())
+		if !stale {
+			return nil
+		}
+		if err := os.RemoveAll(dstPath); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// copyDirIgnoring recursively copies a directory with copyFn, relPath is the path of src relative to the copied base
+func copyDirIgnoring(src, dst, relPath string, rules ignoreRules, copyFn func(src, dst string) error) error {
 	// Get source directory info
 	srcInfo, err := os.Stat(src)
 	if err != nil {
@@ -646,6 +1545,9 @@ func copyDir(src, dst string) error {
 	if err := os.MkdirAll(dst, srcInfo.Mode()); err != nil {
 		return err
 	}
+	if err := chmodOutput(dst, outputDirMode); err != nil {
+		return err
+	}
 
 	// Read source directory
 	entries, err := os.ReadDir(src)
@@ -657,14 +1559,20 @@ func copyDir(src, dst string) error {
 		srcPath := filepath.Join(src, entry.Name())
 		dstPath := filepath.Join(dst, entry.Name())
 
+		// Skip the ignore file itself and everything it excludes
+		entryRelPath := path.Join(relPath, entry.Name())
+		if entryRelPath == ignoreFileName || rules.ignored(entryRelPath, entry.IsDir()) {
+			continue
+		}
+
 		if entry.IsDir() {
 			// Recursively copy subdirectory
-			if err := copyDir(srcPath, dstPath); err != nil {
+			if err := copyDirIgnoring(srcPath, dstPath, entryRelPath, rules, copyFn); err != nil {
 				return err
 			}
 		} else {
 			// Copy file
-			if err := copyFile(srcPath, dstPath); err != nil {
+			if err := copyFn(srcPath, dstPath); err != nil {
 				return err
 			}
 		}
@@ -673,6 +1581,45 @@ func copyDir(src, dst string) error {
 	return nil
 }
 
+// pruneEmptyDirs removes the empty directories below root, deepest first, root itself is kept
+// A directory holding only a .gitkeep is not empty and is kept
+func pruneEmptyDirs(root string) (int, error) {
+	var dirs []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path != root {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// WalkDir visits parents before children, so walking backwards removes children first
+	removed := 0
+	for i := len(dirs) - 1; i >= 0; i-- {
+		entries, err := os.ReadDir(dirs[i])
+		if err != nil {
+			return removed, err
+		}
+		if len(entries) > 0 {
+			continue
+		}
+		if err := os.Remove(dirs[i]); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
 // copyFile copies a single file
 func copyFile(src, dst string) error {
 	srcFile, err := os.Open(src)
@@ -692,6 +1639,9 @@ func copyFile(src, dst string) error {
 		return err
 	}
 	defer dstFile.Close()
+	if err := chmodOutput(dst, outputFileMode); err != nil {
+		return err
+	}
 
 	if _, err := srcFile.WriteTo(dstFile); err != nil {
 		return err
@@ -700,44 +1650,75 @@ func copyFile(src, dst string) error {
 	return nil
 }
 
-func renderBootstrapTemplate(site *config.Site, templateName, outputPath string, data interface{}) error {
-	filepath.Join(getStackCacheDir(site), "stack", "bootstrap", "templates", templateName)
+// copyFileIfChanged copies src to dst unless dst already holds the same content, which keeps its mtime
+func copyFileIfChanged(src, dst string) error {
+	want, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if existing, err := os.ReadFile(dst); err == nil && bytes.Equal(existing, want) {
+		return chmodOutput(dst, outputFileMode)
+	}
+	return copyFile(src, dst)
+}
+
+func renderBootstrapTemplate(site *config.Site, opts generateOptions, templateName, outputPath string, data interface{}) error {
+	filepath.Join(getStackRoot(site, opts), "bootstrap", "templates", templateName)
 
 	return nil
 }
 
-// renderInfraTemplate renders an infrastructure template to a file from cache
-func renderInfraTemplate(site *config.Site, templateName, outputPath string, data interface{}) error {
+// loadInfraTemplate reads and parses an infrastructure template of the active provider from cache
+func loadInfraTemplate(site *config.Site, opts generateOptions, templateName string) (*template.Template, error) {
 	// Determine the provider
 	providerName := site.Spec.Infra.Provider
 	if providerName == "" {
-		return fmt.Errorf("no provider specified")
+		return nil, fmt.Errorf("no provider specified")
 	}
 
 	// Read template content from cache (infra templates are in stack/infra/providers/{provider}/templates/)
-	fullPath := filepath.Join(getStackCacheDir(site), "stack", "infra", "providers", providerName, "templates", templateName)
-	templateContent, err := os.ReadFile(fullPath)
+	fullPath := filepath.Join(getStackRoot(site, opts), "infra", "providers", providerName, "templates", templateName)
+	templateContent, err := readTemplateFile(fullPath)
 	if err != nil {
-		return fmt.Errorf("read template %s: %w", templateName, err)
+		return nil, fmt.Errorf("read template %s: %w", templateName, err)
 	}
 
 	// Parse template
-	tmpl, err := template.New(filepath.Base(templateName)).Parse(string(templateContent))
+	tmpl, err := newStackTemplate(site, filepath.Base(templateName)).Parse(string(templateContent))
 	if err != nil {
-		return fmt.Errorf("parse template %s: %w", templateName, err)
+		return nil, fmt.Errorf("parse template %s: %w", templateName, err)
 	}
 
-	// Create output file
-	outputFile, err := os.Create(outputPath)
+	return tmpl, nil
+}
+
+// renderInfraTemplate renders an infrastructure template to a file from cache
+func renderInfraTemplate(site *config.Site, opts generateOptions, templateName, outputPath string, data interface{}) error {
+	tmpl, err := loadInfraTemplate(site, opts, templateName)
 	if err != nil {
-		return fmt.Errorf("create output file %s: %w", outputPath, err)
+		return err
 	}
-	defer outputFile.Close()
 
 	// Execute template
-	if err := tmpl.Execute(outputFile, data); err != nil {
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, data); err != nil {
 		return fmt.Errorf("execute template %s: %w", templateName, err)
 	}
 
+	return writeFileIfChanged(outputPath, rendered.Bytes())
+}
+
+// writeFileIfChanged writes data to path unless the file already holds exactly data,
+// so unchanged outputs keep their mtime and don't churn the terraform working directory
+func writeFileIfChanged(path string, data []byte) error {
+	existing, err := os.ReadFile(path)
+	if err == nil && bytes.Equal(existing, data) {
+		return nil
+	}
+
+	if err := writeOutputFile(path, data); err != nil {
+		return fmt.Errorf("write output file %s: %w", path, err)
+	}
+
 	return nil
 }
@@ -0,0 +1,713 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bamaas/klabctl/internal/config"
+)
+
+func TestRewriteHelmChartCustomDir(t *testing.T) {
+	chart := `apiVersion: builtin
+kind: HelmChartInflationGenerator
+name: cert-manager
+valuesFile: values.yaml
+additionalValuesFiles:
+    - ../custom/values.yaml
+    - extra.yaml
+`
+	tests := []struct {
+		name      string
+		customDir string
+		want      []string
+		notWant   []string
+	}{
+		{name: "default dir is untouched", customDir: "custom", want: []string{"- ../custom/values.yaml"}},
+		{name: "configured dir", customDir: "overrides", want: []string{"- ../overrides/values.yaml", "- extra.yaml", "valuesFile: values.yaml"}, notWant: []string{"../custom/"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chartPath := filepath.Join(t.TempDir(), "helm-chart.yaml")
+			if err := os.WriteFile(chartPath, []byte(chart), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := rewriteHelmChartCustomDir(chartPath, tt.customDir); err != nil {
+				t.Fatalf("rewriteHelmChartCustomDir: %v", err)
+			}
+
+			data, err := os.ReadFile(chartPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("helm-chart.yaml misses %q:\n%s", want, data)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(string(data), notWant) {
+					t.Errorf("helm-chart.yaml still contains %q:\n%s", notWant, data)
+				}
+			}
+		})
+	}
+}
+
+func TestRewriteHelmChartCustomDirMissingFile(t *testing.T) {
+	if err := rewriteHelmChartCustomDir(filepath.Join(t.TempDir(), "helm-chart.yaml"), "overrides"); err != nil {
+		t.Fatalf("missing helm-chart.yaml: %v", err)
+	}
+}
+
+func TestInputHashAnnotation(t *testing.T) {
+	cacheDir := useTestStack(t, testStackApps)
+	commitTestStack(t, cacheDir)
+	annotation := regexp.MustCompile(regexp.QuoteMeta(inputHashAnnotationKey) + `: "([^"]+)"`)
+
+	render := func(site *config.Site) string {
+		t.Helper()
+		if _, err := generateAppManifests(site, generateOptions{inputHashAnnotation: true}); err != nil {
+			t.Fatalf("generateAppManifests: %v", err)
+		}
+		kustomization := readTestFile(t, filepath.Join("clusters", "demo", "apps", "system", "apps", "external-dns", site.Spec.Layout.GeneratedDir, "kustomization.yaml"))
+		match := annotation.FindStringSubmatch(kustomization)
+		if match == nil {
+			t.Fatalf("generated kustomization misses the input hash:\n%s", kustomization)
+		}
+		return match[1]
+	}
+
+	site := parseTestSite(t, testSiteYaml)
+	first := render(site)
+	if again := render(site); again != first {
+		t.Errorf("input hash changed without input changes: %s != %s", again, first)
+	}
+
+	// external-dns reads the host of pihole
+	site.Spec.Apps.Catalog["pihole"].Values["host"] = "dns.lan"
+	if changed := render(site); changed == first {
+		t.Error("input hash did not change with the values of a referenced app")
+	}
+}
+
+func TestAddRootKustomizationComponents(t *testing.T) {
+	tests := []struct {
+		name       string
+		root       string
+		components []string
+		wantAdded  bool
+		want       []string
+	}{
+		{
+			name:       "all listed",
+			root:       "resources:\n  - generated\n  - custom\ncomponents:\n  - custom/components/a\n",
+			components: []string{"custom/components/a"},
+			wantAdded:  false,
+		},
+		{
+			name:       "listed with trailing slash",
+			root:       "resources:\n  - generated\ncomponents:\n  - custom/components/a/\n",
+			components: []string{"custom/components/a"},
+			wantAdded:  false,
+		},
+		{
+			name:       "missing entry is appended",
+			root:       "resources:\n  - generated\n  - custom\ncomponents:\n  - custom/components/a\n",
+			components: []string{"custom/components/a", "custom/components/b"},
+			wantAdded:  true,
+			want:       []string{"  - custom/components/a\n  - custom/components/b\n"},
+		},
+		{
+			name:       "components list is created",
+			root:       "# my edits\nresources:\n  - generated\n  - custom\n  - extra.yaml\n",
+			components: []string{"custom/components/a"},
+			wantAdded:  true,
+			want:       []string{"# my edits", "  - extra.yaml", "components:\n  - custom/components/a\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rootPath := filepath.Join(t.TempDir(), "kustomization.yaml")
+			writeTestFile(t, rootPath, tt.root)
+
+			added, err := addRootKustomizationComponents(rootPath, tt.components)
+			if err != nil {
+				t.Fatalf("addRootKustomizationComponents: %v", err)
+			}
+			if added != tt.wantAdded {
+				t.Errorf("added = %t, want %t", added, tt.wantAdded)
+			}
+
+			got := readTestFile(t, rootPath)
+			if !tt.wantAdded && got != tt.root {
+				t.Errorf("unchanged root was rewritten:\n%s", got)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("root kustomization misses %q:\n%s", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestInfraModuleSource(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     string
+		wantSource string
+		wantBase   bool
+	}{
+		{name: "git", source: "git", wantSource: `source = "git::https://example.com/stack.git//stack/infra/providers/proxmox/base?ref=main"`},
+		{name: "local", source: "local", wantSource: `source = "../base"`, wantBase: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestStack(t, testStackApps)
+			site := parseTestSite(t, testSiteYaml)
+
+			if err := generateInfraManifests(site, generateOptions{infraModuleSource: tt.source}); err != nil {
+				t.Fatalf("generateInfraManifests: %v", err)
+			}
+
+			mainTf := readTestFile(t, filepath.Join("clusters", "demo", "infra", "generated", "main.tf"))
+			if !strings.Contains(mainTf, tt.wantSource) {
+				t.Errorf("main.tf misses %s:\n%s", tt.wantSource, mainTf)
+			}
+			_, err := os.Stat(filepath.Join("clusters", "demo", "infra", "base"))
+			if hasBase := err == nil; hasBase != tt.wantBase {
+				t.Errorf("infra base copied = %t, want %t", hasBase, tt.wantBase)
+			}
+		})
+	}
+}
+
+func TestInfraModuleSourceDefault(t *testing.T) {
+	cacheDir := useTestStack(t, testStackApps)
+	commitTestStack(t, cacheDir)
+	writeTestSite(t, testSiteYaml)
+
+	if _, err := runTestGenerate(t); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+
+	// Without --infra-module-source the infra base is copied next to the generated root
+	mainTf := readTestFile(t, filepath.Join("clusters", "demo", "infra", "generated", "main.tf"))
+	if !strings.Contains(mainTf, `source = "../base"`) {
+		t.Errorf("main.tf does not use the local module source:\n%s", mainTf)
+	}
+	if _, err := os.Stat(filepath.Join("clusters", "demo", "infra", "base")); err != nil {
+		t.Errorf("infra base not copied: %v", err)
+	}
+}
+
+func TestCopyInfraBaseOnlyWritesChanges(t *testing.T) {
+	useTestStack(t, testStackApps)
+	site := parseTestSite(t, testSiteYaml)
+	sourceDir := filepath.Join(getStackRoot(site, generateOptions{}), "infra", "providers", "proxmox", "base")
+	baseDir := filepath.Join("clusters", "demo", "infra", "base")
+	generatedDir := filepath.Join("clusters", "demo", "infra", "generated")
+
+	render := func() {
+		t.Helper()
+		if err := generateInfraManifests(site, generateOptions{infraModuleSource: "local"}); err != nil {
+			t.Fatalf("generateInfraManifests: %v", err)
+		}
+	}
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	age := func(paths ...string) {
+		t.Helper()
+		for _, path := range paths {
+			if err := os.Chtimes(path, past, past); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	modified := func(path string) bool {
+		t.Helper()
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return !info.ModTime().Equal(past)
+	}
+
+	render()
+	age(filepath.Join(baseDir, "main.tf"), filepath.Join(baseDir, "cluster.tf"), filepath.Join(generatedDir, "main.tf"), filepath.Join(generatedDir, "terraform.tfvars.json"))
+	writeTestFile(t, filepath.Join(baseDir, "stale.tf"), "# removed from the stack\n")
+	writeTestFile(t, filepath.Join(sourceDir, "cluster.tf"), readTestFile(t, filepath.Join(sourceDir, "cluster.tf"))+"\n# changed\n")
+	render()
+
+	tests := []struct {
+		path         string
+		wantModified bool
+	}{
+		{path: filepath.Join(baseDir, "main.tf"), wantModified: false},
+		{path: filepath.Join(baseDir, "cluster.tf"), wantModified: true},
+		{path: filepath.Join(generatedDir, "main.tf"), wantModified: false},
+		{path: filepath.Join(generatedDir, "terraform.tfvars.json"), wantModified: false},
+	}
+	for _, tt := range tests {
+		if got := modified(tt.path); got != tt.wantModified {
+			t.Errorf("%s rewritten = %t, want %t", tt.path, got, tt.wantModified)
+		}
+	}
+
+	if !strings.HasSuffix(readTestFile(t, filepath.Join(baseDir, "cluster.tf")), "# changed\n") {
+		t.Error("changed stack file was not copied")
+	}
+	if _, err := os.Stat(filepath.Join(baseDir, "stale.tf")); !os.IsNotExist(err) {
+		t.Errorf("file removed from the stack is still in the infra base: %v", err)
+	}
+}
+
+func TestEnvironmentReachesTemplates(t *testing.T) {
+	tests := []struct {
+		name        string
+		environment string
+		want        string
+	}{
+		{name: "not set", environment: "", want: "# environment: none\n"},
+		{name: "prod", environment: "prod", want: "# environment: prod\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestStack(t, map[string]testApp{
+				"pihole":       {Template: "{{- template \"base\" . }}\n# environment: {{ or .Environment \"none\" }}\n"},
+				"external-dns": testStackApps["external-dns"],
+			})
+			site := parseTestSite(t, testSiteYaml)
+			site.Spec.Environment = tt.environment
+
+			if _, err := generateAppManifests(site, generateOptions{}); err != nil {
+				t.Fatalf("generateAppManifests: %v", err)
+			}
+
+			// The environment doesn't change the output location
+			kustomization := readTestFile(t, filepath.Join("clusters", "demo", "apps", "system", "apps", "pihole", site.Spec.Layout.GeneratedDir, "kustomization.yaml"))
+			if !strings.Contains(kustomization, tt.want) {
+				t.Errorf("generated kustomization misses %q:\n%s", tt.want, kustomization)
+			}
+		})
+	}
+}
+
+func TestGenerateAssumeRef(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         []string
+		wantSource   string
+		wantWarnings int
+	}{
+		{name: "site ref", wantSource: "?ref=main", wantWarnings: 0},
+		{name: "same ref", args: []string{"--assume-ref", "main"}, wantSource: "?ref=main", wantWarnings: 0},
+		{name: "other ref", args: []string{"--assume-ref", "v2"}, wantSource: "?ref=v2", wantWarnings: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := useTestStack(t, testStackApps)
+			commitTestStack(t, cacheDir)
+			otherDir := filepath.Join(stackCacheDirRoot, "v2")
+			runTestGit(t, ".", "clone", "-q", cacheDir, otherDir)
+			runTestGit(t, otherDir, "checkout", "-q", "-b", "v2")
+			writeTestSite(t, testSiteYaml)
+			colorPolicy = colorNever
+			t.Cleanup(func() { colorPolicy = colorAuto })
+
+			var err error
+			stderr := captureStderr(t, func() { _, err = runTestGenerate(t, append([]string{"--infra-module-source", "git"}, tt.args...)...) })
+			if err != nil {
+				t.Fatalf("generate: %v", err)
+			}
+
+			// The override is reported once, by the counted warning
+			if got := strings.Count(stderr, "[warn] rendering from stack ref"); got != tt.wantWarnings {
+				t.Errorf("override warned %d times, want %d:\n%s", got, tt.wantWarnings, stderr)
+			}
+			if strings.Contains(stderr, "WARNING") {
+				t.Errorf("warning repeats the marker as a WARNING prefix:\n%s", stderr)
+			}
+
+			mainTf := readTestFile(t, filepath.Join("clusters", "demo", "infra", "generated", "main.tf"))
+			if !strings.Contains(mainTf, tt.wantSource) {
+				t.Errorf("main.tf misses %s:\n%s", tt.wantSource, mainTf)
+			}
+			if warningCount != tt.wantWarnings {
+				t.Errorf("warnings = %d, want %d", warningCount, tt.wantWarnings)
+			}
+			if got := readTestFile(t, filepath.Join("clusters", "demo", "site.yaml")); got != testSiteYaml {
+				t.Errorf("site.yaml was modified:\n%s", got)
+			}
+		})
+	}
+}
+
+func TestTraceTemplateData(t *testing.T) {
+	tests := []struct {
+		component string
+		want      []string
+	}{
+		{component: "pihole", want: []string{"componentname: pihole", "host: pihole.lan"}},
+		{component: "external-dns", want: []string{"componentname: external-dns", "interval: 1m"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.component, func(t *testing.T) {
+			useTestStack(t, testStackApps)
+			site := parseTestSite(t, testSiteYaml)
+			component := site.Spec.Apps.Catalog[tt.component]
+			traceDir := filepath.Join(t.TempDir(), "trace")
+
+			if err := traceTemplateData(site, generateOptions{traceDir: traceDir}, tt.component, &component); err != nil {
+				t.Fatalf("traceTemplateData: %v", err)
+			}
+
+			trace := readTestFile(t, filepath.Join(traceDir, tt.component+".yaml"))
+			for _, want := range tt.want {
+				if !strings.Contains(trace, want) {
+					t.Errorf("trace misses %q:\n%s", want, trace)
+				}
+			}
+		})
+	}
+}
+
+func TestPrintTerraformVars(t *testing.T) {
+	tests := []struct {
+		name      string
+		provider  string
+		wantError string
+	}{
+		{name: "active provider", provider: "proxmox"},
+		{name: "unknown provider", provider: "aws", wantError: "provider 'aws' not found in providers"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestStack(t, testStackApps)
+			site := parseTestSite(t, testSiteYaml)
+			site.Spec.Infra.Provider = tt.provider
+
+			var err error
+			output := captureStdout(t, func() { err = printTerraformVars(site, generateOptions{}) })
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("printTerraformVars: %v", err)
+			}
+			if _, err := os.Stat("clusters"); !os.IsNotExist(err) {
+				t.Errorf("printing the variables wrote files: %v", err)
+			}
+
+			// The preview is what generate writes
+			if err := generateInfraManifests(site, generateOptions{infraModuleSource: "git"}); err != nil {
+				t.Fatalf("generateInfraManifests: %v", err)
+			}
+			if written := readTestFile(t, filepath.Join("clusters", "demo", "infra", "generated", "terraform.tfvars.json")); output != written {
+				t.Errorf("printed variables differ from terraform.tfvars.json:\n%s\n---\n%s", output, written)
+			}
+		})
+	}
+}
+
+func TestGenerateLayoutDirs(t *testing.T) {
+	tests := []struct {
+		name      string
+		generated string
+		custom    string
+	}{
+		{name: "defaults", generated: "generated", custom: "custom"},
+		{name: "configured", generated: "rendered", custom: "overrides"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestStack(t, testStackApps)
+			site := parseTestSite(t, testSiteYaml)
+			site.Spec.Layout.GeneratedDir = tt.generated
+			site.Spec.Layout.CustomDir = tt.custom
+
+			if _, err := generateAppManifests(site, generateOptions{}); err != nil {
+				t.Fatalf("generateAppManifests: %v", err)
+			}
+
+			appDir := filepath.Join("clusters", "demo", "apps", "system", "apps", "pihole")
+			for _, path := range []string{filepath.Join(appDir, tt.generated, "kustomization.yaml"), filepath.Join(appDir, tt.custom)} {
+				if _, err := os.Stat(path); err != nil {
+					t.Errorf("missing %s: %v", path, err)
+				}
+			}
+			root := readTestFile(t, filepath.Join(appDir, "kustomization.yaml"))
+			for _, want := range []string{"- " + tt.generated, "- " + tt.custom} {
+				if !strings.Contains(root, want) {
+					t.Errorf("root kustomization misses %q:\n%s", want, root)
+				}
+			}
+		})
+	}
+}
+
+func TestReadTemplateFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		size      int
+		maxSize   int64
+		dir       bool
+		wantError string
+	}{
+		{name: "below the limit", size: 10, maxSize: 16},
+		{name: "at the limit", size: 16, maxSize: 16},
+		{name: "above the limit", size: 17, maxSize: 16, wantError: "exceeds the maximum template size of 16 bytes"},
+		{name: "no limit", size: 1024, maxSize: 0},
+		{name: "directory", dir: true, maxSize: 16, wantError: "is not a regular file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "app.yaml.tmpl")
+			if tt.dir {
+				if err := os.Mkdir(path, 0755); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				writeTestFile(t, path, strings.Repeat("x", tt.size))
+			}
+			size := maxTemplateSize
+			maxTemplateSize = tt.maxSize
+			t.Cleanup(func() { maxTemplateSize = size })
+
+			content, err := readTemplateFile(path)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readTemplateFile: %v", err)
+			}
+			if len(content) != tt.size {
+				t.Errorf("read %d bytes, want %d", len(content), tt.size)
+			}
+		})
+	}
+}
+
+func TestGenerateSummaryOnly(t *testing.T) {
+	tests := []struct {
+		name     string
+		siteYaml string
+		args     []string
+		want     string
+	}{
+		{name: "summary", siteYaml: testSiteYaml, args: []string{"--summary-only"}, want: "cluster=demo ref=main format=kustomize rendered=4 warnings=0\n"},
+		{name: "warnings are counted", siteYaml: strings.ReplaceAll(testSiteYaml, "enabled: true", "enabled: false"), args: []string{"--summary-only"}, want: "cluster=demo ref=main format=kustomize rendered=0 warnings=1\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := useTestStack(t, testStackApps)
+			commitTestStack(t, cacheDir)
+			writeTestSite(t, tt.siteYaml)
+
+			output, err := runTestGenerate(t, tt.args...)
+			if err != nil {
+				t.Fatalf("generate: %v", err)
+			}
+			if output != tt.want {
+				t.Errorf("stdout = %q, want %q", output, tt.want)
+			}
+		})
+	}
+}
+
+func TestPruneEmptyDirs(t *testing.T) {
+	tests := []struct {
+		name        string
+		dirs        []string
+		files       []string
+		wantRemoved int
+		wantKept    []string
+	}{
+		{name: "missing root", wantRemoved: 0},
+		{name: "nested empty directories", dirs: []string{"a/b/c"}, wantRemoved: 3},
+		{name: "directory with a file", dirs: []string{"a/b"}, files: []string{"a/kustomization.yaml"}, wantRemoved: 1, wantKept: []string{"a"}},
+		{name: "gitkeep", dirs: []string{"a/b"}, files: []string{"a/b/.gitkeep"}, wantRemoved: 0, wantKept: []string{"a/b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := filepath.Join(t.TempDir(), "apps")
+			for _, dir := range tt.dirs {
+				if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, file := range tt.files {
+				writeTestFile(t, filepath.Join(root, file), "")
+			}
+
+			removed, err := pruneEmptyDirs(root)
+			if err != nil {
+				t.Fatalf("pruneEmptyDirs: %v", err)
+			}
+			if removed != tt.wantRemoved {
+				t.Errorf("removed %d directories, want %d", removed, tt.wantRemoved)
+			}
+			for _, dir := range tt.wantKept {
+				if _, err := os.Stat(filepath.Join(root, dir)); err != nil {
+					t.Errorf("%s was removed: %v", dir, err)
+				}
+			}
+			if len(tt.dirs) > 0 {
+				if _, err := os.Stat(root); err != nil {
+					t.Errorf("root was removed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateStackSubdir(t *testing.T) {
+	tests := []struct {
+		name      string
+		subdir    string
+		wantError string
+	}{
+		{name: "stack in subdir", subdir: "platform"},
+		{name: "stack not in subdir", subdir: "other", wantError: "stack main has no stack/ directory in other"},
+		{name: "subdir outside the repository", subdir: "../platform", wantError: "must be relative to the stack repository"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := useTestStack(t, testStackApps)
+			if err := os.MkdirAll(filepath.Join(cacheDir, "platform"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Rename(filepath.Join(cacheDir, "stack"), filepath.Join(cacheDir, "platform", "stack")); err != nil {
+				t.Fatal(err)
+			}
+			commitTestStack(t, cacheDir)
+			writeTestSite(t, strings.Replace(testSiteYaml, "    ref: main\n", "    ref: main\n    subdir: "+tt.subdir+"\n", 1))
+
+			_, err := runTestGenerate(t)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("generate: %v", err)
+			}
+			readTestFile(t, filepath.Join("clusters", "demo", "apps", "system", "apps", "external-dns", "generated", "kustomization.yaml"))
+		})
+	}
+}
+
+func TestGenerateResolveRef(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantCommit bool
+	}{
+		{name: "ref as configured"},
+		{name: "ref resolved to its commit", args: []string{"--resolve-ref"}, wantCommit: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := useTestStack(t, map[string]testApp{
+				"pihole":       testStackApps["pihole"],
+				"external-dns": {Template: "{{- template \"base\" . }}\n# ref: {{ .Site.Spec.Stack.Ref }}\n"},
+			})
+			commitTestStack(t, cacheDir)
+			commit := strings.TrimSpace(runTestGit(t, cacheDir, "rev-parse", "HEAD"))
+			writeTestSite(t, testSiteYaml)
+
+			if _, err := runTestGenerate(t, tt.args...); err != nil {
+				t.Fatalf("generate: %v", err)
+			}
+
+			want := "# ref: main\n"
+			if tt.wantCommit {
+				want = "# ref: " + commit + "\n"
+			}
+			kustomization := readTestFile(t, filepath.Join("clusters", "demo", "apps", "system", "apps", "external-dns", "generated", "kustomization.yaml"))
+			if !strings.Contains(kustomization, want) {
+				t.Errorf("kustomization misses %q:\n%s", want, kustomization)
+			}
+			if site := readTestFile(t, filepath.Join("clusters", "demo", "site.yaml")); !strings.Contains(site, "ref: main\n") {
+				t.Errorf("--resolve-ref changed site.yaml:\n%s", site)
+			}
+		})
+	}
+}
+
+func TestGenerateDelimiters(t *testing.T) {
+	tests := []struct {
+		name       string
+		templating string
+		args       []string
+		wantError  string
+	}{
+		{name: "site delimiters", templating: "  templating:\n    delimiters: [\"[[\", \"]]\"]\n"},
+		{name: "delims flag", args: []string{"--delims", "[[,]]"}},
+		{name: "invalid delims flag", args: []string{"--delims", "[["}, wantError: "pair of distinct left and right delimiters"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := useTestStack(t, map[string]testApp{
+				"pihole":       testStackApps["pihole"],
+				"external-dns": {Template: "[[- template \"base\" . ]]\n# keep {{ .Values.host }}\n# namespace: [[ .Component.Namespace ]]\n"},
+			})
+			// The stack's own templates use the same delimiters
+			templatesDir := filepath.Join(cacheDir, "stack", "templates")
+			entries, err := os.ReadDir(templatesDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range entries {
+				path := filepath.Join(templatesDir, entry.Name())
+				content := strings.NewReplacer("{{", "[[", "}}", "]]").Replace(readTestFile(t, path))
+				writeTestFile(t, path, content)
+			}
+			commitTestStack(t, cacheDir)
+			writeTestSite(t, testSiteYaml+tt.templating)
+
+			_, err = runTestGenerate(t, tt.args...)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("generate: %v", err)
+			}
+
+			kustomization := readTestFile(t, filepath.Join("clusters", "demo", "apps", "system", "apps", "external-dns", "generated", "kustomization.yaml"))
+			for _, want := range []string{"# keep {{ .Values.host }}\n", "# namespace: apps\n", "kind: Kustomization"} {
+				if !strings.Contains(kustomization, want) {
+					t.Errorf("kustomization misses %q:\n%s", want, kustomization)
+				}
+			}
+		})
+	}
+}
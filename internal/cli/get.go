@@ -1,10 +1,14 @@
 package cli
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 
+	"github.com/bamaas/klabctl/internal/config"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
 )
@@ -20,6 +24,7 @@ func newGetCmd() *cobra.Command {
 	}
 
 	cmd.AddCommand(newGetDefaultsCmd())
+	cmd.AddCommand(newGetValuesCmd())
 
 	return cmd
 }
@@ -29,6 +34,10 @@ func newGetDefaultsCmd() *cobra.Command {
 	var stackSource string
 	var stackRef string
 	var clusterName string
+	var fromSite string
+	var enableAll, disableAll bool
+	var quiet bool
+	var opts defaultsOptions
 
 	cmd := &cobra.Command{
 		Use:   "defaults",
@@ -38,6 +47,9 @@ func newGetDefaultsCmd() *cobra.Command {
 This generates a site.yaml with all default values from the specified stack.
 Output is printed to stdout. The stack must already be cached (run 'klabctl pull' first).
 
+Every app is written with enabled: false unless --enable or --enable-all is passed.
+'klabctl init' differs here: it keeps the enabled state of each app's meta.yaml.
+
 Examples:
   # Get defaults with default cluster name
   klabctl get defaults
@@ -49,6 +61,9 @@ Examples:
   # Get defaults from specific stack version
   klabctl get defaults --stack-version v1.2.0
 
+  # Get the latest defaults of a branch instead of the cached copy
+  klabctl get defaults --stack-ref main --refresh
+
   # Combine all options
   klabctl get defaults \
     --cluster-name production \
@@ -57,42 +72,363 @@ Examples:
 
   # Save to file
   klabctl get defaults > site.yaml
-  klabctl get defaults -c production > clusters/production/site.yaml`,
+
+  # Without the header comment on stderr
+  klabctl get defaults --no-header > site.yaml
+  klabctl get defaults -n production > clusters/production/site.yaml
+
+  # Write clusters/production/site.yaml, refusing to overwrite an existing one
+  klabctl get defaults -n production --write
+  klabctl get defaults -n production --write --force
+
+  # Write each app's default values to its own file and reference it via valuesFrom
+  klabctl get defaults --split-values values > site.yaml
+  klabctl get defaults --split-values clusters/production/values --site-dir clusters/production > clusters/production/site.yaml
+  klabctl get defaults -n production --write --split-values clusters/production/values
+
+  # Update the defaults of a site while keeping its customized infra
+  klabctl get defaults --stack-ref v1.3.0 --merge-infra clusters/production/site.yaml
+
+  # Comment every app with the stack file its defaults came from
+  klabctl get defaults --annotate-source
+
+  # List the apps provided by the stack
+  klabctl get defaults --list-apps
+  klabctl get defaults --list-apps -o json
+
+  # Enable a selection of apps, or all of them (apps are disabled by default)
+  klabctl get defaults --enable cilium,metallb
+  klabctl get defaults --enable-all
+
+  # Get defaults from the stack of an existing site.yaml
+  klabctl get defaults --from-site clusters/production/site.yaml
+
+  # Show how an existing site.yaml diverges from the stack defaults
+  klabctl get defaults --diff clusters/production/site.yaml
+
+  # Preview how the defaults change when upgrading the stack
+  klabctl get defaults --compare-refs v1.2.0,v1.3.0`,
 		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return getDefaults(stackSource, stackRef, clusterName)
+			// Take the stack coordinates from an existing site.yaml
+			if fromSite != "" {
+				if cmd.Flags().Changed("stack-source") || cmd.Flags().Changed("stack-ref") || cmd.Flags().Changed("stack-subdir") {
+					return newValidationError("--from-site cannot be combined with --stack-source, --stack-ref or --stack-subdir")
+				}
+				site, err := config.LoadSiteFromFile(fromSite)
+				if err != nil {
+					return &ValidationError{Err: err}
+				}
+				if site.Spec.Stack.Source == "" || site.Spec.Stack.Ref == "" {
+					return newValidationError("%s has no spec.stack.source and spec.stack.ref", fromSite)
+				}
+				stackSource = site.Spec.Stack.Source
+				stackRef = site.Spec.Stack.Ref
+				opts.stackSubdir = site.Spec.Stack.Subdir
+			}
+			if err := config.ValidateStackSubdir(opts.stackSubdir); err != nil {
+				return &ValidationError{Err: err}
+			}
+
+			// Make the enabled state of the catalog explicit, apps are disabled unless requested
+			modes := 0
+			for _, set := range []bool{enableAll, disableAll, len(opts.enableApps) > 0} {
+				if set {
+					modes++
+				}
+			}
+			if modes > 1 {
+				return newValidationError("only one of --enable-all, --disable-all and --enable can be used")
+			}
+			switch {
+			case enableAll:
+				opts.enableMode = enableModeAll
+			case len(opts.enableApps) > 0:
+				opts.enableMode = enableModeList
+			case disableAll || (opts.diffSitePath == "" && len(opts.compareRefs) == 0):
+				// A diff compares against the stack's own enabled defaults unless a mode is requested
+				opts.enableMode = enableModeNone
+			}
+
+			if quiet {
+				opts.noHeader = true
+			}
+
+			if opts.force && !opts.write {
+				return newValidationError("--force requires --write")
+			}
+			if opts.write && (opts.listApps || opts.diffSitePath != "") {
+				return newValidationError("--write cannot be combined with --list-apps or --diff")
+			}
+
+			// valuesFrom is resolved relative to the directory of site.yaml, which --write determines
+			if opts.write {
+				if cmd.Flags().Changed("site-dir") {
+					return newValidationError("--site-dir cannot be combined with --write, which writes to clusters/<cluster-name>")
+				}
+				opts.siteDir = filepath.Join("clusters", clusterName)
+			}
+
+			if len(opts.compareRefs) > 0 {
+				if len(opts.compareRefs) != 2 {
+					return newValidationError("--compare-refs takes an old and a new ref, e.g. --compare-refs v1.2.0,v1.3.0")
+				}
+				if cmd.Flags().Changed("stack-ref") || opts.write || opts.listApps || opts.diffSitePath != "" || opts.splitValuesDir != "" || opts.mergeInfraPath != "" {
+					return newValidationError("--compare-refs cannot be combined with --stack-ref, --write, --list-apps, --diff, --split-values or --merge-infra")
+				}
+				return compareDefaultRefs(stackSource, opts.compareRefs[0], opts.compareRefs[1], clusterName, opts)
+			}
+
+			return getDefaults(stackSource, stackRef, clusterName, opts)
 		},
 	}
 
 	cmd.Flags().StringVarP(&clusterName, "cluster-name", "n", "my-cluster", "Cluster name (default: my-cluster)")
 	cmd.Flags().StringVar(&stackSource, "stack-source", "https://github.com/bamaas/klabctl", "Stack git repository URL (default: https://github.com/bamaas/klabctl.git)")
 	cmd.Flags().StringVar(&stackRef, "stack-ref", "main", "Stack reference (version/branch/commit) (default: main)")
+	cmd.Flags().StringVar(&opts.stackSubdir, "stack-subdir", "", "Directory of the stack repository holding stack/ (default: the repository root)")
+	cmd.Flags().StringVar(&fromSite, "from-site", "", "Read the stack source and ref from spec.stack of this site.yaml")
+	cmd.Flags().BoolVar(&enableAll, "enable-all", false, "Write enabled: true for every app")
+	cmd.Flags().BoolVar(&disableAll, "disable-all", false, "Write enabled: false for every app (default)")
+	cmd.Flags().StringSliceVar(&opts.enableApps, "enable", nil, "Comma separated apps to write enabled: true for, all other apps are disabled")
+	cmd.Flags().BoolVar(&opts.noHeader, "no-header", false, "Don't write the header comment to stderr, stdout only holds the YAML")
+	cmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Machine friendly output, implies --no-header")
+	cmd.Flags().BoolVar(&opts.write, "write", false, "Write the defaults to clusters/<cluster-name>/site.yaml instead of stdout")
+	cmd.Flags().BoolVar(&opts.force, "force", false, "Overwrite an existing site.yaml with --write")
+	cmd.Flags().StringVar(&opts.mergeInfraPath, "merge-infra", "", "Keep the infra values of an existing site.yaml, only adding infra keys new in the stack defaults")
+	cmd.Flags().BoolVar(&opts.annotateSource, "annotate-source", false, "Comment each catalog entry with the stack values.yaml its defaults were loaded from")
+	cmd.Flags().BoolVar(&opts.listApps, "list-apps", false, "List the apps provided by the stack, one per line")
+	cmd.Flags().StringVarP(&opts.output, "output", "o", "text", "Output format for --list-apps: text or json")
+	cmd.Flags().BoolVar(&opts.refresh, "refresh", false, "Fetch and update the cached stack before loading defaults (useful for branch refs)")
+	cmd.Flags().StringVar(&opts.diffSitePath, "diff", "", "Print a value-level diff between the defaults and the infra and catalog of an existing site.yaml")
+	cmd.Flags().StringSliceVar(&opts.compareRefs, "compare-refs", nil, "Print a value-level diff of the infra and catalog defaults of two stack refs, e.g. v1.2.0,v1.3.0")
+	cmd.Flags().StringVar(&opts.splitValuesDir, "split-values", "", "Write each app's default values to <dir>/<app>.values.yaml and reference them via valuesFrom (paths are resolved relative to site.yaml)")
+	cmd.Flags().StringVar(&opts.siteDir, "site-dir", ".", "Directory the printed site.yaml is saved in, --split-values paths are written relative to it (clusters/<cluster-name> with --write)")
 
 	return cmd
 }
 
-func getDefaults(stackSource string, stackVersion string, clusterName string) error {
+// defaultsOptions controls how the default site.yaml is generated
+type defaultsOptions struct {
+	// splitValuesDir, when set, moves each app's default values into a separate file in this directory
+	splitValuesDir string
+	// siteDir is the directory the site.yaml ends up in, valuesFrom paths are relative to it
+	siteDir string
+	// diffSitePath, when set, prints a diff against this site.yaml instead of the defaults
+	diffSitePath string
+	// refresh updates the cached stack from the remote before loading defaults
+	refresh bool
+	// listApps prints the names of the apps provided by the stack instead of the defaults
+	listApps bool
+	// output is the output format for listings (text or json)
+	output string
+	// noHeader suppresses the header comment written to stderr before the defaults
+	noHeader bool
+	// stackSubdir is the directory of the stack repository holding stack/
+	stackSubdir string
+	// enableMode sets the enabled state of every catalog entry, empty keeps the stack's meta.yaml
+	enableMode string
+	// enableApps lists the apps enabled with enableModeList
+	enableApps []string
+	// write saves the defaults to clusters/<name>/site.yaml instead of printing them
+	write bool
+	// force allows write to overwrite an existing site.yaml
+	force bool
+	// mergeInfraPath, when set, keeps the infra values of this site.yaml over the stack defaults
+	mergeInfraPath string
+	// annotateSource comments each catalog entry with the stack file its defaults were loaded from
+	annotateSource bool
+	// compareRefs, when set, holds an old and a new stack ref whose defaults are diffed
+	compareRefs []string
+}
+
+// Enabled states of the catalog entries in the generated defaults
+const (
+	enableModeAll  = "all"
+	enableModeNone = "none"
+	enableModeList = "list"
+)
+
+func getDefaults(stackSource string, stackVersion string, clusterName string, opts defaultsOptions) error {
+	// Update a cached branch ref from the remote instead of using possibly stale content
+	if opts.refresh {
+		if err := refreshStack(stackVersion); err != nil {
+			return err
+		}
+	}
+
 	// Ensure stack is available
-	if err := EnsureStackAvailable(stackSource, stackVersion, false); err != nil {
+	if err := EnsureStackAvailable(stackSource, stackVersion, opts.stackSubdir, false); err != nil {
 		return fmt.Errorf("failed to ensure stack is available: %w", err)
 	}
 
+	if opts.listApps {
+		return listStackApps(stackRootDir(stackVersion, opts.stackSubdir), opts.output)
+	}
+
 	// Generate the site.yaml with defaults
-	siteYaml, err := generateSiteYaml("", clusterName, stackSource, stackVersion)
+	siteYaml, err := generateSiteYaml("", clusterName, stackSource, stackVersion, opts)
 	if err != nil {
 		return err
 	}
-	fmt.Fprintf(os.Stderr, "# Default configuration values for stack %s@%s\n", stackSource, stackVersion)
-	fmt.Println(siteYaml)
 
+	if opts.diffSitePath != "" {
+		return diffSiteAgainstDefaults(opts.diffSitePath, siteYaml)
+	}
+	if opts.write {
+		return writeDefaultSiteYaml(clusterName, siteYaml, opts.force)
+	}
+	// The header goes to stderr and stdout only holds the YAML, so redirecting stdout yields a clean site.yaml
+	if !opts.noHeader {
+		fmt.Fprintf(os.Stderr, "# Default configuration values for stack %s@%s\n", stackSource, stackVersion)
+	}
+	fmt.Print(yamlDocument(siteYaml))
+
+	return nil
+}
+
+// yamlDocument returns a marshalled YAML document ending in exactly one newline
+func yamlDocument(s string) string {
+	return strings.TrimRight(s, "\n") + "\n"
+}
+
+// writeDefaultSiteYaml writes the defaults to clusters/<name>/site.yaml, creating the cluster directory
+// Like init, an existing site.yaml is never overwritten unless forced
+func writeDefaultSiteYaml(clusterName, siteYaml string, force bool) error {
+	clusterDir := filepath.Join("clusters", clusterName)
+	siteYamlPath := filepath.Join(clusterDir, "site.yaml")
+	if _, err := os.Stat(siteYamlPath); err == nil && !force {
+		return fmt.Errorf("cluster '%s' already exists (site.yaml found at %s), use --force to overwrite it", clusterName, siteYamlPath)
+	}
+
+	if err := os.MkdirAll(clusterDir, 0755); err != nil {
+		return fmt.Errorf("failed to create cluster directory: %w", err)
+	}
+	if err := os.WriteFile(siteYamlPath, []byte(yamlDocument(siteYaml)), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", siteYamlPath, err)
+	}
+
+	statusf(os.Stderr, "✓ Wrote %s\n", siteYamlPath)
 	return nil
 }
 
+// listStackApps prints the apps provided by the stack/ directory at stackRoot
+func listStackApps(stackRoot, output string) error {
+	apps, err := discoverAppsWithDefaults(stackRoot)
+	if err != nil {
+		return fmt.Errorf("failed to discover apps: %w", err)
+	}
+
+	switch output {
+	case "text":
+		for _, app := range apps {
+			fmt.Println(app)
+		}
+	case "json":
+		if apps == nil {
+			apps = []string{}
+		}
+		data, err := json.MarshalIndent(apps, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal apps: %w", err)
+		}
+		fmt.Println(string(data))
+	default:
+		return fmt.Errorf("unsupported output format '%s' (supported: text, json)", output)
+	}
+
+	return nil
+}
+
+// diffSiteAgainstDefaults prints how the infra and catalog of an existing site diverge from the defaults
+func diffSiteAgainstDefaults(sitePath, defaultsYaml string) error {
+	// Validate the site, but diff the file as written: the typed site adds the layout and app defaults
+	// and drops keys it doesn't know, which would show up as differences the user never made
+	if _, err := config.LoadSiteFromFile(sitePath); err != nil {
+		return fmt.Errorf("failed to load %s: %w", sitePath, err)
+	}
+	siteData, err := os.ReadFile(sitePath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", sitePath, err)
+	}
+	var siteValues, defaultValues map[string]interface{}
+	if err := yaml.Unmarshal(siteData, &siteValues); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", sitePath, err)
+	}
+	if err := yaml.Unmarshal([]byte(defaultsYaml), &defaultValues); err != nil {
+		return fmt.Errorf("failed to parse defaults: %w", err)
+	}
+
+	var changes []valueChange
+	for _, path := range []string{"infra", "apps.catalog"} {
+		changes = append(changes, diffValues("spec."+path, lookupPath(siteValues, "spec."+path), lookupPath(defaultValues, "spec."+path))...)
+	}
+
+	if len(changes) == 0 {
+		statusf(os.Stderr, "✓ %s matches the stack defaults\n", sitePath)
+		return nil
+	}
+
+	printValueChanges(os.Stdout, changes, "site", "defaults")
+	return nil
+}
+
+// compareDefaultRefs pulls both refs and prints how the infra and catalog defaults changed from oldRef to newRef
+func compareDefaultRefs(stackSource, oldRef, newRef, clusterName string, opts defaultsOptions) error {
+	var defaults []map[string]interface{}
+	for _, ref := range []string{oldRef, newRef} {
+		if opts.refresh {
+			if err := refreshStack(ref); err != nil {
+				return err
+			}
+		}
+		if err := EnsureStackAvailable(stackSource, ref, opts.stackSubdir, false); err != nil {
+			return fmt.Errorf("failed to ensure stack %s is available: %w", ref, err)
+		}
+
+		siteYaml, err := generateSiteYaml("", clusterName, stackSource, ref, opts)
+		if err != nil {
+			return fmt.Errorf("failed to generate defaults of %s: %w", ref, err)
+		}
+		var values map[string]interface{}
+		if err := yaml.Unmarshal([]byte(siteYaml), &values); err != nil {
+			return fmt.Errorf("failed to parse defaults of %s: %w", ref, err)
+		}
+		defaults = append(defaults, values)
+	}
+
+	var changes []valueChange
+	for _, path := range []string{"infra", "apps.catalog"} {
+		changes = append(changes, diffValues("spec."+path, lookupPath(defaults[0], "spec."+path), lookupPath(defaults[1], "spec."+path))...)
+	}
+
+	if len(changes) == 0 {
+		statusf(os.Stderr, "✓ The defaults of %s and %s are the same\n", oldRef, newRef)
+		return nil
+	}
+
+	printValueChanges(os.Stdout, changes, oldRef, newRef)
+	return nil
+}
+
+// lookupPath returns the value at a dot separated path in a values tree, or nil if absent
+func lookupPath(values map[string]interface{}, path string) interface{} {
+	var current interface{} = values
+	for _, key := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[key]
+	}
+	return current
+}
+
 // loadInfraDefaults loads the default infra values from the stack cache
 // It loads the default provider selection and ALL provider configurations
-func loadInfraDefaults(stackVersion string) (map[string]interface{}, error) {
+func loadInfraDefaults(stackRoot string) (map[string]interface{}, error) {
 	// Load default provider selection from stack/infra/values.yaml
-	valuesPath := filepath.Join(stackCacheDirRoot, stackVersion, "stack", "infra", "values.yaml")
+	valuesPath := filepath.Join(stackRoot, "infra", "values.yaml")
 
 	// Read the values file
 	data, err := os.ReadFile(valuesPath)
@@ -108,7 +444,7 @@ func loadInfraDefaults(stackVersion string) (map[string]interface{}, error) {
 	}
 
 	// Discover all available providers
-	providersDir := filepath.Join(stackCacheDirRoot, stackVersion, "stack", "infra", "providers")
+	providersDir := filepath.Join(stackRoot, "infra", "providers")
 	providers, err := discoverProviders(providersDir)
 	if err != nil {
 		// If no providers directory, return just the default provider selection
@@ -132,6 +468,11 @@ func loadInfraDefaults(stackVersion string) (map[string]interface{}, error) {
 			continue
 		}
 
+		// Stack defaults that don't fit the typed provider configuration would produce a broken site.yaml
+		if _, err := config.DecodeNamedProviderConfig(providerName, providerValues); err != nil {
+			return nil, fmt.Errorf("stack defaults: %w", err)
+		}
+
 		allProviderConfigs[providerName] = providerValues
 	}
 
@@ -145,6 +486,27 @@ func loadInfraDefaults(stackVersion string) (map[string]interface{}, error) {
 	return result, nil
 }
 
+// mergeExistingInfra deep-merges the infra of an existing site.yaml over the infra defaults
+// Values set in the site are kept, keys only present in the defaults are added
+// Provider configuration loaded via providersFrom is written inline
+func mergeExistingInfra(infraDefaults map[string]interface{}, sitePath string) (map[string]interface{}, error) {
+	site, err := config.LoadSiteFromFile(sitePath)
+	if err != nil {
+		return nil, &ValidationError{Err: err}
+	}
+
+	providers := make(map[string]interface{}, len(site.Spec.Infra.Providers))
+	for name, providerConfig := range site.Spec.Infra.Providers {
+		providers[name] = providerConfig
+	}
+	existing := map[string]interface{}{"providers": providers}
+	if site.Spec.Infra.Provider != "" {
+		existing["provider"] = site.Spec.Infra.Provider
+	}
+
+	return config.MergeValues(infraDefaults, existing), nil
+}
+
 // discoverProviders discovers all available providers in the providers directory
 func discoverProviders(providersDir string) ([]string, error) {
 	entries, err := os.ReadDir(providersDir)
@@ -181,8 +543,8 @@ func loadYamlFile(path string) (map[string]interface{}, error) {
 }
 
 // discoverAppsWithDefaults discovers all apps that have templates/values.yaml in the stack
-func discoverAppsWithDefaults(stackRef string) ([]string, error) {
-	appsDir := filepath.Join(stackCacheDirRoot, stackRef, "stack", "apps")
+func discoverAppsWithDefaults(stackRoot string) ([]string, error) {
+	appsDir := filepath.Join(stackRoot, "apps")
 
 	var apps []string
 	entries, err := os.ReadDir(appsDir)
@@ -202,34 +564,104 @@ func discoverAppsWithDefaults(stackRef string) ([]string, error) {
 	return apps, nil
 }
 
+// writeSplitValues writes an app's default values to <dir>/<app>.values.yaml
+// Returns the path of the written file relative to siteDir, to be used as valuesFrom reference
+func writeSplitValues(dir, siteDir, appName string, values map[string]interface{}) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create values directory: %w", err)
+	}
+
+	data, err := yaml.Marshal(values)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal values: %w", err)
+	}
+
+	valuesPath := filepath.Join(dir, appName+".values.yaml")
+	if err := os.WriteFile(valuesPath, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", valuesPath, err)
+	}
+
+	return relativeToDir(siteDir, valuesPath)
+}
+
+// relativeToDir returns path relative to dir with forward slashes, as written to site.yaml
+func relativeToDir(dir, path string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	relPath, err := filepath.Rel(absDir, absPath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(relPath), nil
+}
+
 // generateSiteYaml creates a basic site.yaml file
-func generateSiteYaml(outputPath, clusterName, stackSource, stackRef string) (string, error) {
+func generateSiteYaml(outputPath, clusterName, stackSource, stackRef string, opts defaultsOptions) (string, error) {
 	// Load infra defaults
-	infraDefaults, err := loadInfraDefaults(stackRef)
+	stackRoot := stackRootDir(stackRef, opts.stackSubdir)
+	infraDefaults, err := loadInfraDefaults(stackRoot)
 	if err != nil {
 		return "", fmt.Errorf("failed to load infra defaults: %w", err)
 	}
+	if opts.mergeInfraPath != "" {
+		infraDefaults, err = mergeExistingInfra(infraDefaults, opts.mergeInfraPath)
+		if err != nil {
+			return "", err
+		}
+	}
 
 	// Discover all apps
-	discoveredApps, err := discoverAppsWithDefaults(stackRef)
+	discoveredApps, err := discoverAppsWithDefaults(stackRoot)
 	if err != nil {
 		return "", fmt.Errorf("failed to discover apps: %w", err)
 	}
 
+	if opts.enableMode == enableModeList {
+		var unknown []string
+		for _, appName := range opts.enableApps {
+			if !containsString(discoveredApps, appName) {
+				unknown = append(unknown, appName)
+			}
+		}
+		if len(unknown) > 0 {
+			return "", newValidationError("unknown apps in --enable: %s", strings.Join(unknown, ", "))
+		}
+	}
+
 	// Load meta.yaml for each app
 	catalog := make(map[string]interface{})
 	for _, appName := range discoveredApps {
-		metaYamlPath := filepath.Join(stackCacheDirRoot, stackRef, "stack", "apps", appName, "meta.yaml")
+		metaYamlPath := filepath.Join(stackRoot, "apps", appName, "meta.yaml")
 		meta, err := loadYamlFile(metaYamlPath)
 		if err != nil {
 			return "", fmt.Errorf("failed to load meta for %s: %w", appName, err)
 		}
+		if meta == nil {
+			meta = make(map[string]interface{})
+		}
+		// The description documents the app in the stack, it is not a catalog setting
+		delete(meta, "description")
+
+		switch opts.enableMode {
+		case enableModeAll:
+			meta["enabled"] = true
+		case enableModeNone:
+			meta["enabled"] = false
+		case enableModeList:
+			meta["enabled"] = containsString(opts.enableApps, appName)
+		}
 		catalog[appName] = meta
 	}
 
 	// Load values.yaml for each app
 	for _, appName := range discoveredApps {
-		valuesYamlPath := filepath.Join(stackCacheDirRoot, stackRef, "stack", "apps", appName, "values.yaml")
+		valuesYamlPath := filepath.Join(stackRoot, "apps", appName, "values.yaml")
 		appDefaultValues, err := loadYamlFile(valuesYamlPath)
 		if err != nil {
 			return "", fmt.Errorf("failed to load defaults for %s: %w", appName, err)
@@ -243,7 +675,15 @@ func generateSiteYaml(outputPath, clusterName, stackSource, stackRef string) (st
 
 		// If there are default values, set them
 		if len(appDefaultValues) > 0 {
-			appConfig["values"] = appDefaultValues
+			if opts.splitValuesDir != "" {
+				valuesFrom, err := writeSplitValues(opts.splitValuesDir, opts.siteDir, appName, appDefaultValues)
+				if err != nil {
+					return "", fmt.Errorf("failed to split values for %s: %w", appName, err)
+				}
+				appConfig["valuesFrom"] = valuesFrom
+			} else {
+				appConfig["values"] = appDefaultValues
+			}
 		}
 
 		// Set the appConfig back in the catalog
@@ -251,11 +691,15 @@ func generateSiteYaml(outputPath, clusterName, stackSource, stackRef string) (st
 	}
 
 	// Build site structure
+	stack := map[string]string{
+		"source": stackSource,
+		"ref":    stackRef,
+	}
+	if opts.stackSubdir != "" {
+		stack["subdir"] = opts.stackSubdir
+	}
 	spec := map[string]interface{}{
-		"stack": map[string]string{
-			"source": stackSource,
-			"ref":    stackRef,
-		},
+		"stack": stack,
 		"infra": infraDefaults,
 		"apps": map[string]interface{}{
 			"catalog": catalog,
@@ -271,7 +715,15 @@ func generateSiteYaml(outputPath, clusterName, stackSource, stackRef string) (st
 		"spec": spec,
 	}
 
-	data, err := yaml.Marshal(site)
+	var document interface{} = site
+	if opts.annotateSource {
+		document, err = annotateCatalogSources(site, stackRef, opts.stackSubdir)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	data, err := yaml.Marshal(document)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal site.yaml: %w", err)
 	}
@@ -287,3 +739,43 @@ func generateSiteYaml(outputPath, clusterName, stackSource, stackRef string) (st
 
 	return "", nil
 }
+
+// annotateCatalogSources encodes the site as a YAML node with a head comment on every catalog entry
+// naming the stack file its defaults were loaded from, e.g. "# from stack/apps/pihole/values.yaml@main"
+// Apps without default values are annotated with their meta.yaml
+func annotateCatalogSources(site map[string]interface{}, stackRef, stackSubdir string) (*yaml.Node, error) {
+	var document yaml.Node
+	if err := document.Encode(site); err != nil {
+		return nil, fmt.Errorf("failed to encode site.yaml: %w", err)
+	}
+
+	catalog := mappingValue(mappingValue(mappingValue(&document, "spec"), "apps"), "catalog")
+	if catalog == nil {
+		return &document, nil
+	}
+	for i := 0; i+1 < len(catalog.Content); i += 2 {
+		appName := catalog.Content[i].Value
+		// Apps without default values only take their settings from meta.yaml
+		sourceFile := "values.yaml"
+		if mappingValue(catalog.Content[i+1], "values") == nil && mappingValue(catalog.Content[i+1], "valuesFrom") == nil {
+			sourceFile = "meta.yaml"
+		}
+		source := path.Join(filepath.ToSlash(stackSubdir), "stack", "apps", appName, sourceFile)
+		catalog.Content[i].HeadComment = fmt.Sprintf("from %s@%s", source, stackRef)
+	}
+
+	return &document, nil
+}
+
+// mappingValue returns the value node of key in a mapping node, nil when node is nil or has no such key
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
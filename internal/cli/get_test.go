@@ -0,0 +1,596 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bamaas/klabctl/internal/config"
+)
+
+func TestWriteSplitValues(t *testing.T) {
+	tests := []struct {
+		name      string
+		dir       string
+		siteDir   string
+		wantValue string
+	}{
+		{name: "site in the working directory", dir: "values", siteDir: ".", wantValue: "values/pihole.values.yaml"},
+		{name: "values next to the site", dir: filepath.Join("clusters", "demo", "values"), siteDir: filepath.Join("clusters", "demo"), wantValue: "values/pihole.values.yaml"},
+		{name: "values outside the site directory", dir: "values", siteDir: filepath.Join("clusters", "demo"), wantValue: "../../values/pihole.values.yaml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+
+			valuesFrom, err := writeSplitValues(tt.dir, tt.siteDir, "pihole", map[string]interface{}{"host": "pihole.lan"})
+			if err != nil {
+				t.Fatalf("writeSplitValues: %v", err)
+			}
+			if valuesFrom != tt.wantValue {
+				t.Errorf("valuesFrom = %q, want %q", valuesFrom, tt.wantValue)
+			}
+
+			// The reference resolves from the site.yaml in siteDir
+			sitePath := filepath.Join(tt.siteDir, "site.yaml")
+			writeTestFile(t, sitePath, `apiVersion: klab/v1alpha1
+kind: Site
+metadata:
+  name: demo
+spec:
+  apps:
+    catalog:
+      pihole:
+        enabled: true
+        valuesFrom: `+valuesFrom+`
+`)
+			site, err := config.LoadSiteFromFile(sitePath)
+			if err != nil {
+				t.Fatalf("load site: %v", err)
+			}
+			if got := site.Spec.Apps.Catalog["pihole"].Values["host"]; got != "pihole.lan" {
+				t.Errorf("host = %v, want pihole.lan", got)
+			}
+		})
+	}
+}
+
+func TestDiffSiteAgainstDefaults(t *testing.T) {
+	defaults := `apiVersion: klab/v1alpha1
+kind: Site
+metadata:
+  name: demo
+spec:
+  infra:
+    provider: proxmox
+  apps:
+    catalog:
+      pihole:
+        enabled: false
+        values:
+          host: pihole.local
+`
+	tests := []struct {
+		name string
+		site string
+		want string
+	}{
+		{
+			name: "site equal to the defaults",
+			site: defaults,
+			want: "",
+		},
+		{
+			name: "changed value",
+			site: strings.Replace(defaults, "host: pihole.local", "host: pihole.lan", 1),
+			want: "~ spec.apps.catalog.pihole.values.host: site=pihole.lan defaults=pihole.local\n",
+		},
+		{
+			name: "app defaults are not expanded into the catalog",
+			site: strings.Replace(defaults, "    catalog:", "    defaults:\n      project: system\n      namespace: apps\n    catalog:", 1),
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sitePath := filepath.Join(t.TempDir(), "site.yaml")
+			writeTestFile(t, sitePath, tt.site)
+
+			var diffErr error
+			got := captureStdout(t, func() {
+				diffErr = diffSiteAgainstDefaults(sitePath, defaults)
+			})
+			if diffErr != nil {
+				t.Fatalf("diffSiteAgainstDefaults: %v", diffErr)
+			}
+			if got != tt.want {
+				t.Errorf("diff = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListStackApps(t *testing.T) {
+	tests := []struct {
+		name      string
+		apps      map[string]testApp
+		output    string
+		want      string
+		wantError string
+	}{
+		{name: "text", apps: testStackApps, output: "text", want: "external-dns\npihole\n"},
+		{name: "json", apps: testStackApps, output: "json", want: "[\n  \"external-dns\",\n  \"pihole\"\n]\n"},
+		{name: "json without apps", output: "json", want: "[]\n"},
+		{name: "unsupported output", apps: testStackApps, output: "yaml", wantError: "unsupported output format 'yaml'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := useTestStack(t, tt.apps)
+
+			var err error
+			output := captureStdout(t, func() { err = listStackApps(filepath.Join(cacheDir, "stack"), tt.output) })
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("listStackApps: %v", err)
+			}
+			if output != tt.want {
+				t.Errorf("output = %q, want %q", output, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetDefaultsFromSite(t *testing.T) {
+	tests := []struct {
+		name      string
+		siteYaml  string
+		args      []string
+		want      string
+		wantError string
+	}{
+		{name: "stack of the site", siteYaml: testSiteYaml, want: "source: https://example.com/stack.git"},
+		{name: "combined with --stack-ref", siteYaml: testSiteYaml, args: []string{"--stack-ref", "v2"}, wantError: "--from-site cannot be combined"},
+		{name: "site without stack", siteYaml: strings.Replace(testSiteYaml, "    ref: main\n", "", 1), wantError: "has no spec.stack.source and spec.stack.ref"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := useTestStack(t, testStackApps)
+			commitTestStack(t, cacheDir)
+			writeTestSite(t, tt.siteYaml)
+
+			stdout, _, err := runTestGetDefaults(t, append([]string{"--from-site", filepath.Join("clusters", "demo", "site.yaml")}, tt.args...)...)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("get defaults: %v", err)
+			}
+			if !strings.Contains(stdout, tt.want) {
+				t.Errorf("defaults miss %q:\n%s", tt.want, stdout)
+			}
+		})
+	}
+}
+
+func TestGetDefaultsEnabledApps(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		want      map[string]bool
+		wantError string
+	}{
+		{name: "disabled by default", want: map[string]bool{"pihole": false, "external-dns": false}},
+		{name: "disable all", args: []string{"--disable-all"}, want: map[string]bool{"pihole": false, "external-dns": false}},
+		{name: "enable all", args: []string{"--enable-all"}, want: map[string]bool{"pihole": true, "external-dns": true}},
+		{name: "enable a selection", args: []string{"--enable", "pihole"}, want: map[string]bool{"pihole": true, "external-dns": false}},
+		{name: "unknown app", args: []string{"--enable", "pihole,cilium"}, wantError: "unknown apps in --enable: cilium"},
+		{name: "combined modes", args: []string{"--enable-all", "--enable", "pihole"}, wantError: "only one of --enable-all, --disable-all and --enable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := useTestStack(t, testStackApps)
+			commitTestStack(t, cacheDir)
+
+			stdout, _, err := runTestGetDefaults(t, append([]string{"--stack-source", "https://example.com/stack.git"}, tt.args...)...)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+				}
+				if exitCode(err) != exitCodeValidation {
+					t.Errorf("exit code = %d, want %d", exitCode(err), exitCodeValidation)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("get defaults: %v", err)
+			}
+
+			site, err := config.ParseSite([]byte(stdout))
+			if err != nil {
+				t.Fatalf("ParseSite: %v\n%s", err, stdout)
+			}
+			for name, enabled := range tt.want {
+				if got := site.Spec.Apps.Catalog[name].Enabled; got != enabled {
+					t.Errorf("%s enabled = %t, want %t", name, got, enabled)
+				}
+			}
+		})
+	}
+}
+
+func TestGetDefaultsHeader(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		wantHeader bool
+	}{
+		{name: "header by default", wantHeader: true},
+		{name: "no header", args: []string{"--no-header"}},
+		{name: "quiet", args: []string{"--quiet"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := useTestStack(t, testStackApps)
+			commitTestStack(t, cacheDir)
+
+			stdout, stderr, err := runTestGetDefaults(t, append([]string{"--stack-source", "https://example.com/stack.git"}, tt.args...)...)
+			if err != nil {
+				t.Fatalf("get defaults: %v", err)
+			}
+
+			header := "# Default configuration values for stack https://example.com/stack.git@main"
+			if got := strings.Contains(stderr, header); got != tt.wantHeader {
+				t.Errorf("header written = %t, want %t:\n%s", got, tt.wantHeader, stderr)
+			}
+			if strings.Contains(stdout, header) {
+				t.Errorf("header written to stdout:\n%s", stdout)
+			}
+			if _, err := config.ParseSite([]byte(stdout)); err != nil {
+				t.Errorf("stdout isn't a site: %v\n%s", err, stdout)
+			}
+		})
+	}
+}
+
+func TestGetDefaultsWrite(t *testing.T) {
+	tests := []struct {
+		name      string
+		existing  bool
+		args      []string
+		wantError string
+	}{
+		{name: "new cluster", args: []string{"--write"}},
+		{name: "existing cluster", existing: true, args: []string{"--write"}, wantError: "use --force to overwrite it"},
+		{name: "existing cluster forced", existing: true, args: []string{"--write", "--force"}},
+		{name: "force without write", args: []string{"--force"}, wantError: "--force requires --write"},
+		{name: "write with list apps", args: []string{"--write", "--list-apps"}, wantError: "--write cannot be combined"},
+		{name: "write with site dir", args: []string{"--write", "--site-dir", "elsewhere"}, wantError: "--site-dir cannot be combined with --write"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := useTestStack(t, testStackApps)
+			commitTestStack(t, cacheDir)
+			siteYamlPath := filepath.Join("clusters", "demo", "site.yaml")
+			if tt.existing {
+				writeTestFile(t, siteYamlPath, "# customized\n")
+			}
+
+			stdout, _, err := runTestGetDefaults(t, append([]string{"--stack-source", "https://example.com/stack.git", "-n", "demo"}, tt.args...)...)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+				}
+				if tt.existing && readTestFile(t, siteYamlPath) != "# customized\n" {
+					t.Error("existing site.yaml was overwritten")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("get defaults: %v", err)
+			}
+
+			if stdout != "" {
+				t.Errorf("--write printed the defaults to stdout:\n%s", stdout)
+			}
+			site, err := config.ParseSite([]byte(readTestFile(t, siteYamlPath)))
+			if err != nil {
+				t.Fatalf("written site.yaml: %v", err)
+			}
+			if site.Metadata.Name != "demo" {
+				t.Errorf("written site name = %s, want demo", site.Metadata.Name)
+			}
+		})
+	}
+}
+
+func TestGetDefaultsAnnotateSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "without annotations",
+			notWant: []string{"# from "},
+		},
+		{
+			name: "annotated",
+			args: []string{"--annotate-source"},
+			want: []string{
+				"# from stack/apps/pihole/values.yaml@main\n",
+				"# from stack/apps/metallb/meta.yaml@main\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := useTestStack(t, map[string]testApp{
+				"pihole":  testStackApps["pihole"],
+				"metallb": {},
+			})
+			commitTestStack(t, cacheDir)
+
+			stdout, _, err := runTestGetDefaults(t, append([]string{"--stack-source", "https://example.com/stack.git"}, tt.args...)...)
+			if err != nil {
+				t.Fatalf("get defaults: %v", err)
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(stdout, want) {
+					t.Errorf("defaults miss %q:\n%s", want, stdout)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(stdout, notWant) {
+					t.Errorf("defaults contain %q:\n%s", notWant, stdout)
+				}
+			}
+			if _, err := config.ParseSite([]byte(stdout)); err != nil {
+				t.Errorf("annotated defaults aren't a site: %v", err)
+			}
+		})
+	}
+}
+
+func TestMergeExistingInfra(t *testing.T) {
+	defaults := func() map[string]interface{} {
+		return map[string]interface{}{
+			"provider": "proxmox",
+			"providers": map[string]interface{}{
+				"proxmox": map[string]interface{}{
+					"endpoint":   "https://pve.default:8006/api2/json",
+					"talosImage": map[string]interface{}{"url": "https://factory.talos.dev/image.raw"},
+				},
+				"aws": map[string]interface{}{"region": "eu-west-1"},
+			},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		siteYaml     string
+		providers    string
+		wantEndpoint string
+		wantError    string
+	}{
+		{name: "inline infra", siteYaml: testSiteYaml, wantEndpoint: "https://pve.example.local:8006/api2/json"},
+		{
+			name:         "providersFrom",
+			siteYaml:     strings.Replace(testSiteYaml, "        endpoint: https://pve.example.local:8006/api2/json\n", "", 1),
+			providers:    "proxmox:\n  endpoint: https://pve.file:8006/api2/json\n",
+			wantEndpoint: "https://pve.file:8006/api2/json",
+		},
+		{name: "invalid site", siteYaml: "spec: [\n", wantError: "failed to parse"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			siteYaml := tt.siteYaml
+			if tt.providers != "" {
+				writeTestFile(t, filepath.Join("clusters", "demo", "providers.yaml"), tt.providers)
+				siteYaml = strings.Replace(siteYaml, "    providers:\n", "    providersFrom: providers.yaml\n    providers:\n", 1)
+			}
+			writeTestSite(t, siteYaml)
+
+			merged, err := mergeExistingInfra(defaults(), filepath.Join("clusters", "demo", "site.yaml"))
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+				}
+				if exitCode(err) != exitCodeValidation {
+					t.Errorf("exit code = %d, want %d", exitCode(err), exitCodeValidation)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("mergeExistingInfra: %v", err)
+			}
+
+			providers := merged["providers"].(map[string]interface{})
+			proxmox := providers["proxmox"].(map[string]interface{})
+			if proxmox["endpoint"] != tt.wantEndpoint {
+				t.Errorf("endpoint = %v, want the site's %s", proxmox["endpoint"], tt.wantEndpoint)
+			}
+			if _, ok := proxmox["talosImage"]; !ok {
+				t.Error("defaults missing from the site were dropped")
+			}
+			if _, ok := proxmox["cluster"]; !ok {
+				t.Error("settings of the site were dropped")
+			}
+			if _, ok := providers["aws"]; !ok {
+				t.Error("other providers of the defaults were dropped")
+			}
+		})
+	}
+}
+
+func TestGetDefaultsCompareRefs(t *testing.T) {
+	tests := []struct {
+		name       string
+		newApps    map[string]testApp
+		args       []string
+		wantStdout []string
+		wantStderr string
+		wantError  string
+	}{
+		{
+			name:       "same defaults",
+			newApps:    testStackApps,
+			wantStderr: "The defaults of main and v2 are the same",
+		},
+		{
+			name: "changed defaults",
+			newApps: map[string]testApp{
+				"pihole":   {Values: "host: pihole.home\n"},
+				"longhorn": {Values: "replicas: 3\n"},
+			},
+			wantStdout: []string{
+				"~ spec.apps.catalog.pihole.values.host: main=pihole.local v2=pihole.home\n",
+				"- spec.apps.catalog.external-dns: ",
+				"+ spec.apps.catalog.longhorn: ",
+			},
+		},
+		{name: "one ref", args: []string{"--compare-refs", "main"}, wantError: "--compare-refs takes an old and a new ref"},
+		{name: "combined with diff", args: []string{"--compare-refs", "main,v2", "--diff", "site.yaml"}, wantError: "--compare-refs cannot be combined"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := useTestStack(t, testStackApps)
+			commitTestStack(t, cacheDir)
+			if tt.newApps != nil {
+				// v2 is a branch with other apps, cached next to main
+				newCacheDir := filepath.Join(stackCacheDirRoot, "v2")
+				if err := copyDir(cacheDir, newCacheDir); err != nil {
+					t.Fatal(err)
+				}
+				appsDir := filepath.Join(newCacheDir, "stack", "apps")
+				if err := os.RemoveAll(appsDir); err != nil {
+					t.Fatal(err)
+				}
+				for name, app := range tt.newApps {
+					writeTestFile(t, filepath.Join(appsDir, name, "base", "kustomization.yaml"), "resources: []\n")
+					writeTestFile(t, filepath.Join(appsDir, name, "meta.yaml"), "enabled: true\n")
+					writeTestFile(t, filepath.Join(appsDir, name, "values.yaml"), app.Values)
+				}
+				runTestGit(t, newCacheDir, "checkout", "-q", "-b", "v2")
+				runTestGit(t, newCacheDir, "add", "-A")
+				runTestGit(t, newCacheDir, "commit", "-q", "--allow-empty", "-m", "v2")
+			}
+
+			args := tt.args
+			if args == nil {
+				args = []string{"--compare-refs", "main,v2"}
+			}
+			colorPolicy = colorNever
+			t.Cleanup(func() { colorPolicy = colorAuto })
+			stdout, stderr, err := runTestGetDefaults(t, append([]string{"--stack-source", "https://example.com/stack.git"}, args...)...)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+				}
+				if exitCode(err) != exitCodeValidation {
+					t.Errorf("exit code = %d, want %d", exitCode(err), exitCodeValidation)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("get defaults: %v\n%s", err, stderr)
+			}
+
+			for _, want := range tt.wantStdout {
+				if !strings.Contains(stdout, want) {
+					t.Errorf("stdout misses %q:\n%s", want, stdout)
+				}
+			}
+			if tt.wantStdout == nil && stdout != "" {
+				t.Errorf("stdout = %q, want no changes", stdout)
+			}
+			if !strings.Contains(stderr, tt.wantStderr) {
+				t.Errorf("stderr misses %q:\n%s", tt.wantStderr, stderr)
+			}
+		})
+	}
+}
+
+func TestYamlDocument(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "no trailing newline", in: "a: 1", want: "a: 1\n"},
+		{name: "one trailing newline", in: "a: 1\n", want: "a: 1\n"},
+		{name: "several trailing newlines", in: "a: 1\n\n\n", want: "a: 1\n"},
+		{name: "empty", in: "", want: "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := yamlDocument(tt.in); got != tt.want {
+				t.Errorf("yamlDocument(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetDefaultsStdout(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		upstream bool
+	}{
+		{name: "cached stack"},
+		{name: "no header", args: []string{"--no-header"}},
+		{name: "refreshed stack", args: []string{"--refresh"}, upstream: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := "https://example.com/stack.git"
+			if tt.upstream {
+				// The cache is cloned from a local upstream so refreshing runs git
+				source = newTestUpstream(t, testStackApps, 1)
+				if err := os.RemoveAll(filepath.Join(stackCacheDirRoot, testStackRef)); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				commitTestStack(t, useTestStack(t, testStackApps))
+			}
+
+			stdout, _, err := runTestGetDefaults(t, append([]string{"--stack-source", source}, tt.args...)...)
+			if err != nil {
+				t.Fatalf("get defaults: %v", err)
+			}
+
+			if !strings.HasPrefix(stdout, "apiVersion: ") {
+				t.Errorf("stdout doesn't start with the site:\n%s", stdout)
+			}
+			if !strings.HasSuffix(stdout, "\n") || strings.HasSuffix(stdout, "\n\n") {
+				t.Errorf("stdout doesn't end in a single newline: %q", stdout[max(0, len(stdout)-20):])
+			}
+			if _, err := config.ParseSite([]byte(stdout)); err != nil {
+				t.Errorf("stdout isn't a site: %v\n%s", err, stdout)
+			}
+		})
+	}
+}
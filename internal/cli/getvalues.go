@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/bamaas/klabctl/internal/config"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+func newGetValuesCmd() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "values <app>",
+		Short: "Print the effective values of an app",
+		Long: `Print the merged values of an enabled app, later sources win:
+  1. the stack defaults (stack/apps/<app>/values.yaml of spec.stack.ref)
+  2. custom/values.yaml in the app directory of the cluster
+  3. the catalog entry in site.yaml: valuesFrom, valuesJson and the inline values
+
+An app whose renderIf is false is not rendered by generate and reported as such.
+
+Examples:
+  # Print the values of an app as YAML
+  klabctl get values pihole --site clusters/production/site.yaml
+
+  # As JSON, e.g. for jq
+  klabctl get values pihole --site clusters/production/site.yaml -o json`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			appName := args[0]
+
+			site, err := loadSite(sitePath)
+			if err != nil {
+				return err
+			}
+
+			component, ok := site.Spec.Apps.Catalog[appName]
+			if !ok {
+				return newValidationError("app '%s' not found in the catalog of %s", appName, sitePath)
+			}
+			if !component.Enabled {
+				return newValidationError("app '%s' is not enabled in %s", appName, sitePath)
+			}
+
+			// Apply renderIf like generate does, a skipped app has no effective values
+			if err := applyRenderIf(site); err != nil {
+				return err
+			}
+			if !site.Spec.Apps.Catalog[appName].Enabled {
+				return newValidationError("app '%s' is skipped by its renderIf condition in %s", appName, sitePath)
+			}
+
+			if site.Spec.Stack.Source == "" || site.Spec.Stack.Ref == "" {
+				return newValidationError("stack.source and stack.ref are required in site.yaml")
+			}
+			if err := EnsureStackAvailable(site.Spec.Stack.Source, site.Spec.Stack.Ref, site.Spec.Stack.Subdir, false); err != nil {
+				return fmt.Errorf("failed to ensure stack is available: %w", err)
+			}
+
+			values, err := effectiveValues(site, generateOptions{}, appName)
+			if err != nil {
+				return err
+			}
+
+			switch output {
+			case "yaml":
+				data, err := yaml.Marshal(values)
+				if err != nil {
+					return fmt.Errorf("failed to marshal values: %w", err)
+				}
+				fmt.Print(string(data))
+			case "json":
+				data, err := json.MarshalIndent(values, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to marshal values: %w", err)
+				}
+				fmt.Println(string(data))
+			default:
+				return newValidationError("unsupported output format '%s' (supported: yaml, json)", output)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "yaml", "Output format: yaml or json")
+
+	return cmd
+}
+
+// stackDefaultValues returns the default values of an app in the stack, empty when the stack has none
+func stackDefaultValues(site *config.Site, opts generateOptions, componentName string) (map[string]interface{}, error) {
+	return loadYamlFile(filepath.Join(getStackAppsDir(site, opts), componentName, "values.yaml"))
+}
+
+// effectiveValues merges the stack defaults, the cluster's custom/values.yaml and the site values of an app
+func effectiveValues(site *config.Site, opts generateOptions, componentName string) (map[string]interface{}, error) {
+	component := site.Spec.Apps.Catalog[componentName]
+
+	values, err := stackDefaultValues(site, opts, componentName)
+	if err != nil {
+		return nil, err
+	}
+
+	customValuesPath := filepath.Join("clusters", site.Metadata.Name, "apps", component.Project, component.Namespace, componentName, site.Spec.Layout.CustomDir, "values.yaml")
+	customValues, err := loadYamlFile(customValuesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return config.MergeValues(config.MergeValues(values, customValues), component.Values), nil
+}
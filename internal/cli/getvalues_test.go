@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGetValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		site    string
+		custom  string
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "stack defaults, custom values and site values are merged in order",
+			args:   []string{"pihole"},
+			site:   strings.Replace(testSiteYaml, "          host: pihole.lan\n", "          host: pihole.lan\n          dns:\n            upstream: 9.9.9.9\n", 1),
+			custom: "dns:\n  upstream: 1.1.1.1\n  port: 53\nreplicas: 2\n",
+			want:   "dns:\n    port: 53\n    upstream: 9.9.9.9\nhost: pihole.lan\nreplicas: 2\nweb: true\n",
+		},
+		{
+			name: "json output",
+			args: []string{"pihole", "-o", "json"},
+			site: testSiteYaml,
+			want: "{\n  \"host\": \"pihole.lan\",\n  \"web\": true\n}\n",
+		},
+		{
+			name:    "renderIf false",
+			args:    []string{"pihole"},
+			site:    strings.Replace(testSiteYaml, "      pihole:\n        enabled: true\n", "      pihole:\n        enabled: true\n        renderIf: metadata.name == \"other\"\n", 1),
+			wantErr: "app 'pihole' is skipped by its renderIf condition",
+		},
+		{
+			name:    "disabled app",
+			args:    []string{"pihole"},
+			site:    strings.Replace(testSiteYaml, "      pihole:\n        enabled: true\n", "      pihole:\n        enabled: false\n", 1),
+			wantErr: "app 'pihole' is not enabled",
+		},
+		{
+			name:    "unknown app",
+			args:    []string{"grafana"},
+			site:    testSiteYaml,
+			wantErr: "app 'grafana' not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := useTestStack(t, map[string]testApp{
+				"pihole":       {Values: "host: pihole.local\nweb: true\n"},
+				"external-dns": testStackApps["external-dns"],
+			})
+			commitTestStack(t, cacheDir)
+			writeTestFile(t, "site.yaml", tt.site)
+			if tt.custom != "" {
+				writeTestFile(t, filepath.Join("clusters", "demo", "apps", "system", "apps", "pihole", "custom", "values.yaml"), tt.custom)
+			}
+			previousSitePath := sitePath
+			sitePath = "site.yaml"
+			t.Cleanup(func() { sitePath = previousSitePath })
+
+			cmd := newGetValuesCmd()
+			cmd.SetArgs(tt.args)
+			cmd.SilenceUsage = true
+			cmd.SilenceErrors = true
+			var runErr error
+			got := captureStdout(t, func() { runErr = cmd.Execute() })
+
+			if tt.wantErr != "" {
+				if runErr == nil || !strings.Contains(runErr.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", runErr, tt.wantErr)
+				}
+				return
+			}
+			if runErr != nil {
+				t.Fatalf("get values: %v", runErr)
+			}
+			if got != tt.want {
+				t.Errorf("values:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
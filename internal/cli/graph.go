@@ -0,0 +1,224 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bamaas/klabctl/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func newGraphCmd() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "graph",
+		Short: "Print the app dependency graph of site.yaml",
+		Long: `Print the dependency graph of the apps in the catalog, with an edge from every app
+to each app in its dependsOn.
+
+Enabled apps are highlighted, apps depending on each other in a cycle are marked in red.
+
+Examples:
+  # Render the graph with Graphviz
+  klabctl graph --site clusters/production/site.yaml | dot -Tsvg > apps.svg
+
+  # Mermaid for markdown documentation
+  klabctl graph --site clusters/production/site.yaml --format mermaid`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			site, err := loadSite(sitePath)
+			if err != nil {
+				return err
+			}
+
+			switch format {
+			case "dot":
+				fmt.Print(dependencyGraphDOT(site))
+			case "mermaid":
+				fmt.Print(dependencyGraphMermaid(site))
+			default:
+				return fmt.Errorf("unsupported graph format '%s' (supported: dot, mermaid)", format)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "dot", "Output format: dot (Graphviz) or mermaid")
+
+	return cmd
+}
+
+// dependencyEdge is a dependsOn relation from an app to the app it depends on
+type dependencyEdge struct {
+	From, To string
+	// Cyclic is set when the edge is part of a dependency cycle
+	Cyclic bool
+}
+
+// dependencyGraph returns the sorted app names (including unknown dependencies) and the dependsOn edges
+func dependencyGraph(site *config.Site) ([]string, []dependencyEdge) {
+	nodes := make(map[string]bool)
+	var edges []dependencyEdge
+	for name, component := range site.Spec.Apps.Catalog {
+		nodes[name] = true
+		for _, dependency := range component.DependsOn {
+			nodes[dependency] = true
+			edges = append(edges, dependencyEdge{From: name, To: dependency})
+		}
+	}
+
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cyclic := findDependencyCycles(names, edges)
+	for i := range edges {
+		edges[i].Cyclic = cyclic[edges[i].From] != 0 && cyclic[edges[i].From] == cyclic[edges[i].To]
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+
+	return names, edges
+}
+
+// findDependencyCycles returns for every app in a cycle the (non-zero) id of its cycle
+// Cycles are the strongly connected components with more than one app or a self dependency
+func findDependencyCycles(names []string, edges []dependencyEdge) map[string]int {
+	successors := make(map[string][]string)
+	selfLoop := make(map[string]bool)
+	for _, edge := range edges {
+		successors[edge.From] = append(successors[edge.From], edge.To)
+		if edge.From == edge.To {
+			selfLoop[edge.From] = true
+		}
+	}
+
+	// Tarjan's strongly connected components
+	index := make(map[string]int)
+	lowLink := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	nextIndex := 0
+	cycleID := 0
+	cycles := make(map[string]int)
+
+	var connect func(name string)
+	connect = func(name string) {
+		index[name] = nextIndex
+		lowLink[name] = nextIndex
+		nextIndex++
+		stack = append(stack, name)
+		onStack[name] = true
+
+		for _, next := range successors[name] {
+			if _, visited := index[next]; !visited {
+				connect(next)
+				lowLink[name] = min(lowLink[name], lowLink[next])
+			} else if onStack[next] {
+				lowLink[name] = min(lowLink[name], index[next])
+			}
+		}
+
+		if lowLink[name] != index[name] {
+			return
+		}
+		var component []string
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			component = append(component, top)
+			if top == name {
+				break
+			}
+		}
+		if len(component) > 1 || selfLoop[name] {
+			cycleID++
+			for _, member := range component {
+				cycles[member] = cycleID
+			}
+		}
+	}
+
+	for _, name := range names {
+		if _, visited := index[name]; !visited {
+			connect(name)
+		}
+	}
+	return cycles
+}
+
+// dependencyGraphDOT renders the dependency graph in Graphviz DOT
+func dependencyGraphDOT(site *config.Site) string {
+	names, edges := dependencyGraph(site)
+
+	var b strings.Builder
+	b.WriteString("digraph apps {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box];\n")
+	for _, name := range names {
+		component, ok := site.Spec.Apps.Catalog[name]
+		switch {
+		case !ok:
+			fmt.Fprintf(&b, "  %q [style=dotted, label=%q];\n", name, name+" (missing)")
+		case component.Enabled:
+			fmt.Fprintf(&b, "  %q [style=filled, fillcolor=lightblue];\n", name)
+		default:
+			fmt.Fprintf(&b, "  %q [color=gray, fontcolor=gray];\n", name)
+		}
+	}
+	for _, edge := range edges {
+		if edge.Cyclic {
+			fmt.Fprintf(&b, "  %q -> %q [color=red, label=\"cycle\"];\n", edge.From, edge.To)
+			continue
+		}
+		fmt.Fprintf(&b, "  %q -> %q;\n", edge.From, edge.To)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// dependencyGraphMermaid renders the dependency graph as a Mermaid flowchart
+func dependencyGraphMermaid(site *config.Site) string {
+	names, edges := dependencyGraph(site)
+
+	// Mermaid node ids can't contain dashes, the app name is used as label
+	ids := make(map[string]string, len(names))
+	for i, name := range names {
+		ids[name] = fmt.Sprintf("app%d", i)
+	}
+
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	b.WriteString("  classDef enabled fill:#add8e6\n")
+	b.WriteString("  classDef disabled color:#808080\n")
+	b.WriteString("  classDef missing stroke-dasharray:3\n")
+	for _, name := range names {
+		class := "disabled"
+		label := name
+		if component, ok := site.Spec.Apps.Catalog[name]; !ok {
+			class = "missing"
+			label += " (missing)"
+		} else if component.Enabled {
+			class = "enabled"
+		}
+		fmt.Fprintf(&b, "  %s[\"%s\"]:::%s\n", ids[name], label, class)
+	}
+	for i, edge := range edges {
+		if edge.Cyclic {
+			fmt.Fprintf(&b, "  %s -->|cycle| %s\n", ids[edge.From], ids[edge.To])
+			fmt.Fprintf(&b, "  linkStyle %d stroke:red\n", i)
+			continue
+		}
+		fmt.Fprintf(&b, "  %s --> %s\n", ids[edge.From], ids[edge.To])
+	}
+	return b.String()
+}
@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDependencyGraph(t *testing.T) {
+	tests := []struct {
+		name      string
+		dependsOn map[string][]string
+		wantNodes []string
+		wantEdges []dependencyEdge
+	}{
+		{
+			name:      "no dependencies",
+			dependsOn: map[string][]string{"pihole": nil, "cilium": nil},
+			wantNodes: []string{"cilium", "pihole"},
+		},
+		{
+			name:      "chain with a missing dependency",
+			dependsOn: map[string][]string{"pihole": {"metallb"}, "metallb": {"cilium"}},
+			wantNodes: []string{"cilium", "metallb", "pihole"},
+			wantEdges: []dependencyEdge{{From: "metallb", To: "cilium"}, {From: "pihole", To: "metallb"}},
+		},
+		{
+			name:      "cycle",
+			dependsOn: map[string][]string{"a": {"b"}, "b": {"a", "c"}, "c": nil},
+			wantNodes: []string{"a", "b", "c"},
+			wantEdges: []dependencyEdge{{From: "a", To: "b", Cyclic: true}, {From: "b", To: "a", Cyclic: true}, {From: "b", To: "c"}},
+		},
+		{
+			name:      "self dependency",
+			dependsOn: map[string][]string{"a": {"a"}},
+			wantNodes: []string{"a"},
+			wantEdges: []dependencyEdge{{From: "a", To: "a", Cyclic: true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, edges := dependencyGraph(testOrderSite(tt.dependsOn))
+			if !reflect.DeepEqual(nodes, tt.wantNodes) {
+				t.Errorf("nodes = %v, want %v", nodes, tt.wantNodes)
+			}
+			if !reflect.DeepEqual(edges, tt.wantEdges) {
+				t.Errorf("edges = %+v, want %+v", edges, tt.wantEdges)
+			}
+		})
+	}
+}
+
+func TestDependencyGraphFormats(t *testing.T) {
+	site := testOrderSite(map[string][]string{"external-dns": {"pihole", "cilium"}, "pihole": {"external-dns"}}, "pihole")
+
+	tests := []struct {
+		name   string
+		render func() string
+		want   string
+	}{
+		{
+			name:   "dot",
+			render: func() string { return dependencyGraphDOT(site) },
+			want: `digraph apps {
+  rankdir=LR;
+  node [shape=box];
+  "cilium" [style=dotted, label="cilium (missing)"];
+  "external-dns" [style=filled, fillcolor=lightblue];
+  "pihole" [color=gray, fontcolor=gray];
+  "external-dns" -> "cilium";
+  "external-dns" -> "pihole" [color=red, label="cycle"];
+  "pihole" -> "external-dns" [color=red, label="cycle"];
+}
+`,
+		},
+		{
+			name:   "mermaid",
+			render: func() string { return dependencyGraphMermaid(site) },
+			want: `flowchart LR
+  classDef enabled fill:#add8e6
+  classDef disabled color:#808080
+  classDef missing stroke-dasharray:3
+  app0["cilium (missing)"]:::missing
+  app1["external-dns"]:::enabled
+  app2["pihole"]:::disabled
+  app1 --> app0
+  app1 -->|cycle| app2
+  linkStyle 1 stroke:red
+  app2 -->|cycle| app1
+  linkStyle 2 stroke:red
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.render(); got != tt.want {
+				t.Errorf("graph =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
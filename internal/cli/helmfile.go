@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/bamaas/klabctl/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// HelmChart represents the HelmChartInflationGenerator shipped in an app base (helm-chart.yaml)
+type HelmChart struct {
+	Name                  string   `yaml:"name"`
+	Repo                  string   `yaml:"repo"`
+	Version               string   `yaml:"version"`
+	ReleaseName           string   `yaml:"releaseName"`
+	ValuesFile            string   `yaml:"valuesFile"`
+	AdditionalValuesFiles []string `yaml:"additionalValuesFiles"`
+}
+
+// Helmfile is the subset of the helmfile.yaml structure generated by klabctl
+type Helmfile struct {
+	Repositories []HelmfileRepository `yaml:"repositories"`
+	Releases     []HelmfileRelease    `yaml:"releases"`
+}
+
+// HelmfileRepository defines a chart repository in helmfile.yaml
+type HelmfileRepository struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+}
+
+// HelmfileRelease defines a single release in helmfile.yaml
+type HelmfileRelease struct {
+	Name      string   `yaml:"name"`
+	Namespace string   `yaml:"namespace"`
+	Chart     string   `yaml:"chart"`
+	Version   string   `yaml:"version"`
+	Values    []string `yaml:"values,omitempty"`
+}
+
+// loadAppHelmChart reads the helm-chart.yaml from an app base in the cache
+// Returns nil if the app base does not ship a helm chart
+func loadAppHelmChart(site *config.Site, opts generateOptions, appName string) (*HelmChart, error) {
+	baseDir, err := getAppBaseDir(site, opts, appName)
+	if err != nil {
+		return nil, err
+	}
+
+	chartPath := filepath.Join(baseDir, "helm-chart.yaml")
+	data, err := os.ReadFile(chartPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", chartPath, err)
+	}
+
+	var chart HelmChart
+	if err := yaml.Unmarshal(data, &chart); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", chartPath, err)
+	}
+
+	return &chart, nil
+}
+
+// generateHelmfile generates clusters/{site}/helmfile.yaml listing a release per enabled helm based component
+func generateHelmfile(site *config.Site, opts generateOptions) (int, error) {
+	clusterDir := filepath.Join("clusters", site.Metadata.Name)
+
+	// Sort component names for a deterministic helmfile
+	var componentNames []string
+	for componentName, component := range site.Spec.Apps.Catalog {
+		if component.Enabled {
+			componentNames = append(componentNames, componentName)
+		}
+	}
+	sort.Strings(componentNames)
+
+	helmfile := Helmfile{}
+	// Repository names by URL, charts sharing a repository reuse the first registered name
+	repositories := make(map[string]string)
+	for _, componentName := range componentNames {
+		component := site.Spec.Apps.Catalog[componentName]
+
+		chart, err := loadAppHelmChart(site, opts, componentName)
+		if err != nil {
+			return 0, err
+		}
+		if chart == nil {
+			warnf("Skipping %s: app base has no helm-chart.yaml", componentName)
+			continue
+		}
+
+		// Copy app base so the values files referenced by the release exist
+		if err := copyAppBase(site, opts, componentName); err != nil {
+			return 0, fmt.Errorf("failed to copy base for %s: %w", componentName, err)
+		}
+
+		repoName, ok := repositories[chart.Repo]
+		if !ok {
+			repoName = chart.Name
+			repositories[chart.Repo] = repoName
+			helmfile.Repositories = append(helmfile.Repositories, HelmfileRepository{
+				Name: repoName,
+				URL:  chart.Repo,
+			})
+		}
+
+		releaseName := chart.ReleaseName
+		if releaseName == "" {
+			releaseName = componentName
+		}
+
+		// Values paths are relative to the helmfile.yaml in the cluster directory
+		componentPath := filepath.Join("apps", component.Project, component.Namespace, componentName)
+		var values []string
+		if chart.ValuesFile != "" {
+			values = append(values, filepath.Join(componentPath, "base", chart.ValuesFile))
+		}
+		customValuesPath := filepath.Join(componentPath, site.Spec.Layout.CustomDir, "values.yaml")
+		if _, err := os.Stat(filepath.Join(clusterDir, customValuesPath)); err == nil {
+			values = append(values, customValuesPath)
+		}
+
+		helmfile.Releases = append(helmfile.Releases, HelmfileRelease{
+			Name:      releaseName,
+			Namespace: component.Namespace,
+			Chart:     repoName + "/" + chart.Name,
+			Version:   chart.Version,
+			Values:    values,
+		})
+	}
+
+	data, err := yaml.Marshal(helmfile)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal helmfile: %w", err)
+	}
+
+	helmfilePath := filepath.Join(clusterDir, "helmfile.yaml")
+	if err := writeOutputFile(helmfilePath, append([]byte("---\n"), data...)); err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", helmfilePath, err)
+	}
+
+	return len(helmfile.Releases), nil
+}
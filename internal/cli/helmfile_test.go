@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestGenerateHelmfile(t *testing.T) {
+	piholeChart := "name: pihole\nrepo: https://charts.example.com\nversion: 2.0.0\nvaluesFile: values.yaml\n"
+	dnsChart := "name: external-dns\nrepo: https://charts.example.com\nversion: 1.0.0\nreleaseName: dns\n"
+
+	tests := []struct {
+		name         string
+		charts       map[string]string
+		customValues bool
+		want         Helmfile
+		wantWarnings int
+	}{
+		{
+			name:   "app without chart is skipped",
+			charts: map[string]string{"pihole": piholeChart},
+			want: Helmfile{
+				Repositories: []HelmfileRepository{{Name: "pihole", URL: "https://charts.example.com"}},
+				Releases: []HelmfileRelease{
+					{Name: "pihole", Namespace: "apps", Chart: "pihole/pihole", Version: "2.0.0", Values: []string{"apps/system/apps/pihole/base/values.yaml"}},
+				},
+			},
+			wantWarnings: 1,
+		},
+		{
+			name:   "shared repository",
+			charts: map[string]string{"pihole": piholeChart, "external-dns": dnsChart},
+			want: Helmfile{
+				Repositories: []HelmfileRepository{{Name: "external-dns", URL: "https://charts.example.com"}},
+				Releases: []HelmfileRelease{
+					{Name: "dns", Namespace: "apps", Chart: "external-dns/external-dns", Version: "1.0.0"},
+					{Name: "pihole", Namespace: "apps", Chart: "external-dns/pihole", Version: "2.0.0", Values: []string{"apps/system/apps/pihole/base/values.yaml"}},
+				},
+			},
+		},
+		{
+			name:         "custom values",
+			charts:       map[string]string{"pihole": piholeChart, "external-dns": dnsChart},
+			customValues: true,
+			want: Helmfile{
+				Repositories: []HelmfileRepository{{Name: "external-dns", URL: "https://charts.example.com"}},
+				Releases: []HelmfileRelease{
+					{Name: "dns", Namespace: "apps", Chart: "external-dns/external-dns", Version: "1.0.0"},
+					{Name: "pihole", Namespace: "apps", Chart: "external-dns/pihole", Version: "2.0.0", Values: []string{"apps/system/apps/pihole/base/values.yaml", "apps/system/apps/pihole/custom/values.yaml"}},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := useTestStack(t, testStackApps)
+			for app, chart := range tt.charts {
+				writeTestFile(t, filepath.Join(cacheDir, "stack", "apps", app, "base", "helm-chart.yaml"), chart)
+			}
+			if tt.customValues {
+				writeTestFile(t, filepath.Join("clusters", "demo", "apps", "system", "apps", "pihole", "custom", "values.yaml"), "{}\n")
+			}
+			warningCount = 0
+			t.Cleanup(func() { warningCount = 0 })
+
+			count, err := generateHelmfile(parseTestSite(t, testSiteYaml), generateOptions{})
+			if err != nil {
+				t.Fatalf("generateHelmfile: %v", err)
+			}
+
+			var got Helmfile
+			if err := yaml.Unmarshal([]byte(readTestFile(t, filepath.Join("clusters", "demo", "helmfile.yaml"))), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("helmfile = %+v, want %+v", got, tt.want)
+			}
+			if count != len(tt.want.Releases) {
+				t.Errorf("count = %d, want %d", count, len(tt.want.Releases))
+			}
+			if warningCount != tt.wantWarnings {
+				t.Errorf("warnings = %d, want %d", warningCount, tt.wantWarnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package cli
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/bamaas/klabctl/internal/config"
+)
+
+// testStackRef is the ref the test stack is cached under
+const testStackRef = "main"
+
+// testApp describes an app of the test stack
+type testApp struct {
+	// Values is the stack's values.yaml of the app
+	Values string
+	// Template, when set, is the app's templates/kustomization.yaml.tmpl
+	Template string
+}
+
+// useTestStack switches to an empty working directory with a cached stack for ref main holding the
+// repository's stack templates and infra, and a kustomize base per app. It returns the cache directory.
+func useTestStack(t testing.TB, apps map[string]testApp) string {
+	t.Helper()
+
+	repoStackDir, err := filepath.Abs(filepath.Join("..", "..", "stack"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(t.TempDir())
+
+	cacheDir := filepath.Join(stackCacheDirRoot, testStackRef)
+	stackDir := filepath.Join(cacheDir, "stack")
+	for _, dir := range []string{"templates", "infra"} {
+		if err := copyDir(filepath.Join(repoStackDir, dir), filepath.Join(stackDir, dir)); err != nil {
+			t.Fatalf("copy stack %s: %v", dir, err)
+		}
+	}
+
+	for name, app := range apps {
+		appDir := filepath.Join(stackDir, "apps", name)
+		writeTestFile(t, filepath.Join(appDir, "base", "kustomization.yaml"), "resources: []\n")
+		writeTestFile(t, filepath.Join(appDir, "meta.yaml"), "enabled: true\n")
+		if app.Values != "" {
+			writeTestFile(t, filepath.Join(appDir, "values.yaml"), app.Values)
+		}
+		if app.Template != "" {
+			writeTestFile(t, filepath.Join(appDir, "templates", "kustomization.yaml.tmpl"), app.Template)
+		}
+	}
+	if len(apps) == 0 {
+		if err := os.MkdirAll(filepath.Join(stackDir, "apps"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return cacheDir
+}
+
+// commitTestStack turns the test stack cache into a git repository on branch main, skipping without git
+func commitTestStack(t testing.TB, cacheDir string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	runTestGit(t, cacheDir, "init", "-q", "-b", testStackRef)
+	runTestGit(t, cacheDir, "add", "-A")
+	runTestGit(t, cacheDir, "commit", "-q", "-m", "stack")
+}
+
+// runTestGit runs git in dir with a fixed identity
+func runTestGit(t testing.TB, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, output)
+	}
+	return string(output)
+}
+
+// writeTestFile writes content to path, creating its directory
+func writeTestFile(t testing.TB, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readTestFile returns the content of path
+func readTestFile(t testing.TB, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// parseTestSite parses a site.yaml, failing the test on errors
+func parseTestSite(t testing.TB, siteYaml string) *config.Site {
+	t.Helper()
+	site, err := config.ParseSite([]byte(siteYaml))
+	if err != nil {
+		t.Fatalf("parse site: %v", err)
+	}
+	return site
+}
+
+// testSiteYaml is a site with two apps on the test stack, external-dns reads the values of pihole
+const testSiteYaml = `apiVersion: klab/v1alpha1
+kind: Site
+metadata:
+  name: demo
+spec:
+  stack:
+    source: https://example.com/stack.git
+    ref: main
+  infra:
+    provider: proxmox
+    providers:
+      proxmox:
+        endpoint: https://pve.example.local:8006/api2/json
+        cluster:
+          endpoint: https://192.168.1.10:6443
+        nodeData:
+          controlPlanes:
+          - ip: 192.168.1.10
+            hostname: cp-1
+            pveId: 5000
+  apps:
+    defaults:
+      project: system
+      namespace: apps
+    catalog:
+      pihole:
+        enabled: true
+        values:
+          host: pihole.lan
+      external-dns:
+        enabled: true
+        values:
+          interval: 1m
+`
+
+// testStackApps are the apps of testSiteYaml
+var testStackApps = map[string]testApp{
+	"pihole":       {Values: "host: pihole.local\n"},
+	"external-dns": {Values: "interval: 5m\n", Template: "{{- template \"base\" . }}\n# pihole: {{ .AllComponents.pihole.Values.host }}\n"},
+}
+
+// captureStdout returns what fn writes to os.Stdout
+func captureStdout(t testing.TB, fn func()) string {
+	t.Helper()
+	return captureOutput(t, &os.Stdout, fn)
+}
+
+// captureStderr returns what fn writes to os.Stderr
+func captureStderr(t testing.TB, fn func()) string {
+	t.Helper()
+	return captureOutput(t, &os.Stderr, fn)
+}
+
+// captureOutput returns what fn writes to the file *target points to
+func captureOutput(t testing.TB, target **os.File, fn func()) string {
+	t.Helper()
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := *target
+	*target = writer
+	defer func() { *target = original }()
+
+	output := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(reader)
+		output <- string(data)
+	}()
+	fn()
+	writer.Close()
+	return <-output
+}
+
+// writeTestSite writes siteYaml to clusters/demo/site.yaml
+func writeTestSite(t testing.TB, siteYaml string) {
+	t.Helper()
+	writeTestFile(t, filepath.Join("clusters", "demo", "site.yaml"), siteYaml)
+}
+
+// runTestGenerate runs generate with args on clusters/demo/site.yaml and returns what it printed to stdout
+func runTestGenerate(t testing.TB, args ...string) (string, error) {
+	t.Helper()
+	sitePath = filepath.Join("clusters", "demo", "site.yaml")
+	warningCount = 0
+	t.Cleanup(func() {
+		sitePath, warningCount = "", 0
+	})
+
+	cmd := newGenerateCmd()
+	cmd.SetArgs(args)
+	cmd.SilenceUsage = true
+	cmd.SilenceErrors = true
+
+	var err error
+	output := captureStdout(t, func() { err = cmd.Execute() })
+	return output, err
+}
+
+// runTestGetDefaults runs get defaults with args and returns what it printed to stdout and stderr
+func runTestGetDefaults(t testing.TB, args ...string) (string, string, error) {
+	t.Helper()
+	cmd := newGetDefaultsCmd()
+	cmd.SetArgs(args)
+	cmd.SilenceUsage = true
+	cmd.SilenceErrors = true
+
+	var err error
+	var stdout string
+	stderr := captureStderr(t, func() {
+		stdout = captureStdout(t, func() { err = cmd.Execute() })
+	})
+	return stdout, stderr, err
+}
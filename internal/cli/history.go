@@ -0,0 +1,303 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	// historyFilePath is the run record of the commands that change the project
+	historyFilePath = filepath.Join(hiddenKlabctlDir, "history.jsonl")
+	// historyMaxSize is the size in bytes after which the history is rotated to history.jsonl.1
+	historyMaxSize int64 = 1 << 20
+)
+
+// historyCommands are the commands recorded in the history
+var historyCommands = map[string]bool{
+	"generate":  true,
+	"provision": true,
+	"init":      true,
+	"pull":      true,
+	"migrate":   true,
+}
+
+// historyRecord is a single line of the history
+type historyRecord struct {
+	Time         time.Time `json:"time"`
+	Command      string    `json:"command"`
+	Site         string    `json:"site,omitempty"`
+	Ref          string    `json:"ref,omitempty"`
+	FilesChanged *int      `json:"filesChanged,omitempty"`
+	Outcome      string    `json:"outcome"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// historyRunKey is the command context key of the historyRun of a recorded command
+type historyRunKey struct{}
+
+// historyRun collects what is recorded about a command while it runs
+type historyRun struct {
+	// snapshot holds the clusters/ file hashes taken before the command runs, nil when the command
+	// doesn't write clusters/
+	snapshot map[string][32]byte
+	// ref is the stack ref of the site the command loaded
+	ref string
+}
+
+func newHistoryCmd() *cobra.Command {
+	var limit int
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Show the recent operations recorded in .klabctl/history.jsonl",
+		Long: `Show the recent generate, provision, init, pull and migrate runs of this project.
+
+Every run of these commands appends a record (time, command, site, stack ref and outcome)
+to .klabctl/history.jsonl. Runs of generate, init and migrate also record the number of
+changed files under clusters/.
+
+Examples:
+  # Show the last 20 operations
+  klabctl history
+
+  # Show the last 5 operations as JSON
+  klabctl history -n 5 -o json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			records, err := readHistory(historyFilePath)
+			if err != nil {
+				return err
+			}
+			if limit > 0 && len(records) > limit {
+				records = records[len(records)-limit:]
+			}
+
+			switch output {
+			case "text":
+				if len(records) == 0 {
+					fmt.Println("No operations recorded")
+					return nil
+				}
+				for _, record := range records {
+					line := fmt.Sprintf("%s  %-9s  %-7s", record.Time.Local().Format(time.RFC3339), record.Command, record.Outcome)
+					if record.FilesChanged != nil {
+						line += fmt.Sprintf("  files=%d", *record.FilesChanged)
+					}
+					if record.Site != "" {
+						line += "  site=" + record.Site
+					}
+					if record.Ref != "" {
+						line += "  ref=" + record.Ref
+					}
+					if record.Error != "" {
+						line += "  error=" + record.Error
+					}
+					fmt.Println(line)
+				}
+			case "json":
+				if records == nil {
+					records = []historyRecord{}
+				}
+				data, err := json.MarshalIndent(records, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to marshal history: %w", err)
+				}
+				fmt.Println(string(data))
+			default:
+				return fmt.Errorf("unsupported output format '%s' (supported: text, json)", output)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVarP(&limit, "limit", "n", 20, "Number of most recent operations to show (0 shows all)")
+	cmd.Flags().StringVarP(&output, "output", "o", "text", "Output format: text or json")
+
+	return cmd
+}
+
+// startHistory attaches a historyRun to a recorded command, snapshotting clusters/ when the command writes it
+func startHistory(cmd *cobra.Command) {
+	if !historyCommands[cmd.Name()] {
+		return
+	}
+	run := &historyRun{}
+	if writesClusters(cmd) {
+		run.snapshot = hashClusterFiles()
+	}
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	cmd.SetContext(context.WithValue(ctx, historyRunKey{}, run))
+}
+
+// writesClusters reports whether a run of a recorded command changes files under clusters/
+func writesClusters(cmd *cobra.Command) bool {
+	switch cmd.Name() {
+	case "generate", "init":
+		return true
+	case "migrate":
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		return !dryRun
+	}
+	return false
+}
+
+// historyRunOf returns the historyRun of a recorded command, or nil
+func historyRunOf(cmd *cobra.Command) *historyRun {
+	if cmd == nil || cmd.Context() == nil {
+		return nil
+	}
+	run, _ := cmd.Context().Value(historyRunKey{}).(*historyRun)
+	return run
+}
+
+// setHistoryRef records the stack ref of the site a recorded command works on
+func setHistoryRef(cmd *cobra.Command, ref string) {
+	if run := historyRunOf(cmd); run != nil {
+		run.ref = ref
+	}
+}
+
+// recordHistory appends the outcome of a recorded command to the history
+// Failing to record is reported but never fails the command itself
+func recordHistory(cmd *cobra.Command, runErr error) {
+	run := historyRunOf(cmd)
+	if run == nil {
+		return
+	}
+
+	record := historyRecord{
+		Time:    time.Now().UTC(),
+		Command: cmd.Name(),
+		Site:    sitePath,
+		Ref:     run.ref,
+		Outcome: "success",
+	}
+	if run.snapshot != nil {
+		changed := countChangedFiles(run.snapshot, hashClusterFiles())
+		record.FilesChanged = &changed
+	}
+	if runErr != nil {
+		record.Outcome = "failure"
+		record.Error = runErr.Error()
+	}
+
+	if err := appendHistory(historyFilePath, record); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record history: %v\n", err)
+	}
+}
+
+// appendHistory appends a record to the history file, rotating it once it exceeds historyMaxSize
+func appendHistory(path string, record historyRecord) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	if info, err := os.Stat(path); err == nil && info.Size() >= historyMaxSize {
+		if err := os.Rename(path, path+".1"); err != nil {
+			return fmt.Errorf("failed to rotate %s: %w", path, err)
+		}
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// readHistory reads the records of the rotated and the current history file, oldest first
+func readHistory(path string) ([]historyRecord, error) {
+	var records []historyRecord
+	for _, file := range []string{path + ".1", path} {
+		f, err := os.Open(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(f)
+		for line := 1; scanner.Scan(); line++ {
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+			var record historyRecord
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				f.Close()
+				return nil, fmt.Errorf("failed to parse %s line %d: %w", file, line, err)
+			}
+			records = append(records, record)
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+	}
+
+	return records, nil
+}
+
+// hashClusterFiles returns the content hash of every file under clusters/, terraform working files excluded
+func hashClusterFiles() map[string][32]byte {
+	hashes := make(map[string][32]byte)
+	filepath.WalkDir("clusters", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if d.Name() == ".terraform" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		hashes[path] = sha256.Sum256(data)
+		return nil
+	})
+	return hashes
+}
+
+// countChangedFiles returns the number of files added, modified or removed between two snapshots
+func countChangedFiles(before, after map[string][32]byte) int {
+	changed := 0
+	for path, hash := range after {
+		if previous, ok := before[path]; !ok || previous != hash {
+			changed++
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changed++
+		}
+	}
+	return changed
+}
@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func TestCountChangedFiles(t *testing.T) {
+	a, b := [32]byte{1}, [32]byte{2}
+
+	tests := []struct {
+		name   string
+		before map[string][32]byte
+		after  map[string][32]byte
+		want   int
+	}{
+		{name: "unchanged", before: map[string][32]byte{"x": a}, after: map[string][32]byte{"x": a}, want: 0},
+		{name: "added", before: map[string][32]byte{}, after: map[string][32]byte{"x": a}, want: 1},
+		{name: "modified", before: map[string][32]byte{"x": a}, after: map[string][32]byte{"x": b}, want: 1},
+		{name: "removed", before: map[string][32]byte{"x": a, "y": b}, after: map[string][32]byte{"x": a}, want: 1},
+		{name: "all kinds", before: map[string][32]byte{"x": a, "y": b}, after: map[string][32]byte{"x": b, "z": a}, want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := countChangedFiles(tt.before, tt.after); got != tt.want {
+				t.Errorf("countChangedFiles = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppendHistoryRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	previousMaxSize := historyMaxSize
+	// Every record exceeds the limit, so each append rotates the previous one
+	historyMaxSize = 10
+	t.Cleanup(func() { historyMaxSize = previousMaxSize })
+
+	commands := []string{"init", "pull", "generate", "provision"}
+	for _, command := range commands {
+		if err := appendHistory(path, historyRecord{Time: time.Unix(0, 0).UTC(), Command: command, Outcome: "success"}); err != nil {
+			t.Fatalf("appendHistory: %v", err)
+		}
+	}
+
+	// Only the current and the last rotated file are kept
+	records, err := readHistory(path)
+	if err != nil {
+		t.Fatalf("readHistory: %v", err)
+	}
+	if len(records) != 2 || records[0].Command != "generate" || records[1].Command != "provision" {
+		t.Errorf("records = %+v, want generate and provision", records)
+	}
+}
+
+func TestReadHistoryInvalidLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	writeTestFile(t, path, "{\"command\":\"pull\"}\n\nnot json\n")
+
+	if _, err := readHistory(path); err == nil {
+		t.Error("readHistory succeeded on an invalid line")
+	}
+}
+
+func TestRecordHistory(t *testing.T) {
+	tests := []struct {
+		name        string
+		command     string
+		args        []string
+		runErr      error
+		wantRecord  bool
+		wantOutcome string
+		wantFiles   *int
+	}{
+		{name: "generate counts changed files", command: "generate", wantRecord: true, wantOutcome: "success", wantFiles: intPtr(1)},
+		{name: "failed provision", command: "provision", runErr: errors.New("terraform apply failed"), wantRecord: true, wantOutcome: "failure"},
+		{name: "pull doesn't hash clusters", command: "pull", wantRecord: true, wantOutcome: "success"},
+		{name: "migrate counts changed files", command: "migrate", wantRecord: true, wantOutcome: "success", wantFiles: intPtr(1)},
+		{name: "migrate dry run doesn't hash clusters", command: "migrate", args: []string{"--dry-run"}, wantRecord: true, wantOutcome: "success"},
+		{name: "read-only command", command: "status"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			writeTestSite(t, testSiteYaml)
+			sitePath = filepath.Join("clusters", "demo", "site.yaml")
+			t.Cleanup(func() { sitePath = "" })
+			cmd := &cobra.Command{Use: tt.command}
+			cmd.Flags().Bool("dry-run", false, "")
+			if err := cmd.ParseFlags(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			startHistory(cmd)
+			// The ref comes from the site the command loaded, site.yaml isn't read again
+			setHistoryRef(cmd, "v1.2.0")
+			writeTestFile(t, filepath.Join("clusters", "demo", "generated", "kustomization.yaml"), "resources: []\n")
+			recordHistory(cmd, tt.runErr)
+
+			records, err := readHistory(historyFilePath)
+			if err != nil {
+				t.Fatalf("readHistory: %v", err)
+			}
+			if !tt.wantRecord {
+				if len(records) != 0 {
+					t.Errorf("recorded %+v, want no record", records)
+				}
+				return
+			}
+			if len(records) != 1 {
+				t.Fatalf("recorded %d records, want 1", len(records))
+			}
+			record := records[0]
+			if record.Command != tt.command || record.Outcome != tt.wantOutcome || record.Ref != "v1.2.0" {
+				t.Errorf("record = %+v, want %s %s on ref v1.2.0", record, tt.command, tt.wantOutcome)
+			}
+			if !reflect.DeepEqual(record.FilesChanged, tt.wantFiles) {
+				t.Errorf("files changed = %v, want %v", record.FilesChanged, tt.wantFiles)
+			}
+			if tt.runErr != nil && record.Error != tt.runErr.Error() {
+				t.Errorf("record error = %q, want %q", record.Error, tt.runErr.Error())
+			}
+		})
+	}
+}
+
+// intPtr returns a pointer to n
+func intPtr(n int) *int {
+	return &n
+}
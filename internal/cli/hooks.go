@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/bamaas/klabctl/internal/config"
+)
+
+// postRenderHookWarned records that the skipped hook warning was emitted
+var postRenderHookWarned bool
+
+// getPostRenderHookPath returns the path of the stack's post-render hook in cache
+func getPostRenderHookPath(site *config.Site, opts generateOptions) string {
+	return filepath.Join(getStackRoot(site, opts), "hooks", "post-render")
+}
+
+// runPostRenderHook runs the stack's hooks/post-render executable with the component's generated directory as argument
+// Hooks come from the stack repository, so they only run with opts.enableHooks; otherwise a warning is emitted once
+func runPostRenderHook(site *config.Site, opts generateOptions, componentName, generatedPath string) error {
+	hookPath := getPostRenderHookPath(site, opts)
+	info, err := os.Stat(hookPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !opts.enableHooks {
+		if !postRenderHookWarned {
+			postRenderHookWarned = true
+			warnf("Stack ships a post-render hook, skipped (run with --enable-hooks to execute it)")
+		}
+		return nil
+	}
+
+	if info.IsDir() || info.Mode().Perm()&0111 == 0 {
+		return fmt.Errorf("%s is not an executable file", hookPath)
+	}
+
+	absHookPath, err := filepath.Abs(hookPath)
+	if err != nil {
+		return err
+	}
+	absGeneratedPath, err := filepath.Abs(generatedPath)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(absHookPath, absGeneratedPath)
+	cmd.Env = append(os.Environ(),
+		"KLABCTL_CLUSTER="+site.Metadata.Name,
+		"KLABCTL_COMPONENT="+componentName,
+	)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w", hookPath, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunPostRenderHook(t *testing.T) {
+	tests := []struct {
+		name         string
+		hook         string
+		mode         os.FileMode
+		enabled      bool
+		wantRan      bool
+		wantWarnings int
+		wantError    string
+	}{
+		{name: "no hook", enabled: true},
+		{name: "disabled hook warns", hook: "#!/bin/sh\ntouch \"$1/hook-ran\"\n", mode: 0755, enabled: false, wantWarnings: 1},
+		{name: "enabled hook runs", hook: "#!/bin/sh\n[ \"$KLABCTL_COMPONENT\" = pihole ] && touch \"$1/hook-ran\"\n", mode: 0755, enabled: true, wantRan: true},
+		{name: "failing hook", hook: "#!/bin/sh\nexit 3\n", mode: 0755, enabled: true, wantError: "exit status 3"},
+		{name: "not executable", hook: "#!/bin/sh\n", mode: 0644, enabled: true, wantError: "is not an executable file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestStack(t, testStackApps)
+			site := parseTestSite(t, testSiteYaml)
+			if tt.hook != "" {
+				hookPath := getPostRenderHookPath(site, generateOptions{})
+				writeTestFile(t, hookPath, tt.hook)
+				if err := os.Chmod(hookPath, tt.mode); err != nil {
+					t.Fatal(err)
+				}
+			}
+			generatedPath := filepath.Join("clusters", "demo", "generated")
+			if err := os.MkdirAll(generatedPath, 0755); err != nil {
+				t.Fatal(err)
+			}
+			warningCount, postRenderHookWarned = 0, false
+			t.Cleanup(func() { warningCount, postRenderHookWarned = 0, false })
+
+			// The skipped hook warning is emitted once per run
+			var err error
+			for i := 0; i < 2 && err == nil; i++ {
+				err = runPostRenderHook(site, generateOptions{enableHooks: tt.enabled}, "pihole", generatedPath)
+			}
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("runPostRenderHook: %v", err)
+			}
+
+			_, statErr := os.Stat(filepath.Join(generatedPath, "hook-ran"))
+			if ran := statErr == nil; ran != tt.wantRan {
+				t.Errorf("hook ran = %t, want %t", ran, tt.wantRan)
+			}
+			if warningCount != tt.wantWarnings {
+				t.Errorf("warnings = %d, want %d", warningCount, tt.wantWarnings)
+			}
+		})
+	}
+}
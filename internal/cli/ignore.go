@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFileName is the file in a copied base listing the files to leave out of the copy
+const ignoreFileName = ".klabctlignore"
+
+// ignorePattern is a single gitignore-style pattern
+type ignorePattern struct {
+	pattern string
+	// negate re-includes matching paths (!pattern)
+	negate bool
+	// dirOnly only matches directories (pattern/)
+	dirOnly bool
+	// anchored matches against the path relative to the base instead of any path element (/pattern or a/b)
+	anchored bool
+}
+
+// ignoreRules are the patterns of a .klabctlignore, later patterns take precedence
+type ignoreRules []ignorePattern
+
+// loadIgnoreRules reads the .klabctlignore in dir, no rules are returned if it doesn't exist
+func loadIgnoreRules(dir string) (ignoreRules, error) {
+	file, err := os.Open(filepath.Join(dir, ignoreFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rules ignoreRules
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule ignorePattern
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		// A leading **/ matches in any directory, like a pattern without a slash
+		line = strings.TrimPrefix(line, "**/")
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+
+	return rules, scanner.Err()
+}
+
+// ignored reports whether relPath (slash separated, relative to the base) is excluded
+func (rules ignoreRules) ignored(relPath string, isDir bool) bool {
+	ignored := false
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.matches(relPath) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// matches reports whether the pattern matches relPath
+func (rule ignorePattern) matches(relPath string) bool {
+	if rule.anchored {
+		// A trailing /** matches everything below the directory
+		if prefix, ok := strings.CutSuffix(rule.pattern, "/**"); ok {
+			matched, _ := path.Match(prefix, relPath)
+			return matched || strings.HasPrefix(relPath, prefix+"/")
+		}
+		matched, _ := path.Match(rule.pattern, relPath)
+		return matched
+	}
+
+	matched, _ := path.Match(rule.pattern, path.Base(relPath))
+	return matched
+}
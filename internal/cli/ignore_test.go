@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	tests := []struct {
+		name   string
+		rules  string
+		path   string
+		isDir  bool
+		ignore bool
+	}{
+		{name: "no rules", rules: "", path: "README.md", ignore: false},
+		{name: "name in any directory", rules: "*.md\n", path: "docs/README.md", ignore: true},
+		{name: "comments and blank lines", rules: "# docs\n\n*.md\n", path: "README.md", ignore: true},
+		{name: "other name", rules: "*.md\n", path: "values.yaml", ignore: false},
+		{name: "negation", rules: "*.md\n!KEEP.md\n", path: "KEEP.md", ignore: false},
+		{name: "later pattern wins", rules: "!KEEP.md\n*.md\n", path: "KEEP.md", ignore: true},
+		{name: "directory only matches a directory", rules: "tests/\n", path: "tests", isDir: true, ignore: true},
+		{name: "directory only skips a file", rules: "tests/\n", path: "tests", ignore: false},
+		{name: "anchored", rules: "/README.md\n", path: "README.md", ignore: true},
+		{name: "anchored skips nested", rules: "/README.md\n", path: "docs/README.md", ignore: false},
+		{name: "path with slash is anchored", rules: "docs/*.md\n", path: "docs/README.md", ignore: true},
+		{name: "leading double star", rules: "**/README.md\n", path: "a/b/README.md", ignore: true},
+		{name: "trailing double star", rules: "docs/**\n", path: "docs/a/b.md", ignore: true},
+		{name: "trailing double star other directory", rules: "docs/**\n", path: "src/docs.md", ignore: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.rules != "" {
+				writeTestFile(t, filepath.Join(dir, ignoreFileName), tt.rules)
+			}
+			rules, err := loadIgnoreRules(dir)
+			if err != nil {
+				t.Fatalf("loadIgnoreRules: %v", err)
+			}
+
+			if got := rules.ignored(tt.path, tt.isDir); got != tt.ignore {
+				t.Errorf("ignored(%s) = %t, want %t", tt.path, got, tt.ignore)
+			}
+		})
+	}
+}
+
+func TestCopyDirIgnoresFiles(t *testing.T) {
+	src := t.TempDir()
+	for _, path := range []string{"kustomization.yaml", "README.md", "tests/test.yaml", "charts/values.yaml"} {
+		writeTestFile(t, filepath.Join(src, filepath.FromSlash(path)), "# "+path+"\n")
+	}
+	writeTestFile(t, filepath.Join(src, ignoreFileName), "*.md\ntests/\n")
+	dst := filepath.Join(t.TempDir(), "base")
+
+	if err := copyDir(src, dst); err != nil {
+		t.Fatalf("copyDir: %v", err)
+	}
+
+	tests := []struct {
+		path   string
+		copied bool
+	}{
+		{path: "kustomization.yaml", copied: true},
+		{path: "charts/values.yaml", copied: true},
+		{path: "README.md", copied: false},
+		{path: "tests", copied: false},
+		{path: ignoreFileName, copied: false},
+	}
+	for _, tt := range tests {
+		_, err := os.Stat(filepath.Join(dst, filepath.FromSlash(tt.path)))
+		if copied := err == nil; copied != tt.copied {
+			t.Errorf("%s copied = %t, want %t", tt.path, copied, tt.copied)
+		}
+	}
+}
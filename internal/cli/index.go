@@ -0,0 +1,97 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bamaas/klabctl/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// AppMeta represents an app's meta.yaml in the stack
+type AppMeta struct {
+	Enabled     bool   `yaml:"enabled"`
+	Project     string `yaml:"project"`
+	Namespace   string `yaml:"namespace"`
+	Description string `yaml:"description"`
+}
+
+// loadAppMeta reads an app's meta.yaml from the cache, a missing file yields an empty AppMeta
+func loadAppMeta(site *config.Site, opts generateOptions, appName string) (*AppMeta, error) {
+	metaPath := filepath.Join(getStackAppsDir(site, opts), appName, "meta.yaml")
+	var meta AppMeta
+
+	data, err := os.ReadFile(metaPath)
+	if os.IsNotExist(err) {
+		return &meta, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", metaPath, err)
+	}
+
+	if err := yaml.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", metaPath, err)
+	}
+
+	return &meta, nil
+}
+
+// generateClusterIndex writes clusters/{site}/README.md listing every enabled app
+// Apps are sorted by name so the index only changes when the catalog does
+func generateClusterIndex(site *config.Site, opts generateOptions) error {
+	var appNames []string
+	for appName, component := range site.Spec.Apps.Catalog {
+		if component.Enabled {
+			appNames = append(appNames, appName)
+		}
+	}
+	sort.Strings(appNames)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", site.Metadata.Name)
+	fmt.Fprintln(&b, "<!-- Generated by klabctl, do not edit -->")
+	fmt.Fprintln(&b)
+	fmt.Fprintf(&b, "Stack: `%s@%s`\n\n", site.Spec.Stack.Source, site.Spec.Stack.Ref)
+	fmt.Fprintln(&b, "| App | Type | Project | Namespace | Version | Description |")
+	fmt.Fprintln(&b, "| --- | --- | --- | --- | --- | --- |")
+
+	for _, appName := range appNames {
+		component := site.Spec.Apps.Catalog[appName]
+
+		meta, err := loadAppMeta(site, opts, appName)
+		if err != nil {
+			return err
+		}
+
+		chart, err := loadAppHelmChart(site, opts, appName)
+		if err != nil {
+			return err
+		}
+		version := "-"
+		if chart != nil && chart.Version != "" {
+			version = chart.Version
+		}
+
+		description := meta.Description
+		if description == "" {
+			description = "-"
+		}
+
+		appType := "-"
+		if base, err := detectAppBase(site, opts, appName); err == nil {
+			appType = base.Type
+		}
+
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %s |\n", appName, appType, component.Project, component.Namespace, version, description)
+	}
+
+	indexPath := filepath.Join("clusters", site.Metadata.Name, "README.md")
+	if err := writeOutputFile(indexPath, []byte(b.String())); err != nil {
+		return fmt.Errorf("failed to write %s: %w", indexPath, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateClusterIndex(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		disable string
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "kustomize apps",
+			want: []string{
+				"| external-dns | kustomize | system | apps | - | - |\n| pihole | kustomize | system | apps | - | - |\n",
+				"Stack: `https://example.com/stack.git@main`",
+			},
+		},
+		{
+			name: "description and chart version",
+			files: map[string]string{
+				"pihole/meta.yaml":            "enabled: true\ndescription: DNS sinkhole\n",
+				"pihole/base/helm-chart.yaml": "name: pihole\nversion: 2.0.0\n",
+			},
+			want: []string{"| pihole | helm | system | apps | 2.0.0 | DNS sinkhole |\n"},
+		},
+		{
+			name:    "disabled apps are left out",
+			disable: "pihole",
+			want:    []string{"| external-dns |"},
+			notWant: []string{"| pihole |"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := useTestStack(t, testStackApps)
+			for path, content := range tt.files {
+				writeTestFile(t, filepath.Join(cacheDir, "stack", "apps", filepath.FromSlash(path)), content)
+			}
+			// The index is written after the cluster directory was rendered
+			writeTestSite(t, testSiteYaml)
+			site := parseTestSite(t, testSiteYaml)
+			if tt.disable != "" {
+				component := site.Spec.Apps.Catalog[tt.disable]
+				component.Enabled = false
+				site.Spec.Apps.Catalog[tt.disable] = component
+			}
+
+			if err := generateClusterIndex(site, generateOptions{}); err != nil {
+				t.Fatalf("generateClusterIndex: %v", err)
+			}
+
+			index := readTestFile(t, filepath.Join("clusters", "demo", "README.md"))
+			for _, want := range tt.want {
+				if !strings.Contains(index, want) {
+					t.Errorf("index misses %q:\n%s", want, index)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(index, notWant) {
+					t.Errorf("index contains %q:\n%s", notWant, index)
+				}
+			}
+		})
+	}
+}
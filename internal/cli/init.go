@@ -3,36 +3,55 @@ package cli
 import (
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 
+	"github.com/bamaas/klabctl/internal/config"
 	"github.com/spf13/cobra"
 )
 
 var (
 	stackSource string
 	stackRef    string
+	stackSubdir string
+	initGit     bool
+	initCommit  bool
 )
 
 func newInitCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "init <cluster-name>",
 		Short: "Initialize a new cluster",
-		Long:  "Initialize a new cluster by pulling the stack and creating a cluster-specific site.yaml configuration",
-		Args:  cobra.ExactArgs(1),
+		Long: `Initialize a new cluster by pulling the stack and creating a cluster-specific site.yaml configuration.
+
+Each app keeps the enabled state of its meta.yaml in the stack, so the apps the stack enables
+are rendered right away. 'klabctl get defaults' differs here: it writes enabled: false for
+every app unless --enable or --enable-all is passed.`,
+		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			clusterName := args[0]
+			setHistoryRef(cmd, stackRef)
+			if initCommit && !initGit {
+				return newValidationError("--commit requires --init-git")
+			}
+			if err := config.ValidateStackSubdir(stackSubdir); err != nil {
+				return &ValidationError{Err: err}
+			}
 			return initProject(clusterName)
 		},
 	}
 
 	cmd.Flags().StringVar(&stackSource, "stack-source", "https://github.com/bamaas/klabctl", "Git repository URL for the stack")
 	cmd.Flags().StringVar(&stackRef, "stack-ref", "main", "Stack reference (branch, tag, or commit)")
+	cmd.Flags().StringVar(&stackSubdir, "stack-subdir", "", "Directory of the stack repository holding stack/ (default: the repository root)")
+	cmd.Flags().BoolVar(&initGit, "init-git", false, "Initialize a git repository in the project root and add the generated files")
+	cmd.Flags().BoolVar(&initCommit, "commit", false, "Make an initial commit of the generated files (requires --init-git)")
 
 	return cmd
 }
 
 func initProject(clusterName string) error {
-	fmt.Printf("🚀 Initializing cluster '%s'...\n", clusterName)
+	statusf(os.Stdout, "🚀 Initializing cluster '%s'...\n", clusterName)
 
 	// Create cluster directory: clusters/<cluster-name>/
 	clusterDir := filepath.Join("clusters", clusterName)
@@ -50,16 +69,16 @@ func initProject(clusterName string) error {
 	}
 
 	// Ensure stack is available using pull.go functionality
-	if err := EnsureStackAvailable(stackSource, stackRef, false); err != nil {
+	if err := EnsureStackAvailable(stackSource, stackRef, stackSubdir, false); err != nil {
 		return err
 	}
 
 	// Generate site.yaml in cluster directory
 	// fmt.Println("Generating site.yaml...")
-	if _, err := generateSiteYaml(siteYamlPath, clusterName, stackSource, stackRef); err != nil {
+	if _, err := generateSiteYaml(siteYamlPath, clusterName, stackSource, stackRef, defaultsOptions{stackSubdir: stackSubdir}); err != nil {
 		return fmt.Errorf("failed to generate site.yaml: %w", err)
 	}
-	fmt.Printf("✓ Generated %s\n", siteYamlPath)
+	statusf(os.Stdout, "✓ Generated %s\n", siteYamlPath)
 
 	// Create .gitignore at root (only if it doesn't exist)
 	// fmt.Println("Creating .gitignore...")
@@ -68,13 +87,19 @@ func initProject(clusterName string) error {
 	if err != nil {
 		fmt.Printf("Warning: failed to create .gitignore: %v\n", err)
 	} else if created {
-		fmt.Printf("✓ Generated .gitignore at %s\n", gitignorePath)
+		statusf(os.Stdout, "✓ Generated .gitignore at %s\n", gitignorePath)
 	} else {
-		fmt.Printf("✓ .gitignore already exists")
+		statusln(os.Stdout, "✓ .gitignore already exists")
+	}
+
+	if initGit {
+		if err := initGitRepo(clusterDir, gitignorePath, clusterName, initCommit); err != nil {
+			return err
+		}
 	}
 
 	fmt.Println()
-	fmt.Println("\n✨ Cluster initialized successfully!")
+	statusln(os.Stdout, "\n✨ Cluster initialized successfully!")
 	fmt.Println("")
 	fmt.Println("Next steps:")
 	fmt.Printf("  1. Edit %s to configure your cluster\n", siteYamlPath)
@@ -101,3 +126,36 @@ func createGitignore(outputPath string) (bool, error) {
 
 	return true, nil
 }
+
+// initGitRepo initializes a git repository in the project root and adds the generated files,
+// optionally committing them. An existing repository is left untouched.
+func initGitRepo(clusterDir, gitignorePath, clusterName string, commit bool) error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return &ToolNotFoundError{Tool: "git"}
+	}
+
+	if err := exec.Command("git", "rev-parse", "--is-inside-work-tree").Run(); err == nil {
+		statusln(os.Stdout, "✓ Already in a git repository, skipping git init")
+		return nil
+	}
+
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"add", "--", gitignorePath, clusterDir},
+	} {
+		if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("git %s failed: %w\n%s", args[0], err, output)
+		}
+	}
+	statusln(os.Stdout, "✓ Initialized git repository")
+
+	if commit {
+		message := fmt.Sprintf("Initialize cluster %s", clusterName)
+		if output, err := exec.Command("git", "commit", "--quiet", "-m", message).CombinedOutput(); err != nil {
+			return fmt.Errorf("git commit failed: %w\n%s", err, output)
+		}
+		statusln(os.Stdout, "✓ Created initial commit")
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bamaas/klabctl/internal/config"
+)
+
+func TestInitGitRepo(t *testing.T) {
+	tests := []struct {
+		name       string
+		existing   bool
+		commit     bool
+		wantStaged string
+		wantCommit string
+	}{
+		{name: "files are added", wantStaged: ".gitignore\nclusters/demo/site.yaml"},
+		{name: "initial commit", commit: true, wantCommit: "Initialize cluster demo"},
+		{name: "existing repository is left untouched", existing: true, commit: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := exec.LookPath("git"); err != nil {
+				t.Skip("git is not installed")
+			}
+			t.Chdir(t.TempDir())
+			for _, name := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+				t.Setenv(name, "test")
+			}
+			for _, name := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+				t.Setenv(name, "test@example.com")
+			}
+			clusterDir := filepath.Join("clusters", "demo")
+			writeTestFile(t, filepath.Join(clusterDir, "site.yaml"), testSiteYaml)
+			writeTestFile(t, ".gitignore", ".klabctl")
+			if tt.existing {
+				runTestGit(t, ".", "init", "-q")
+			}
+
+			if err := initGitRepo(clusterDir, ".gitignore", "demo", tt.commit); err != nil {
+				t.Fatalf("initGitRepo: %v", err)
+			}
+
+			staged := strings.TrimSpace(runTestGit(t, ".", "diff", "--cached", "--name-only"))
+			if staged != tt.wantStaged {
+				t.Errorf("staged files = %q, want %q", staged, tt.wantStaged)
+			}
+			var message string
+			if log, err := exec.Command("git", "log", "-1", "--format=%s").Output(); err == nil {
+				message = strings.TrimSpace(string(log))
+			}
+			if message != tt.wantCommit {
+				t.Errorf("last commit = %q, want %q", message, tt.wantCommit)
+			}
+		})
+	}
+}
+
+func TestInitCommitRequiresInitGit(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Cleanup(func() { initGit, initCommit = false, false })
+
+	cmd := newInitCmd()
+	cmd.SetArgs([]string{"demo", "--commit"})
+	cmd.SilenceUsage = true
+	cmd.SilenceErrors = true
+
+	err := cmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "--commit requires --init-git") {
+		t.Fatalf("error = %v, want --commit to require --init-git", err)
+	}
+	if exitCode(err) != exitCodeValidation {
+		t.Errorf("exit code = %d, want %d", exitCode(err), exitCodeValidation)
+	}
+}
+
+func TestInitKeepsMetaEnabled(t *testing.T) {
+	cacheDir := useTestStack(t, testStackApps)
+	commitTestStack(t, cacheDir)
+	t.Cleanup(func() { initGit, initCommit = false, false })
+
+	cmd := newInitCmd()
+	cmd.SetArgs([]string{"demo", "--stack-source", "https://example.com/stack.git"})
+	cmd.SilenceUsage = true
+	cmd.SilenceErrors = true
+	var err error
+	captureStdout(t, func() { err = cmd.Execute() })
+	if err != nil {
+		t.Fatalf("init: %v", err)
+	}
+
+	// The test stack's meta.yaml enables every app, get defaults disables them unless asked to
+	stdout, _, err := runTestGetDefaults(t, "--stack-source", "https://example.com/stack.git")
+	if err != nil {
+		t.Fatalf("get defaults: %v", err)
+	}
+	defaults, err := config.ParseSite([]byte(stdout))
+	if err != nil {
+		t.Fatalf("ParseSite: %v\n%s", err, stdout)
+	}
+	initialized := parseTestSite(t, readTestFile(t, filepath.Join("clusters", "demo", "site.yaml")))
+
+	for name := range testStackApps {
+		if !initialized.Spec.Apps.Catalog[name].Enabled {
+			t.Errorf("init: %s enabled = false, want the meta.yaml value true", name)
+		}
+		if defaults.Spec.Apps.Catalog[name].Enabled {
+			t.Errorf("get defaults: %s enabled = true, want false", name)
+		}
+	}
+}
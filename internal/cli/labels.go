@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/bamaas/klabctl/internal/config"
+)
+
+// inputHashAnnotationKey is the annotation holding the hash of a component's render inputs
+const inputHashAnnotationKey = "klabctl.io/input-hash"
+
+// invalidLabelValueChars matches the characters not allowed in a Kubernetes label value
+var invalidLabelValueChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// componentLabels returns the labels of a component's resources, nil when there are none
+// The defaults of --emit-kustomize-labels are merged with spec.apps.commonLabels, where an empty value drops a label
+func componentLabels(site *config.Site, opts generateOptions, componentName string) map[string]string {
+	labels := make(map[string]string)
+	if opts.emitKustomizeLabels {
+		labels["app.kubernetes.io/managed-by"] = "klabctl"
+		labels["klabctl.io/cluster"] = labelValue(site.Metadata.Name)
+		labels["klabctl.io/app"] = labelValue(componentName)
+		labels["klabctl.io/stack-ref"] = labelValue(renderedStackRef(site, opts))
+	}
+
+	for key, value := range site.Spec.Apps.CommonLabels {
+		if value == "" {
+			delete(labels, key)
+			continue
+		}
+		labels[key] = value
+	}
+
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
+
+// componentAnnotations returns the annotations of a component's resources, nil when there are none
+func componentAnnotations(opts generateOptions, componentName string) map[string]string {
+	hash, ok := opts.inputHashes[componentName]
+	if !ok {
+		return nil
+	}
+	return map[string]string{inputHashAnnotationKey: hash}
+}
+
+// labelValue makes s a valid label value: allowed characters only, at most 63 long,
+// starting and ending with an alphanumeric character (e.g. a ref feature/x becomes feature-x)
+func labelValue(s string) string {
+	value := invalidLabelValueChars.ReplaceAllString(s, "-")
+	if len(value) > 63 {
+		value = value[:63]
+	}
+	return strings.Trim(value, "._-")
+}
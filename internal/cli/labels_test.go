@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLabelValue(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "main", want: "main"},
+		{in: "feature/x", want: "feature-x"},
+		{in: "v1.2.0", want: "v1.2.0"},
+		{in: "-refs/heads/", want: "refs-heads"},
+		{in: strings.Repeat("a", 70), want: strings.Repeat("a", 63)},
+		{in: strings.Repeat("a", 62) + "/b", want: strings.Repeat("a", 62)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := labelValue(tt.in); got != tt.want {
+				t.Errorf("labelValue(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComponentLabels(t *testing.T) {
+	tests := []struct {
+		name         string
+		emit         bool
+		commonLabels map[string]string
+		want         map[string]string
+	}{
+		{name: "none"},
+		{
+			name: "defaults",
+			emit: true,
+			want: map[string]string{
+				"app.kubernetes.io/managed-by": "klabctl",
+				"klabctl.io/cluster":           "demo",
+				"klabctl.io/app":               "external-dns",
+				"klabctl.io/stack-ref":         "main",
+			},
+		},
+		{
+			name:         "common labels only",
+			commonLabels: map[string]string{"team": "platform"},
+			want:         map[string]string{"team": "platform"},
+		},
+		{
+			name:         "common labels override and drop defaults",
+			emit:         true,
+			commonLabels: map[string]string{"app.kubernetes.io/managed-by": "gitops", "klabctl.io/cluster": "", "klabctl.io/stack-ref": ""},
+			want: map[string]string{
+				"app.kubernetes.io/managed-by": "gitops",
+				"klabctl.io/app":               "external-dns",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			site := parseTestSite(t, testSiteYaml)
+			site.Spec.Apps.CommonLabels = tt.commonLabels
+
+			if got := componentLabels(site, generateOptions{emitKustomizeLabels: tt.emit}, "external-dns"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("componentLabels = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateEmitKustomizeLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    bool
+		wantRef string
+	}{
+		{name: "without labels"},
+		{name: "with labels", args: []string{"--emit-kustomize-labels"}, want: true, wantRef: `klabctl.io/stack-ref: "main"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := useTestStack(t, testStackApps)
+			commitTestStack(t, cacheDir)
+			writeTestSite(t, testSiteYaml)
+
+			if _, err := runTestGenerate(t, tt.args...); err != nil {
+				t.Fatalf("generate: %v", err)
+			}
+
+			kustomization := readTestFile(t, filepath.Join("clusters", "demo", "apps", "system", "apps", "pihole", "generated", "kustomization.yaml"))
+			if got := strings.Contains(kustomization, `app.kubernetes.io/managed-by: "klabctl"`); got != tt.want {
+				t.Errorf("labels emitted = %t, want %t:\n%s", got, tt.want, kustomization)
+			}
+			if tt.wantRef != "" && !strings.Contains(kustomization, tt.wantRef) {
+				t.Errorf("kustomization misses %q:\n%s", tt.wantRef, kustomization)
+			}
+		})
+	}
+}
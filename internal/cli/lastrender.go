@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bamaas/klabctl/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// lastRenderDir holds a snapshot of the component inputs of the previous render per cluster (--since-last-render)
+var lastRenderDir = filepath.Join(hiddenKlabctlDir, "last-render")
+
+// lastRender is the snapshot of a cluster's previous render
+type lastRender struct {
+	// Components maps each rendered component to the hash of its inputs
+	Components map[string]string `json:"components"`
+}
+
+// lastRenderPath returns the snapshot file of a cluster
+func lastRenderPath(site *config.Site) string {
+	return filepath.Join(lastRenderDir, site.Metadata.Name+".json")
+}
+
+// loadLastRender reads the snapshot of the previous render, a missing snapshot is empty
+func loadLastRender(site *config.Site) (*lastRender, error) {
+	snapshot := &lastRender{Components: map[string]string{}}
+	data, err := os.ReadFile(lastRenderPath(site))
+	if os.IsNotExist(err) {
+		return snapshot, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", lastRenderPath(site), err)
+	}
+	if snapshot.Components == nil {
+		snapshot.Components = map[string]string{}
+	}
+	return snapshot, nil
+}
+
+// saveLastRender writes the snapshot for the next render
+func saveLastRender(site *config.Site, snapshot *lastRender) error {
+	if err := createHiddenKlabctlDir(); err != nil {
+		return fmt.Errorf("failed to create %s directory: %w", hiddenKlabctlDir, err)
+	}
+	if err := os.MkdirAll(lastRenderDir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(lastRenderPath(site), data, 0644)
+}
+
+// componentInputKey hashes the inputs of a component's render: the stack commit, the whole resolved site
+// including every catalog entry (templates read other components through .AllComponents), every shared
+// stack template and the component's own templates
+func componentInputKey(site *config.Site, opts generateOptions, stackCommit, componentName string) (string, error) {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "ref:%s\ncommit:%s\ncomponent:%s\nlabels:%t\nannotations:%t\n", renderedStackRef(site, opts), stackCommit, componentName, opts.emitKustomizeLabels, opts.inputHashes != nil)
+
+	siteData, err := yaml.Marshal(site)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal render inputs: %w", err)
+	}
+	fmt.Fprintf(hash, "site:%d\n", len(siteData))
+	hash.Write(siteData)
+
+	sharedTemplates, err := os.ReadDir(getStackTemplatesDir(site, opts))
+	if err != nil {
+		return "", fmt.Errorf("failed to list stack templates: %w", err)
+	}
+	var templates []string
+	for _, entry := range sharedTemplates {
+		if !entry.IsDir() {
+			templates = append(templates, entry.Name())
+		}
+	}
+	templateNames, err := FindAppTemplates(site, opts, componentName)
+	if err != nil {
+		return "", fmt.Errorf("failed to find templates for %s: %w", componentName, err)
+	}
+	templates = append(templates, templateNames...)
+	for _, templateName := range templates {
+		content, err := readTemplateFromCache(site, opts, templateName)
+		if err != nil {
+			return "", fmt.Errorf("failed to read template %s: %w", templateName, err)
+		}
+		fmt.Fprintf(hash, "template:%s:%d\n", templateName, len(content))
+		hash.Write(content)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
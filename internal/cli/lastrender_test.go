@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/bamaas/klabctl/internal/config"
+)
+
+func TestComponentInputKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(t *testing.T, site *config.Site)
+		changed bool
+	}{
+		{
+			name:    "unchanged inputs",
+			change:  func(t *testing.T, site *config.Site) {},
+			changed: false,
+		},
+		{
+			name: "own values",
+			change: func(t *testing.T, site *config.Site) {
+				site.Spec.Apps.Catalog["external-dns"].Values["interval"] = "2m"
+			},
+			changed: true,
+		},
+		{
+			name: "values of another app",
+			change: func(t *testing.T, site *config.Site) {
+				site.Spec.Apps.Catalog["pihole"].Values["host"] = "dns.lan"
+			},
+			changed: true,
+		},
+		{
+			name: "shared template not used by the app's own templates",
+			change: func(t *testing.T, site *config.Site) {
+				path := filepath.Join(getStackTemplatesDir(site, generateOptions{}), "helm.kustomization.yaml.tmpl")
+				writeTestFile(t, path, readTestFile(t, path)+"\n# changed\n")
+			},
+			changed: true,
+		},
+		{
+			name: "app template",
+			change: func(t *testing.T, site *config.Site) {
+				path := filepath.Join(getStackAppsDir(site, generateOptions{}), "external-dns", "templates", "kustomization.yaml.tmpl")
+				writeTestFile(t, path, readTestFile(t, path)+"\n# changed\n")
+			},
+			changed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestStack(t, testStackApps)
+			site := parseTestSite(t, testSiteYaml)
+
+			before, err := componentInputKey(site, generateOptions{}, "abc", "external-dns")
+			if err != nil {
+				t.Fatalf("componentInputKey: %v", err)
+			}
+			tt.change(t, site)
+			after, err := componentInputKey(site, generateOptions{}, "abc", "external-dns")
+			if err != nil {
+				t.Fatalf("componentInputKey: %v", err)
+			}
+
+			if (before != after) != tt.changed {
+				t.Errorf("key changed = %t, want %t", before != after, tt.changed)
+			}
+		})
+	}
+}
+
+func TestComponentInputKeyStackCommit(t *testing.T) {
+	useTestStack(t, testStackApps)
+	site := parseTestSite(t, testSiteYaml)
+
+	first, err := componentInputKey(site, generateOptions{}, "abc", "pihole")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := componentInputKey(site, generateOptions{}, "def", "pihole")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Error("key did not change with the stack commit")
+	}
+}
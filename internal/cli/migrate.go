@@ -0,0 +1,264 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// currentAPIVersion is the site.yaml apiVersion produced by this version of klabctl
+const currentAPIVersion = "klab/v1alpha1"
+
+func newMigrateCmd() *cobra.Command {
+
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Upgrade a site.yaml to the current structure",
+		Long: `Upgrade a site.yaml written for an older klabctl to the current structure.
+
+Known legacy shapes are rewritten in place, comments are preserved where possible:
+  - infra.provider as an object ({name: proxmox, proxmox: {...}}) with the provider
+    settings (talosImage, nodeData, cluster, ...) directly under infra
+  - infra.base and apps.base, replaced by spec.stack
+
+Examples:
+  # Preview the migrated site.yaml
+  klabctl migrate --site clusters/production/site.yaml --dry-run
+
+  # Migrate in place
+  klabctl migrate --site clusters/production/site.yaml`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := os.ReadFile(sitePath)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", sitePath, err)
+			}
+
+			var doc yaml.Node
+			if err := yaml.Unmarshal(data, &doc); err != nil {
+				return newValidationError("failed to parse %s: %w", sitePath, err)
+			}
+
+			changes, err := migrateSite(&doc)
+			if err != nil {
+				return err
+			}
+
+			if len(changes) == 0 {
+				statusf(os.Stderr, "✓ %s is already up to date\n", sitePath)
+				return nil
+			}
+
+			for _, change := range changes {
+				statusf(os.Stderr, "• %s\n", change)
+			}
+
+			var buf bytes.Buffer
+			encoder := yaml.NewEncoder(&buf)
+			encoder.SetIndent(2)
+			if err := encoder.Encode(&doc); err != nil {
+				return fmt.Errorf("failed to encode migrated site: %w", err)
+			}
+			encoder.Close()
+
+			if dryRun {
+				fmt.Print(buf.String())
+				return nil
+			}
+
+			if err := os.WriteFile(sitePath, buf.Bytes(), 0644); err != nil {
+				return fmt.Errorf("failed to write %s: %w", sitePath, err)
+			}
+			statusf(os.Stderr, "✓ Migrated %s\n", sitePath)
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the migrated site.yaml instead of writing it")
+
+	return cmd
+}
+
+// migrateSite rewrites legacy site.yaml shapes to the current structure
+// Returns a description of every applied change
+func migrateSite(doc *yaml.Node) ([]string, error) {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, newValidationError("site.yaml must contain a mapping")
+	}
+	root := doc.Content[0]
+
+	var changes []string
+
+	apiVersion := mappingGet(root, "apiVersion")
+	switch {
+	case apiVersion == nil:
+		mappingSet(root, "apiVersion", scalarNode(currentAPIVersion))
+		changes = append(changes, fmt.Sprintf("set apiVersion to %s", currentAPIVersion))
+	case apiVersion.Value != currentAPIVersion:
+		return nil, newValidationError("unsupported apiVersion '%s' (supported: %s)", apiVersion.Value, currentAPIVersion)
+	}
+
+	spec := mappingGet(root, "spec")
+	if spec == nil || spec.Kind != yaml.MappingNode {
+		return changes, nil
+	}
+
+	if infra := mappingGet(spec, "infra"); infra != nil && infra.Kind == yaml.MappingNode {
+		infraChanges, err := migrateInfra(infra)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, infraChanges...)
+
+		if base := mappingDelete(infra, "base"); base != nil {
+			changes = append(changes, "removed infra.base, the infra base is taken from the stack")
+			changes = append(changes, migrateLegacyBase(spec, base)...)
+		}
+	}
+
+	if apps := mappingGet(spec, "apps"); apps != nil && apps.Kind == yaml.MappingNode {
+		if base := mappingDelete(apps, "base"); base != nil {
+			changes = append(changes, "removed apps.base, app bases are taken from the stack")
+			changes = append(changes, migrateLegacyBase(spec, base)...)
+		}
+	}
+
+	return changes, nil
+}
+
+// migrateInfra converts a legacy infra.provider object into the provider/providers structure
+//
+//	provider: {name: proxmox, proxmox: {...}}   ->   provider: proxmox
+//	talosImage: ..., nodeData: ..., cluster: ...     providers: {proxmox: {..., talosImage, nodeData, cluster}}
+func migrateInfra(infra *yaml.Node) ([]string, error) {
+	provider := mappingGet(infra, "provider")
+	if provider == nil || provider.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+
+	nameNode := mappingGet(provider, "name")
+	if nameNode == nil || nameNode.Value == "" {
+		return nil, newValidationError("legacy infra.provider object has no name")
+	}
+	name := nameNode.Value
+
+	// Start from the provider specific block, then move the remaining infra settings below it
+	settings := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	if providerSettings := mappingGet(provider, name); providerSettings != nil && providerSettings.Kind == yaml.MappingNode {
+		settings.Content = append(settings.Content, providerSettings.Content...)
+	}
+
+	changes := []string{fmt.Sprintf("converted infra.provider object to provider: %s with settings under infra.providers.%s", name, name)}
+
+	// A key set both in provider.<name> and directly under infra keeps the provider specific value
+	var kept []*yaml.Node
+	for i := 0; i+1 < len(infra.Content); i += 2 {
+		key, value := infra.Content[i], infra.Content[i+1]
+		switch key.Value {
+		case "provider":
+			kept = append(kept, key, scalarNode(name))
+		case "providers", "providersFrom", "base":
+			kept = append(kept, key, value)
+		default:
+			if mappingGet(settings, key.Value) != nil {
+				changes = append(changes, fmt.Sprintf("dropped infra.%s, infra.provider.%s.%s is set as well and was kept", key.Value, name, key.Value))
+				continue
+			}
+			settings.Content = append(settings.Content, key, value)
+		}
+	}
+	infra.Content = kept
+
+	// The cluster name is taken from metadata.name
+	if cluster := mappingGet(settings, "cluster"); cluster != nil && cluster.Kind == yaml.MappingNode {
+		if mappingDelete(cluster, "name") != nil {
+			changes = append(changes, "removed infra cluster.name, metadata.name is used instead")
+		}
+	}
+
+	providers := mappingGet(infra, "providers")
+	if providers == nil || providers.Kind != yaml.MappingNode {
+		providers = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		mappingSet(infra, "providers", providers)
+	}
+
+	// Existing entries in providers win over migrated settings
+	if existing := mappingGet(providers, name); existing != nil && existing.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(settings.Content); i += 2 {
+			key := settings.Content[i].Value
+			if mappingGet(existing, key) != nil {
+				changes = append(changes, fmt.Sprintf("dropped the legacy infra %s, infra.providers.%s.%s is set as well and was kept", key, name, key))
+				continue
+			}
+			existing.Content = append(existing.Content, settings.Content[i], settings.Content[i+1])
+		}
+	} else {
+		mappingSet(providers, name, settings)
+	}
+
+	return changes, nil
+}
+
+// migrateLegacyBase adds spec.stack from a legacy base block when no stack is configured
+func migrateLegacyBase(spec, base *yaml.Node) []string {
+	if mappingGet(spec, "stack") != nil || base.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	source := mappingGet(base, "source")
+	ref := mappingGet(base, "ref")
+	if source == nil || ref == nil {
+		return nil
+	}
+
+	stack := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	mappingSet(stack, "source", scalarNode(source.Value))
+	mappingSet(stack, "ref", scalarNode(ref.Value))
+	mappingSet(spec, "stack", stack)
+
+	return []string{fmt.Sprintf("added spec.stack from the legacy base (%s@%s), verify it points at a klabctl stack", source.Value, ref.Value)}
+}
+
+// mappingGet returns the value node for key in a mapping node, or nil
+func mappingGet(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// mappingSet sets key to value in a mapping node, appending the key if it doesn't exist
+func mappingSet(mapping *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content[i+1] = value
+			return
+		}
+	}
+	mapping.Content = append(mapping.Content, scalarNode(key), value)
+}
+
+// mappingDelete removes key from a mapping node and returns its value, or nil if absent
+func mappingDelete(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			value := mapping.Content[i+1]
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return value
+		}
+	}
+	return nil
+}
+
+// scalarNode creates a string scalar node
+func scalarNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
@@ -0,0 +1,231 @@
+package cli
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMigrateSite(t *testing.T) {
+	tests := []struct {
+		name        string
+		site        string
+		want        string
+		wantChanges []string
+	}{
+		{
+			name: "current structure",
+			site: `apiVersion: klab/v1alpha1
+spec:
+  infra:
+    provider: proxmox
+    providers:
+      proxmox:
+        endpoint: https://pve
+`,
+			want: `apiVersion: klab/v1alpha1
+spec:
+  infra:
+    provider: proxmox
+    providers:
+      proxmox:
+        endpoint: https://pve
+`,
+		},
+		{
+			name: "legacy provider object",
+			site: `spec:
+  infra:
+    provider:
+      name: proxmox
+      proxmox:
+        endpoint: https://pve
+    cluster:
+      name: demo
+      domain: lan
+`,
+			want: `spec:
+  infra:
+    provider: proxmox
+    providers:
+      proxmox:
+        endpoint: https://pve
+        cluster:
+          domain: lan
+apiVersion: klab/v1alpha1
+`,
+			wantChanges: []string{
+				"set apiVersion to klab/v1alpha1",
+				"converted infra.provider object to provider: proxmox with settings under infra.providers.proxmox",
+				"removed infra cluster.name, metadata.name is used instead",
+			},
+		},
+		{
+			name: "key set in the provider object and under infra",
+			site: `apiVersion: klab/v1alpha1
+spec:
+  infra:
+    provider:
+      name: proxmox
+      proxmox:
+        endpoint: https://pve
+        tokenID: new
+    tokenID: old
+`,
+			want: `apiVersion: klab/v1alpha1
+spec:
+  infra:
+    provider: proxmox
+    providers:
+      proxmox:
+        endpoint: https://pve
+        tokenID: new
+`,
+			wantChanges: []string{"dropped infra.tokenID, infra.provider.proxmox.tokenID is set as well and was kept"},
+		},
+		{
+			name: "key set in the legacy shape and in providers",
+			site: `apiVersion: klab/v1alpha1
+spec:
+  infra:
+    provider:
+      name: proxmox
+    endpoint: https://old
+    providers:
+      proxmox:
+        endpoint: https://new
+`,
+			want: `apiVersion: klab/v1alpha1
+spec:
+  infra:
+    provider: proxmox
+    providers:
+      proxmox:
+        endpoint: https://new
+`,
+			wantChanges: []string{"dropped the legacy infra endpoint, infra.providers.proxmox.endpoint is set as well and was kept"},
+		},
+		{
+			name: "legacy base",
+			site: `apiVersion: klab/v1alpha1
+spec:
+  apps:
+    base:
+      source: https://example.com/stack.git
+      ref: v1
+`,
+			want: `apiVersion: klab/v1alpha1
+spec:
+  apps: {}
+  stack:
+    source: https://example.com/stack.git
+    ref: v1
+`,
+			wantChanges: []string{
+				"removed apps.base, app bases are taken from the stack",
+				"added spec.stack from the legacy base (https://example.com/stack.git@v1), verify it points at a klabctl stack",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc yaml.Node
+			if err := yaml.Unmarshal([]byte(tt.site), &doc); err != nil {
+				t.Fatal(err)
+			}
+
+			changes, err := migrateSite(&doc)
+			if err != nil {
+				t.Fatalf("migrateSite: %v", err)
+			}
+
+			var buf bytes.Buffer
+			encoder := yaml.NewEncoder(&buf)
+			encoder.SetIndent(2)
+			if err := encoder.Encode(&doc); err != nil {
+				t.Fatal(err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("migrated site:\n%s\nwant:\n%s", buf.String(), tt.want)
+			}
+
+			// The migrated site must not hold duplicate keys
+			var values map[string]interface{}
+			if err := yaml.Unmarshal(buf.Bytes(), &values); err != nil {
+				t.Errorf("migrated site doesn't parse: %v", err)
+			}
+
+			for _, want := range tt.wantChanges {
+				if !containsString(changes, want) {
+					t.Errorf("changes miss %q:\n%s", want, strings.Join(changes, "\n"))
+				}
+			}
+			if len(tt.wantChanges) == 0 && len(changes) > 0 {
+				t.Errorf("unexpected changes:\n%s", strings.Join(changes, "\n"))
+			}
+		})
+	}
+}
+
+func TestMigrateSiteErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		site    string
+		wantErr string
+	}{
+		{name: "provider object without name", site: "apiVersion: klab/v1alpha1\nspec:\n  infra:\n    provider:\n      proxmox: {}\n", wantErr: "has no name"},
+		{name: "unsupported apiVersion", site: "apiVersion: klab/v2\n", wantErr: "unsupported apiVersion"},
+		{name: "not a mapping", site: "- a\n", wantErr: "must contain a mapping"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc yaml.Node
+			if err := yaml.Unmarshal([]byte(tt.site), &doc); err != nil {
+				t.Fatal(err)
+			}
+			_, err := migrateSite(&doc)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMigrateCmdListsChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		want   string
+	}{
+		{name: "emoji", policy: colorAlways, want: "• set apiVersion to klab/v1alpha1\n"},
+		{name: "ascii", policy: colorNever, want: "- set apiVersion to klab/v1alpha1\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			writeTestSite(t, "spec:\n  stack:\n    ref: main\n")
+			sitePath = filepath.Join("clusters", "demo", "site.yaml")
+			colorPolicy = tt.policy
+			t.Cleanup(func() { sitePath, colorPolicy = "", colorAuto })
+
+			cmd := newMigrateCmd()
+			cmd.SetArgs([]string{"--dry-run"})
+			var err error
+			stderr := captureStderr(t, func() {
+				captureStdout(t, func() { err = cmd.Execute() })
+			})
+			if err != nil {
+				t.Fatalf("migrate: %v", err)
+			}
+			if !strings.Contains(stderr, tt.want) {
+				t.Errorf("stderr misses %q:\n%s", tt.want, stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/bamaas/klabctl/internal/config"
+)
+
+// Component orders of the --components-order flag, any other value is a comma separated list of components
+const (
+	componentsOrderAlpha      = "alpha"
+	componentsOrderDependency = "dependency"
+)
+
+// orderComponents returns the names of the enabled catalog components in the requested order
+// alpha sorts by name, dependency renders every component after its dependsOn, and an explicit list
+// renders the listed components first followed by the remaining ones sorted by name
+func orderComponents(site *config.Site, order string) ([]string, error) {
+	var names []string
+	for name, component := range site.Spec.Apps.Catalog {
+		if component.Enabled {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	switch order {
+	case "", componentsOrderAlpha:
+		return names, nil
+	case componentsOrderDependency:
+		return orderByDependencies(site, names)
+	default:
+		return orderByList(site, names, strings.Split(order, ","))
+	}
+}
+
+// hasEnabledApps reports whether at least one catalog component is enabled
+func hasEnabledApps(site *config.Site) bool {
+	for _, component := range site.Spec.Apps.Catalog {
+		if component.Enabled {
+			return true
+		}
+	}
+	return false
+}
+
+// orderByList puts the listed components first, in list order
+func orderByList(site *config.Site, names, list []string) ([]string, error) {
+	ordered := make([]string, 0, len(names))
+	seen := make(map[string]bool)
+	for _, name := range list {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		component, ok := site.Spec.Apps.Catalog[name]
+		if !ok {
+			return nil, newValidationError("unknown component '%s' in --components-order", name)
+		}
+		seen[name] = true
+		if component.Enabled {
+			ordered = append(ordered, name)
+		}
+	}
+
+	for _, name := range names {
+		if !seen[name] {
+			ordered = append(ordered, name)
+		}
+	}
+	return ordered, nil
+}
+
+// orderByDependencies sorts the components topologically on dependsOn, ties are broken by name
+func orderByDependencies(site *config.Site, names []string) ([]string, error) {
+	enabled := make(map[string]bool, len(names))
+	for _, name := range names {
+		enabled[name] = true
+	}
+
+	// dependents maps a component to the components depending on it
+	dependents := make(map[string][]string)
+	pending := make(map[string]int, len(names))
+	for _, name := range names {
+		for _, dependency := range site.Spec.Apps.Catalog[name].DependsOn {
+			if _, ok := site.Spec.Apps.Catalog[dependency]; !ok {
+				return nil, newValidationError("%s depends on unknown component '%s'", name, dependency)
+			}
+			if !enabled[dependency] {
+				warnf("%s depends on %s, which is disabled", name, dependency)
+				continue
+			}
+			dependents[dependency] = append(dependents[dependency], name)
+			pending[name]++
+		}
+	}
+
+	var ready, ordered []string
+	for _, name := range names {
+		if pending[name] == 0 {
+			ready = append(ready, name)
+		}
+	}
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		name := ready[0]
+		ready = ready[1:]
+		ordered = append(ordered, name)
+
+		for _, dependent := range dependents[name] {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	if len(ordered) < len(names) {
+		var cycle []string
+		for _, name := range names {
+			if pending[name] > 0 {
+				cycle = append(cycle, name)
+			}
+		}
+		return nil, newValidationError("dependsOn cycle between components: %s", strings.Join(cycle, ", "))
+	}
+
+	return ordered, nil
+}
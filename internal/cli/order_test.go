@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bamaas/klabctl/internal/config"
+)
+
+// testOrderSite returns a site with a catalog of enabled components and their dependsOn
+func testOrderSite(dependsOn map[string][]string, disabled ...string) *config.Site {
+	site := &config.Site{}
+	site.Spec.Apps.Catalog = make(map[string]config.Component)
+	for name, dependencies := range dependsOn {
+		site.Spec.Apps.Catalog[name] = config.Component{Enabled: !containsString(disabled, name), DependsOn: dependencies}
+	}
+	return site
+}
+
+func TestOrderComponents(t *testing.T) {
+	tests := []struct {
+		name         string
+		dependsOn    map[string][]string
+		disabled     []string
+		order        string
+		want         []string
+		wantWarnings int
+		wantError    string
+	}{
+		{
+			name:      "alpha by default",
+			dependsOn: map[string][]string{"pihole": nil, "cilium": nil, "metallb": nil},
+			want:      []string{"cilium", "metallb", "pihole"},
+		},
+		{
+			name:      "disabled components are skipped",
+			dependsOn: map[string][]string{"pihole": nil, "cilium": nil},
+			disabled:  []string{"pihole"},
+			order:     componentsOrderAlpha,
+			want:      []string{"cilium"},
+		},
+		{
+			name:      "explicit list first",
+			dependsOn: map[string][]string{"pihole": nil, "cilium": nil, "metallb": nil},
+			order:     "pihole, metallb,pihole",
+			want:      []string{"pihole", "metallb", "cilium"},
+		},
+		{
+			name:      "unknown component in the list",
+			dependsOn: map[string][]string{"pihole": nil},
+			order:     "pihole,cilium",
+			wantError: "unknown component 'cilium'",
+		},
+		{
+			name:      "dependencies first",
+			dependsOn: map[string][]string{"pihole": {"metallb"}, "metallb": {"cilium"}, "cilium": nil, "argocd": nil},
+			order:     componentsOrderDependency,
+			want:      []string{"argocd", "cilium", "metallb", "pihole"},
+		},
+		{
+			name:         "disabled dependency warns",
+			dependsOn:    map[string][]string{"pihole": {"metallb"}, "metallb": nil},
+			disabled:     []string{"metallb"},
+			order:        componentsOrderDependency,
+			want:         []string{"pihole"},
+			wantWarnings: 1,
+		},
+		{
+			name:      "unknown dependency",
+			dependsOn: map[string][]string{"pihole": {"metallb"}},
+			order:     componentsOrderDependency,
+			wantError: "depends on unknown component 'metallb'",
+		},
+		{
+			name:      "cycle",
+			dependsOn: map[string][]string{"a": {"b"}, "b": {"a"}, "c": nil},
+			order:     componentsOrderDependency,
+			wantError: "dependsOn cycle between components: a, b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warningCount = 0
+			t.Cleanup(func() { warningCount = 0 })
+
+			var got []string
+			var err error
+			captureStderr(t, func() { got, err = orderComponents(testOrderSite(tt.dependsOn, tt.disabled...), tt.order) })
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("orderComponents: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("orderComponents = %v, want %v", got, tt.want)
+			}
+			if warningCount != tt.wantWarnings {
+				t.Errorf("warnings = %d, want %d", warningCount, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestHasEnabledApps(t *testing.T) {
+	apps := map[string][]string{"pihole": nil, "metallb": nil}
+
+	tests := []struct {
+		name     string
+		apps     map[string][]string
+		disabled []string
+		want     bool
+	}{
+		{name: "enabled apps", apps: apps, want: true},
+		{name: "one app enabled", apps: apps, disabled: []string{"pihole"}, want: true},
+		{name: "all disabled", apps: apps, disabled: []string{"pihole", "metallb"}, want: false},
+		{name: "empty catalog", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasEnabledApps(testOrderSite(tt.apps, tt.disabled...)); got != tt.want {
+				t.Errorf("hasEnabledApps = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
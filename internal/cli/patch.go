@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/bamaas/klabctl/internal/config"
+)
+
+// jsonPatchOperation is a single RFC 6902 JSON patch operation
+type jsonPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// MarshalJSON emits value for the operations that require it (add, replace, test), also when it is null,
+// and leaves it out of the others
+func (o jsonPatchOperation) MarshalJSON() ([]byte, error) {
+	switch o.Op {
+	case "add", "replace", "test":
+		type withValue jsonPatchOperation
+		return json.Marshal(withValue(o))
+	default:
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{o.Op, o.Path})
+	}
+}
+
+// buildJSONPatch returns the operations that turn base into desired
+// Maps are patched key by key in sorted order, any other differing value is replaced as a whole
+func buildJSONPatch(path string, base, desired map[string]interface{}) []jsonPatchOperation {
+	keys := make(map[string]bool)
+	for key := range base {
+		keys[key] = true
+	}
+	for key := range desired {
+		keys[key] = true
+	}
+
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+
+	var operations []jsonPatchOperation
+	for _, key := range sortedKeys {
+		keyPath := path + "/" + escapeJSONPointer(key)
+		baseValue, inBase := base[key]
+		desiredValue, inDesired := desired[key]
+
+		switch {
+		case !inDesired:
+			operations = append(operations, jsonPatchOperation{Op: "remove", Path: keyPath})
+		case !inBase:
+			operations = append(operations, jsonPatchOperation{Op: "add", Path: keyPath, Value: desiredValue})
+		default:
+			baseMap, baseIsMap := baseValue.(map[string]interface{})
+			desiredMap, desiredIsMap := desiredValue.(map[string]interface{})
+			if baseIsMap && desiredIsMap {
+				operations = append(operations, buildJSONPatch(keyPath, baseMap, desiredMap)...)
+				continue
+			}
+			if !reflect.DeepEqual(baseValue, desiredValue) {
+				operations = append(operations, jsonPatchOperation{Op: "replace", Path: keyPath, Value: desiredValue})
+			}
+		}
+	}
+
+	return operations
+}
+
+// escapeJSONPointer escapes a key for use as a JSON pointer reference token
+func escapeJSONPointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+// writeValuesPatch writes the JSON patch from the stack's default values to the component values
+// to <generatedPath>/values.patch.json
+func writeValuesPatch(site *config.Site, opts generateOptions, componentName string, component *config.Component, generatedPath string) error {
+	defaults, err := stackDefaultValues(site, opts, componentName)
+	if err != nil {
+		return err
+	}
+
+	operations := buildJSONPatch("", defaults, component.Values)
+	if operations == nil {
+		operations = []jsonPatchOperation{}
+	}
+
+	data, err := json.MarshalIndent(operations, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal values patch: %w", err)
+	}
+
+	patchPath := filepath.Join(generatedPath, "values.patch.json")
+	if err := writeOutputFile(patchPath, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write %s: %w", patchPath, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestBuildJSONPatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    map[string]interface{}
+		desired map[string]interface{}
+		want    string
+	}{
+		{
+			name:    "unchanged",
+			base:    map[string]interface{}{"a": 1},
+			desired: map[string]interface{}{"a": 1},
+			want:    `null`,
+		},
+		{
+			name:    "add, replace and remove",
+			base:    map[string]interface{}{"a": 1, "b": 2},
+			desired: map[string]interface{}{"a": 3, "c": "x"},
+			want:    `[{"op":"replace","path":"/a","value":3},{"op":"remove","path":"/b"},{"op":"add","path":"/c","value":"x"}]`,
+		},
+		{
+			name:    "null values are kept",
+			base:    map[string]interface{}{"a": 1},
+			desired: map[string]interface{}{"a": nil, "b": nil},
+			want:    `[{"op":"replace","path":"/a","value":null},{"op":"add","path":"/b","value":null}]`,
+		},
+		{
+			name:    "nested maps and escaped keys",
+			base:    map[string]interface{}{"m": map[string]interface{}{"x/y": 1}},
+			desired: map[string]interface{}{"m": map[string]interface{}{"x/y": 2, "a~b": false}},
+			want:    `[{"op":"add","path":"/m/a~0b","value":false},{"op":"replace","path":"/m/x~1y","value":2}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(buildJSONPatch("", tt.base, tt.desired))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("patch = %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONPatchOperationMarshalJSON(t *testing.T) {
+	tests := []struct {
+		op   jsonPatchOperation
+		want string
+	}{
+		{op: jsonPatchOperation{Op: "add", Path: "/a"}, want: `{"op":"add","path":"/a","value":null}`},
+		{op: jsonPatchOperation{Op: "replace", Path: "/a", Value: ""}, want: `{"op":"replace","path":"/a","value":""}`},
+		{op: jsonPatchOperation{Op: "test", Path: "/a"}, want: `{"op":"test","path":"/a","value":null}`},
+		{op: jsonPatchOperation{Op: "remove", Path: "/a"}, want: `{"op":"remove","path":"/a"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.op.Op, func(t *testing.T) {
+			data, err := json.Marshal(tt.op)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("operation = %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// projectConfigPath is the project-level file with defaults for command flags
+var projectConfigPath = filepath.Join(hiddenKlabctlDir, "config.yaml")
+
+// flagEnvPrefix prefixes the environment variables supplying flag defaults (e.g. KLABCTL_STACK_SOURCE)
+const flagEnvPrefix = "KLABCTL_"
+
+// flagDefaultAnnotation marks a flag whose value was taken from the environment or the project config
+const flagDefaultAnnotation = "klabctl_flag_default"
+
+// defaultableFlags are the flags that take defaults from the environment and .klabctl/config.yaml
+// Flags that overwrite files, commit, pick the site or otherwise change what a command does to the
+// repository are left out, so they only ever take effect from the command line
+var defaultableFlags = map[string]bool{
+	"stack-source": true,
+	"stack-ref":    true,
+	"stack-subdir": true,
+	"clone-depth":  true,
+	"concurrency":  true,
+	"color":        true,
+	"output":       true,
+	"site-dir":     true,
+	"trace-dir":    true,
+}
+
+// loadProjectConfig reads the flag defaults of .klabctl/config.yaml, keyed by flag name
+// A missing file yields no defaults
+func loadProjectConfig(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	defaults := make(map[string]string, len(raw))
+	for name, value := range raw {
+		if !defaultableFlags[name] {
+			return nil, fmt.Errorf("%s: %s cannot be set in the project config, pass --%s on the command line", path, name, name)
+		}
+		switch v := value.(type) {
+		case []interface{}:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			defaults[name] = strings.Join(items, ",")
+		case map[string]interface{}:
+			return nil, fmt.Errorf("%s: %s must be a scalar or a list", path, name)
+		default:
+			defaults[name] = fmt.Sprint(v)
+		}
+	}
+	return defaults, nil
+}
+
+// flagEnvName returns the environment variable supplying the default of a flag
+func flagEnvName(flagName string) string {
+	return flagEnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyFlagDefaults fills the defaultable flags not given on the command line from the environment
+// (KLABCTL_<FLAG>) or else from .klabctl/config.yaml
+// Defaults are applied to the flag values without marking the flags as changed, see flagProvided
+func applyFlagDefaults(cmd *cobra.Command) error {
+	fileDefaults, err := loadProjectConfig(projectConfigPath)
+	if err != nil {
+		return &ValidationError{Err: err}
+	}
+
+	var applyErr error
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if applyErr != nil || flag.Changed || !defaultableFlags[flag.Name] {
+			return
+		}
+
+		source := flagEnvName(flag.Name)
+		value, ok := os.LookupEnv(source)
+		if !ok {
+			source = projectConfigPath
+			value, ok = fileDefaults[flag.Name]
+		}
+		if !ok {
+			return
+		}
+
+		if err := flag.Value.Set(value); err != nil {
+			applyErr = newValidationError("invalid value '%s' for --%s from %s: %v", value, flag.Name, source, err)
+			return
+		}
+		applyErr = cmd.Flags().SetAnnotation(flag.Name, flagDefaultAnnotation, []string{source})
+	})
+	return applyErr
+}
+
+// flagProvided reports whether a flag was given on the command line or took a default from the
+// environment or .klabctl/config.yaml
+func flagProvided(cmd *cobra.Command, name string) bool {
+	flag := cmd.Flags().Lookup(name)
+	if flag == nil {
+		return false
+	}
+	_, defaulted := flag.Annotations[flagDefaultAnnotation]
+	return flag.Changed || defaulted
+}
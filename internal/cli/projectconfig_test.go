@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestApplyFlagDefaults(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       string
+		env          map[string]string
+		args         []string
+		wantRef      string
+		wantOutput   string
+		wantDepth    int
+		wantForce    bool
+		wantProvided bool
+		wantError    string
+	}{
+		{name: "flag defaults", wantRef: "main", wantOutput: "text", wantDepth: 1},
+		{name: "config file", config: "stack-ref: v1.2.0\noutput: json\nclone-depth: 0\n", wantRef: "v1.2.0", wantOutput: "json", wantDepth: 0, wantProvided: true},
+		{name: "list in config file", config: "output: [json]\n", wantRef: "main", wantOutput: "json", wantDepth: 1},
+		{name: "environment over config file", config: "stack-ref: v1.2.0\n", env: map[string]string{"KLABCTL_STACK_REF": "v2.0.0"}, wantRef: "v2.0.0", wantOutput: "text", wantDepth: 1},
+		{name: "command line over environment", env: map[string]string{"KLABCTL_STACK_REF": "v2.0.0"}, args: []string{"--stack-ref", "v3.0.0"}, wantRef: "v3.0.0", wantOutput: "text", wantDepth: 1},
+		{name: "clone depth from environment", env: map[string]string{"KLABCTL_CLONE_DEPTH": "5"}, wantRef: "main", wantOutput: "text", wantDepth: 5, wantProvided: true},
+		{name: "clone depth on the command line", args: []string{"--clone-depth", "1"}, wantRef: "main", wantOutput: "text", wantDepth: 1, wantProvided: true},
+		{name: "unlisted flag from environment is ignored", env: map[string]string{"KLABCTL_FORCE": "true"}, wantRef: "main", wantOutput: "text", wantDepth: 1},
+		{name: "unlisted flag in config file", config: "force: true\n", wantError: "force cannot be set in the project config"},
+		{name: "invalid value", env: map[string]string{"KLABCTL_CLONE_DEPTH": "many"}, wantError: "invalid value 'many' for --clone-depth from KLABCTL_CLONE_DEPTH"},
+		{name: "mapping in config file", config: "stack-ref:\n  name: main\n", wantError: "stack-ref must be a scalar or a list"},
+		{name: "invalid config file", config: "stack-ref: [\n", wantError: "failed to parse"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			if tt.config != "" {
+				writeTestFile(t, projectConfigPath, tt.config)
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			var ref, output string
+			var depth int
+			var force bool
+			cmd := &cobra.Command{Use: "test", Run: func(cmd *cobra.Command, args []string) {}}
+			cmd.Flags().StringVar(&ref, "stack-ref", "main", "")
+			cmd.Flags().StringVarP(&output, "output", "o", "text", "")
+			cmd.Flags().IntVar(&depth, "clone-depth", 1, "")
+			cmd.Flags().BoolVar(&force, "force", false, "")
+			if err := cmd.ParseFlags(tt.args); err != nil {
+				t.Fatal(err)
+			}
+
+			err := applyFlagDefaults(cmd)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+				}
+				if exitCode(err) != exitCodeValidation {
+					t.Errorf("exit code = %d, want %d", exitCode(err), exitCodeValidation)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyFlagDefaults: %v", err)
+			}
+			if ref != tt.wantRef || output != tt.wantOutput || depth != tt.wantDepth || force != tt.wantForce {
+				t.Errorf("flags = %s %s %d %t, want %s %s %d %t", ref, output, depth, force, tt.wantRef, tt.wantOutput, tt.wantDepth, tt.wantForce)
+			}
+			if got := flagProvided(cmd, "clone-depth"); got != tt.wantProvided {
+				t.Errorf("clone-depth provided = %t, want %t", got, tt.wantProvided)
+			}
+			if cmd.Flags().Changed("output") && len(tt.args) == 0 {
+				t.Error("a default marked --output as changed")
+			}
+		})
+	}
+}
+
+func TestPullConfiguredCloneDepth(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      string
+		env         map[string]string
+		wantCommits string
+	}{
+		{name: "cache keeps its depth", wantCommits: "1"},
+		{name: "depth from config file", config: "clone-depth: 0\n", wantCommits: "3"},
+		{name: "depth from environment", env: map[string]string{"KLABCTL_CLONE_DEPTH": "2"}, wantCommits: "2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := newTestUpstream(t, nil, 3)
+			cacheDir := filepath.Join(stackCacheDirRoot, testStackRef)
+			if err := os.RemoveAll(cacheDir); err != nil {
+				t.Fatal(err)
+			}
+			runTestGit(t, ".", cloneArgs(source, testStackRef, cacheDir, 1)...)
+			writeTestSite(t, testClusterSite("demo", source, testStackRef))
+			if tt.config != "" {
+				writeTestFile(t, projectConfigPath, tt.config)
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			sitePath = filepath.Join("clusters", "demo", "site.yaml")
+			t.Cleanup(func() { sitePath, pullCloneDepth = "", 1 })
+
+			cmd := newPullCmd()
+			if err := cmd.ParseFlags(nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := applyFlagDefaults(cmd); err != nil {
+				t.Fatalf("applyFlagDefaults: %v", err)
+			}
+			var err error
+			captureStderr(t, func() { err = cmd.RunE(cmd, nil) })
+			if err != nil {
+				t.Fatalf("pull: %v", err)
+			}
+
+			if got := strings.TrimSpace(runTestGit(t, cacheDir, "rev-list", "--count", "HEAD")); got != tt.wantCommits {
+				t.Errorf("commits = %s, want %s", got, tt.wantCommits)
+			}
+		})
+	}
+}
@@ -6,28 +6,62 @@ import (
 	"os/exec"
 	"path/filepath"
 
-	"github.com/bamaas/klabctl/internal/config"
 	"github.com/spf13/cobra"
 )
 
 func newProvisionInfraCmd() *cobra.Command {
+
+	var skipValidate bool
+	var planOut string
+	var applyPlan string
+
 	cmd := &cobra.Command{
 		Use:   "provision",
 		Short: "Provision infrastructure using Terraform",
-		Long:  "Runs terraform init and apply to provision VMs",
+		Long: `Runs terraform init and apply to provision VMs.
+
+Plan review and apply can be separated, e.g. in CI:
+  # Write the plan to a file without applying it
+  klabctl provision --plan-out plan.tfplan
+
+  # Apply exactly the reviewed plan
+  klabctl provision --apply-plan plan.tfplan`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			site, err := config.LoadSiteFromFile(sitePath)
+			site, err := loadSite(sitePath)
 			if err != nil {
 				return fmt.Errorf("load site: %w", err)
 			}
+			setHistoryRef(cmd, site.Spec.Stack.Ref)
 
 			if site.Spec.Infra.Provider == "" {
-				return fmt.Errorf("no infrastructure provider configured in site.yaml")
+				return newValidationError("no infrastructure provider configured in site.yaml")
 			}
 
 			name := site.Metadata.Name
 			if name == "" {
-				return fmt.Errorf("metadata.name is required")
+				return newValidationError("metadata.name is required")
+			}
+
+			// Catch malformed provider configuration before terraform runs
+			if _, err := site.Spec.Infra.GetActiveTypedConfig(); err != nil {
+				return &ValidationError{Err: err}
+			}
+			if err := site.Spec.Infra.ValidateNodes(); err != nil {
+				return &ValidationError{Err: err}
+			}
+
+			if planOut != "" && applyPlan != "" {
+				return newValidationError("--plan-out and --apply-plan cannot be combined")
+			}
+
+			// terraform runs with -chdir, so plan files are passed as absolute paths
+			planOutPath, err := resolvePlanOutPath(planOut)
+			if err != nil {
+				return err
+			}
+			applyPlanPath, err := resolveApplyPlanPath(applyPlan)
+			if err != nil {
+				return err
 			}
 
 			terraformDir := filepath.Join("clusters", name, "infra", "generated")
@@ -37,7 +71,7 @@ func newProvisionInfraCmd() *cobra.Command {
 			}
 
 			if _, err := exec.LookPath("terraform"); err != nil {
-				return fmt.Errorf("terraform not found in PATH")
+				return &ToolNotFoundError{Tool: "terraform"}
 			}
 
 			fmt.Printf("Provisioning infrastructure for site: %s\n\n", name)
@@ -52,10 +86,42 @@ func newProvisionInfraCmd() *cobra.Command {
 				return fmt.Errorf("terraform init failed: %w", err)
 			}
 
-			// terraform apply
+			// terraform validate, catch errors in the generated configuration before touching infrastructure
+			// A saved plan was validated when it was created
+			if !skipValidate && applyPlanPath == "" {
+				fmt.Println("\nRunning terraform validate...")
+				cmdValidate := exec.Command("terraform", "-chdir="+terraformDir, "validate")
+				cmdValidate.Stdout = os.Stdout
+				cmdValidate.Stderr = os.Stderr
+				cmdValidate.Env = os.Environ()
+				if err := cmdValidate.Run(); err != nil {
+					return fmt.Errorf("terraform validate failed, check the generated configuration in %s: %w", terraformDir, err)
+				}
+			}
+
+			// terraform plan, write the plan for a later --apply-plan and stop
+			if planOutPath != "" {
+				fmt.Println("\nRunning terraform plan...")
+				cmdPlan := exec.Command("terraform", "-chdir="+terraformDir, "plan",
+					"-var-file=terraform.tfvars.json", "-out="+planOutPath)
+				cmdPlan.Stdout = os.Stdout
+				cmdPlan.Stderr = os.Stderr
+				cmdPlan.Env = os.Environ()
+				if err := cmdPlan.Run(); err != nil {
+					return fmt.Errorf("terraform plan failed: %w", err)
+				}
+
+				statusf(os.Stdout, "\n✓ Plan written to %s\n", planOut)
+				return nil
+			}
+
+			// terraform apply, a saved plan already contains the variables
+			applyArgs := []string{"-chdir=" + terraformDir, "apply", "-var-file=terraform.tfvars.json", "-auto-approve"}
+			if applyPlanPath != "" {
+				applyArgs = []string{"-chdir=" + terraformDir, "apply", "-auto-approve", applyPlanPath}
+			}
 			fmt.Println("\nRunning terraform apply...")
-			cmdApply := exec.Command("terraform", "-chdir="+terraformDir, "apply",
-				"-var-file=terraform.tfvars.json", "-auto-approve")
+			cmdApply := exec.Command("terraform", applyArgs...)
 			cmdApply.Stdout = os.Stdout
 			cmdApply.Stderr = os.Stderr
 			cmdApply.Env = os.Environ()
@@ -63,10 +129,56 @@ func newProvisionInfraCmd() *cobra.Command {
 				return fmt.Errorf("terraform apply failed: %w", err)
 			}
 
-			fmt.Println("\n✓ Infrastructure provisioned successfully")
+			statusln(os.Stdout, "\n✓ Infrastructure provisioned successfully")
 
 			return nil
 		},
 	}
+
+	cmd.Flags().BoolVar(&skipValidate, "skip-validate", false, "Skip terraform validate before apply")
+	cmd.Flags().StringVar(&planOut, "plan-out", "", "Run terraform plan and write the plan to this file instead of applying")
+	cmd.Flags().StringVar(&applyPlan, "apply-plan", "", "Apply a plan file written by --plan-out (terraform.tfvars.json is not used)")
+
 	return cmd
 }
+
+// resolvePlanOutPath validates the --plan-out path and returns it as an absolute path
+func resolvePlanOutPath(planOut string) (string, error) {
+	if planOut == "" {
+		return "", nil
+	}
+
+	path, err := filepath.Abs(planOut)
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return "", newValidationError("--plan-out %s is a directory", planOut)
+	}
+	if info, err := os.Stat(filepath.Dir(path)); err != nil || !info.IsDir() {
+		return "", newValidationError("--plan-out directory %s does not exist", filepath.Dir(planOut))
+	}
+
+	return path, nil
+}
+
+// resolveApplyPlanPath validates the --apply-plan file and returns it as an absolute path
+func resolveApplyPlanPath(applyPlan string) (string, error) {
+	if applyPlan == "" {
+		return "", nil
+	}
+
+	path, err := filepath.Abs(applyPlan)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", newValidationError("--apply-plan %s not found", applyPlan)
+	}
+	if !info.Mode().IsRegular() {
+		return "", newValidationError("--apply-plan %s is not a file", applyPlan)
+	}
+
+	return path, nil
+}
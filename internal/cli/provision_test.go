@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useFakeTerraform puts a terraform script first in PATH that logs its subcommands and fails the
+// subcommand failOn. It returns the log path
+func useFakeTerraform(t *testing.T, failOn string) string {
+	t.Helper()
+	binDir := t.TempDir()
+	logPath := filepath.Join(binDir, "terraform.log")
+	script := `#!/bin/sh
+echo "$2" >> "` + logPath + `"
+if [ "$2" = "` + failOn + `" ]; then
+  exit 1
+fi
+`
+	if err := os.WriteFile(filepath.Join(binDir, "terraform"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return logPath
+}
+
+// runTestProvision runs provision with args on clusters/demo/site.yaml
+func runTestProvision(t *testing.T, args ...string) error {
+	t.Helper()
+	sitePath = filepath.Join("clusters", "demo", "site.yaml")
+	t.Cleanup(func() { sitePath = "" })
+
+	cmd := newProvisionInfraCmd()
+	cmd.SetArgs(args)
+	cmd.SilenceUsage = true
+	cmd.SilenceErrors = true
+
+	var err error
+	captureStdout(t, func() { err = cmd.Execute() })
+	return err
+}
+
+func TestProvisionValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		failOn    string
+		want      []string
+		wantError string
+	}{
+		{name: "validate before apply", want: []string{"init", "validate", "apply"}},
+		{name: "skip validate", args: []string{"--skip-validate"}, want: []string{"init", "apply"}},
+		{name: "invalid configuration is not applied", failOn: "validate", want: []string{"init", "validate"}, wantError: "terraform validate failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			writeTestSite(t, testSiteYaml)
+			if err := os.MkdirAll(filepath.Join("clusters", "demo", "infra", "generated"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			logPath := useFakeTerraform(t, tt.failOn)
+
+			err := runTestProvision(t, tt.args...)
+			if tt.wantError == "" && err != nil {
+				t.Fatalf("provision: %v", err)
+			}
+			if tt.wantError != "" && (err == nil || !strings.Contains(err.Error(), tt.wantError)) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+			}
+
+			if got := strings.Fields(readTestFile(t, logPath)); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("terraform ran %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProvisionPlanFiles(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		want      []string
+		wantError string
+	}{
+		{name: "plan out", args: []string{"--plan-out", "site.tfplan"}, want: []string{"init", "validate", "plan"}},
+		{name: "apply plan", args: []string{"--apply-plan", "saved.tfplan"}, want: []string{"init", "apply"}},
+		{name: "both flags", args: []string{"--plan-out", "site.tfplan", "--apply-plan", "saved.tfplan"}, wantError: "cannot be combined"},
+		{name: "plan out is a directory", args: []string{"--plan-out", "clusters"}, wantError: "is a directory"},
+		{name: "plan out directory missing", args: []string{"--plan-out", "missing/site.tfplan"}, wantError: "does not exist"},
+		{name: "apply plan missing", args: []string{"--apply-plan", "missing.tfplan"}, wantError: "not found"},
+		{name: "apply plan is a directory", args: []string{"--apply-plan", "clusters"}, wantError: "is not a file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			writeTestSite(t, testSiteYaml)
+			writeTestFile(t, "saved.tfplan", "plan")
+			if err := os.MkdirAll(filepath.Join("clusters", "demo", "infra", "generated"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			logPath := useFakeTerraform(t, "")
+
+			err := runTestProvision(t, tt.args...)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+				}
+				if exitCode(err) != exitCodeValidation {
+					t.Errorf("exit code = %d, want %d", exitCode(err), exitCodeValidation)
+				}
+				if _, err := os.Stat(logPath); err == nil {
+					t.Errorf("terraform ran after an invalid plan flag: %v", strings.Fields(readTestFile(t, logPath)))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("provision: %v", err)
+			}
+
+			if got := strings.Fields(readTestFile(t, logPath)); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("terraform ran %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
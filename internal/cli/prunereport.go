@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/bamaas/klabctl/internal/config"
+)
+
+// staleAppDir is an app directory in the cluster apps tree without an enabled catalog entry
+type staleAppDir struct {
+	Path string
+	Size int64
+}
+
+// findStaleAppDirs returns the apps/<project>/<namespace>/<app> directories of a cluster that
+// don't belong to an enabled app at its current project and namespace, sorted by path
+func findStaleAppDirs(site *config.Site) ([]staleAppDir, error) {
+	appsPath := filepath.Join("clusters", site.Metadata.Name, "apps")
+
+	enabled := make(map[string]bool)
+	for name, component := range site.Spec.Apps.Catalog {
+		if component.Enabled {
+			enabled[filepath.Join(appsPath, component.Project, component.Namespace, name)] = true
+		}
+	}
+
+	appDirs, err := filepath.Glob(filepath.Join(appsPath, "*", "*", "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var stale []staleAppDir
+	for _, dir := range appDirs {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() || enabled[dir] {
+			continue
+		}
+
+		size, err := dirSize(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to size %s: %w", dir, err)
+		}
+		stale = append(stale, staleAppDir{Path: dir, Size: size})
+	}
+
+	sort.Slice(stale, func(i, j int) bool { return stale[i].Path < stale[j].Path })
+	return stale, nil
+}
+
+// dirSize returns the total size of the regular files below dir
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
+// printPruneReport lists the stale app directories of a cluster with their size, nothing is removed
+func printPruneReport(w io.Writer, site *config.Site) error {
+	stale, err := findStaleAppDirs(site)
+	if err != nil {
+		return fmt.Errorf("failed to find stale app directories: %w", err)
+	}
+
+	if len(stale) == 0 {
+		statusf(w, "✓ No stale app directories in clusters/%s/apps\n", site.Metadata.Name)
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	var total int64
+	for _, dir := range stale {
+		fmt.Fprintf(tw, "%s\t%s\n", dir.Path, formatSize(dir.Size))
+		total += dir.Size
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%d stale app %s (%s) not enabled in the catalog\n", len(stale), pluralize(len(stale), "directory", "directories"), formatSize(total))
+	return nil
+}
+
+// formatSize formats a byte count with a binary unit, e.g. 1.5 KiB
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// pluralize returns singular for a count of one and plural otherwise
+func pluralize(count int, singular, plural string) string {
+	if count == 1 {
+		return singular
+	}
+	return plural
+}
@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindStaleAppDirs(t *testing.T) {
+	appsPath := filepath.Join("clusters", "demo", "apps")
+
+	tests := []struct {
+		name    string
+		disable string
+		dirs    []string
+		want    []staleAppDir
+	}{
+		{
+			name: "enabled apps only",
+			dirs: []string{"system/apps/pihole", "system/apps/external-dns"},
+		},
+		{
+			name: "removed app",
+			dirs: []string{"system/apps/pihole", "system/apps/cilium"},
+			want: []staleAppDir{{Path: filepath.Join(appsPath, "system", "apps", "cilium"), Size: 4}},
+		},
+		{
+			name:    "disabled app",
+			disable: "pihole",
+			dirs:    []string{"system/apps/pihole"},
+			want:    []staleAppDir{{Path: filepath.Join(appsPath, "system", "apps", "pihole"), Size: 4}},
+		},
+		{
+			name: "app moved to another namespace",
+			dirs: []string{"system/dns/pihole"},
+			want: []staleAppDir{{Path: filepath.Join(appsPath, "system", "dns", "pihole"), Size: 4}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			site := parseTestSite(t, testSiteYaml)
+			if tt.disable != "" {
+				component := site.Spec.Apps.Catalog[tt.disable]
+				component.Enabled = false
+				site.Spec.Apps.Catalog[tt.disable] = component
+			}
+			for _, dir := range tt.dirs {
+				writeTestFile(t, filepath.Join(appsPath, filepath.FromSlash(dir), "generated", "kustomization.yaml"), "a: b")
+			}
+			// Files in the apps tree aren't app directories
+			writeTestFile(t, filepath.Join(appsPath, "system", "apps", "README.md"), "# apps\n")
+
+			got, err := findStaleAppDirs(site)
+			if err != nil {
+				t.Fatalf("findStaleAppDirs: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findStaleAppDirs = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintPruneReport(t *testing.T) {
+	t.Chdir(t.TempDir())
+	colorPolicy = colorNever
+	t.Cleanup(func() { colorPolicy = colorAuto })
+	site := parseTestSite(t, testSiteYaml)
+
+	var out bytes.Buffer
+	if err := printPruneReport(&out, site); err != nil {
+		t.Fatalf("printPruneReport: %v", err)
+	}
+	if want := "[ok] No stale app directories in clusters/demo/apps\n"; out.String() != want {
+		t.Errorf("report = %q, want %q", out.String(), want)
+	}
+
+	writeTestFile(t, filepath.Join("clusters", "demo", "apps", "system", "apps", "cilium", "kustomization.yaml"), strings.Repeat("x", 2048))
+	out.Reset()
+	if err := printPruneReport(&out, site); err != nil {
+		t.Fatalf("printPruneReport: %v", err)
+	}
+	if want := "1 stale app directory (2.0 KiB) not enabled in the catalog\n"; !strings.HasSuffix(out.String(), want) {
+		t.Errorf("report = %q, want it to end with %q", out.String(), want)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		size int64
+		want string
+	}{
+		{size: 0, want: "0 B"},
+		{size: 1023, want: "1023 B"},
+		{size: 1536, want: "1.5 KiB"},
+		{size: 5 << 20, want: "5.0 MiB"},
+		{size: 3 << 30, want: "3.0 GiB"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := formatSize(tt.size); got != tt.want {
+				t.Errorf("formatSize(%d) = %s, want %s", tt.size, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,20 +1,37 @@
 package cli
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/bamaas/klabctl/internal/config"
 	"github.com/spf13/cobra"
 )
 
+// stackRemoteCheckTimeout bounds asking the remote where a cached tag points to
+const stackRemoteCheckTimeout = 10 * time.Second
+
 var (
-	pullForce         bool
+	pullForce       bool
+	pullAllClusters bool
+	pullConcurrency int
+	// pullValidateOnly checks the existing cache without fetching, repairing or cloning
+	pullValidateOnly bool
+	// pullCloneDepth is the git clone depth of a pulled stack, 0 clones the full history
+	pullCloneDepth    = 1
 	hiddenKlabctlDir  = filepath.Join(".klabctl")
 	stackCacheDirRoot = filepath.Join(hiddenKlabctlDir, "cache", "stack")
+	// stackMaxAttempts bounds how often EnsureStackAvailable re-pulls a corrupted cache
+	stackMaxAttempts = 3
 )
 
 func newPullCmd() *cobra.Command {
@@ -23,25 +40,168 @@ func newPullCmd() *cobra.Command {
 		Short: "Pull and validate stack cache",
 		Long:  "Ensures the stack is cached and valid, pulling or repairing as needed",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if pullValidateOnly && (pullForce || pullAllClusters) {
+				return newValidationError("--validate-only cannot be combined with --force or --all-clusters")
+			}
+
+			if pullAllClusters {
+				return pullAllClusterStacks(pullForce, pullConcurrency, flagProvided(cmd, "clone-depth"))
+			}
+
 			// Load site.yaml to get stack info
-			site, err := config.LoadSiteFromFile(sitePath)
+			site, err := loadSite(sitePath)
 			if err != nil {
 				return fmt.Errorf("failed to load site.yaml: %w", err)
 			}
+			setHistoryRef(cmd, site.Spec.Stack.Ref)
 
 			if site.Spec.Stack.Source == "" || site.Spec.Stack.Ref == "" {
-				return fmt.Errorf("stack.source and stack.ref are required in site.yaml")
+				return newValidationError("stack.source and stack.ref are required in site.yaml")
 			}
 
-			return EnsureStackAvailable(site.Spec.Stack.Source, site.Spec.Stack.Ref, pullForce)
+			if pullValidateOnly {
+				if err := validateStackCache(site.Spec.Stack.Ref, site.Spec.Stack.Subdir); err != nil {
+					return err
+				}
+				statusf(os.Stderr, "✓ Cached stack %s is valid\n", site.Spec.Stack.Ref)
+				return nil
+			}
+
+			// An explicit pull always runs the full check
+			forgetStackValidation(getStackCacheDir(site))
+			if err := EnsureStackAvailable(site.Spec.Stack.Source, site.Spec.Stack.Ref, site.Spec.Stack.Subdir, pullForce); err != nil {
+				return err
+			}
+
+			// An existing cache keeps the depth it was cloned with unless --clone-depth is passed or configured
+			if flagProvided(cmd, "clone-depth") {
+				return applyCloneDepth(getStackCacheDir(site), site.Spec.Stack.Ref, pullCloneDepth)
+			}
+			return nil
 		},
 	}
 
 	cmd.Flags().BoolVar(&pullForce, "force", false, "Force re-pull stack even if cached")
+	cmd.Flags().BoolVar(&pullAllClusters, "all-clusters", false, "Pull the stacks of all clusters found in clusters/*/site.yaml")
+	cmd.Flags().IntVar(&pullConcurrency, "concurrency", 1, "Number of stacks to pull in parallel (used with --all-clusters)")
+	cmd.Flags().BoolVar(&pullValidateOnly, "validate-only", false, "Only check that the cache is present, on the site's ref and unmodified, without fetching or repairing")
+	cmd.Flags().IntVar(&pullCloneDepth, "clone-depth", 1, "Git clone depth of the stack, 0 clones the full history (also deepens or shallows an existing shallow cache)")
 
 	return cmd
 }
 
+// stackCoordinate identifies a cached stack by source and ref, with the subdirectories the clusters use
+type stackCoordinate struct {
+	Source  string
+	Ref     string
+	Subdirs []string
+}
+
+// discoverClusterSites returns the paths of all clusters/*/site.yaml files
+func discoverClusterSites() ([]string, error) {
+	sitePaths, err := filepath.Glob(filepath.Join("clusters", "*", "site.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(sitePaths)
+	return sitePaths, nil
+}
+
+// pullAllClusterStacks pulls the distinct stacks referenced by all cluster site.yaml files
+// With applyDepth, existing caches are deepened or made shallow to pullCloneDepth as well
+func pullAllClusterStacks(force bool, concurrency int, applyDepth bool) error {
+	sitePaths, err := discoverClusterSites()
+	if err != nil {
+		return fmt.Errorf("failed to discover clusters: %w", err)
+	}
+	if len(sitePaths) == 0 {
+		return fmt.Errorf("no clusters found in clusters/*/site.yaml")
+	}
+
+	// Collect distinct stacks, the cache is keyed by ref so a ref can only map to one source
+	// Clusters sharing a ref may use different subdirectories of it, each one is validated
+	var stacks []stackCoordinate
+	stackByRef := make(map[string]int)
+	for _, path := range sitePaths {
+		site, err := loadSite(path)
+		if err != nil {
+			return fmt.Errorf("failed to load %s: %w", path, err)
+		}
+
+		source, ref := site.Spec.Stack.Source, site.Spec.Stack.Ref
+		if source == "" || ref == "" {
+			return newValidationError("stack.source and stack.ref are required in %s", path)
+		}
+
+		subdir := site.Spec.Stack.Subdir
+		if i, ok := stackByRef[ref]; ok {
+			if stacks[i].Source != source {
+				return fmt.Errorf("ref '%s' is used with different sources (%s and %s)", ref, stacks[i].Source, source)
+			}
+			if !containsString(stacks[i].Subdirs, subdir) {
+				stacks[i].Subdirs = append(stacks[i].Subdirs, subdir)
+			}
+			continue
+		}
+		stackByRef[ref] = len(stacks)
+		stacks = append(stacks, stackCoordinate{Source: source, Ref: ref, Subdirs: []string{subdir}})
+	}
+
+	fmt.Fprintf(os.Stderr, "Pulling %d distinct stacks for %d clusters...\n", len(stacks), len(sitePaths))
+
+	if err := createHiddenKlabctlDir(); err != nil {
+		return fmt.Errorf("failed to create %s directory: %w", hiddenKlabctlDir, err)
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	// Pull stacks with a bounded number of workers, the subdirectories of a ref are validated in turn
+	// since they share its cache
+	results := make([]error, len(stacks))
+	semaphore := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, stack := range stacks {
+		wg.Add(1)
+		go func(i int, stack stackCoordinate) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			stackCacheDir := filepath.Join(stackCacheDirRoot, stack.Ref)
+			forgetStackValidation(stackCacheDir)
+			for j, subdir := range stack.Subdirs {
+				// Force only re-pulls the cache once
+				if results[i] = EnsureStackAvailable(stack.Source, stack.Ref, subdir, force && j == 0); results[i] != nil {
+					break
+				}
+			}
+			if results[i] == nil && applyDepth {
+				results[i] = applyCloneDepth(stackCacheDir, stack.Ref, pullCloneDepth)
+			}
+		}(i, stack)
+	}
+	wg.Wait()
+
+	// Report per ref status
+	failed := 0
+	fmt.Fprintln(os.Stderr)
+	for i, stack := range stacks {
+		if results[i] != nil {
+			failed++
+			statusf(os.Stderr, "✗ %s@%s: %v\n", stack.Source, stack.Ref, results[i])
+			continue
+		}
+		statusf(os.Stderr, "✓ %s@%s\n", stack.Source, stack.Ref)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed to pull %d of %d stacks", failed, len(stacks))
+	}
+
+	return nil
+}
+
 func createHiddenKlabctlDir() error {
 	// Create hidden klabctl directory
 	if _, err := os.Stat(hiddenKlabctlDir); os.IsNotExist(err) {
@@ -73,14 +233,52 @@ func getStackCacheDir(site *config.Site) string {
 	return filepath.Join(stackCacheDirRoot, site.Spec.Stack.Ref)
 }
 
+// getStackRepoDir returns the path to the stack repository a site renders from,
+// the checkout in opts.stackRepo when set, else the cached ref
+func getStackRepoDir(site *config.Site, opts generateOptions) string {
+	if opts.stackRepo != "" {
+		return opts.stackRepo
+	}
+	return getStackCacheDir(site)
+}
+
+// getStackRoot returns the path to the stack/ directory a site renders from, honoring spec.stack.subdir
+func getStackRoot(site *config.Site, opts generateOptions) string {
+	if opts.stackRepo != "" {
+		return filepath.Join(opts.stackRepo, "stack")
+	}
+	return stackRootDir(site.Spec.Stack.Ref, site.Spec.Stack.Subdir)
+}
+
+// stackRootDir returns the path to the stack/ directory of a cached ref with the stack in subdir
+func stackRootDir(ref, subdir string) string {
+	return filepath.Join(stackCacheDirRoot, ref, subdir, "stack")
+}
+
 // getStackTemplatesDir returns the path to the stack templates directory in cache
-func getStackTemplatesDir(site *config.Site) string {
-	return filepath.Join(getStackCacheDir(site), "stack", "templates")
+func getStackTemplatesDir(site *config.Site, opts generateOptions) string {
+	return filepath.Join(getStackRoot(site, opts), "templates")
 }
 
 // getStackAppsDir returns the path to the stack apps directory in cache
-func getStackAppsDir(site *config.Site) string {
-	return filepath.Join(getStackCacheDir(site), "stack", "apps")
+func getStackAppsDir(site *config.Site, opts generateOptions) string {
+	return filepath.Join(getStackRoot(site, opts), "apps")
+}
+
+// getAppBaseDir returns the path to an app's base in cache, honoring the component's basePath override
+func getAppBaseDir(site *config.Site, opts generateOptions, appName string) (string, error) {
+	basePath := site.Spec.Apps.Catalog[appName].BasePath
+	if basePath == "" {
+		return filepath.Join(getStackAppsDir(site, opts), appName, "base"), nil
+	}
+
+	// basePath is relative to the stack repository and may not point outside of it
+	cleanPath := filepath.Clean(basePath)
+	if filepath.IsAbs(cleanPath) || cleanPath == ".." || strings.HasPrefix(cleanPath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("basePath '%s' of app %s must be relative to the stack repository", basePath, appName)
+	}
+
+	return filepath.Join(getStackRepoDir(site, opts), cleanPath), nil
 }
 
 // isGitRepo checks if a directory is a git repository
@@ -120,8 +318,121 @@ func getCachedVersion(stackDir string) (string, error) {
 	return branch, nil
 }
 
-// isValidCache validates the cache integrity using git
-func isValidCache(stackDir string) bool {
+// resolveCachedCommit returns the full commit SHA the cache is checked out at
+func resolveCachedCommit(stackDir string) (string, error) {
+	if !isGitRepo(stackDir) {
+		return "", fmt.Errorf("not a git repository")
+	}
+
+	output, err := exec.Command("git", "-C", stackDir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get git commit: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// verifyCachedRef checks that the cache is checked out at ref
+// A tag or commit checkout reports a short SHA, so the ref is compared by the commit it resolves to
+func verifyCachedRef(stackDir, ref string) error {
+	currentRef, err := getCachedVersion(stackDir)
+	if err != nil {
+		return fmt.Errorf("cannot determine cache ref: %w", err)
+	}
+	if currentRef == ref {
+		return nil
+	}
+
+	head, err := exec.Command("git", "-C", stackDir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return fmt.Errorf("failed to get git commit: %w", err)
+	}
+	want, err := exec.Command("git", "-C", stackDir, "rev-parse", "--verify", "--quiet", ref+"^{commit}").Output()
+	if err != nil || strings.TrimSpace(string(want)) != strings.TrimSpace(string(head)) {
+		return fmt.Errorf("stack cache %s is on %s instead of the requested ref %s, run 'klabctl pull --force'", stackDir, currentRef, ref)
+	}
+
+	return nil
+}
+
+// verifyStackSubdir checks that the cached ref holds a stack/ directory in subdir
+// A repaired cache is valid as a checkout, but a subdir the ref doesn't have can't be repaired
+func verifyStackSubdir(ref, subdir string) error {
+	if _, err := os.Stat(stackRootDir(ref, subdir)); err != nil {
+		location := "the repository root"
+		if subdir != "" {
+			location = subdir
+		}
+		return fmt.Errorf("stack %s has no stack/ directory in %s", ref, location)
+	}
+	return nil
+}
+
+// checkMovedTag compares the commit of a cached tag with the commit the tag points to on the remote
+// Refs that aren't tags are reported as not moved, a remote that can't be reached in
+// stackRemoteCheckTimeout (e.g. offline) is returned as an error
+func checkMovedTag(stackDir, ref string) (cached, remote string, moved bool, err error) {
+	if err := exec.Command("git", "-C", stackDir, "rev-parse", "--verify", "--quiet", "refs/tags/"+ref).Run(); err != nil {
+		return "", "", false, nil
+	}
+
+	output, err := exec.Command("git", "-C", stackDir, "rev-parse", "refs/tags/"+ref+"^{commit}").Output()
+	if err != nil {
+		return "", "", false, nil
+	}
+	cached = strings.TrimSpace(string(output))
+
+	// An annotated tag is listed twice, the peeled ^{} line holds the commit
+	ctx, cancel := context.WithTimeout(context.Background(), stackRemoteCheckTimeout)
+	defer cancel()
+	output, err = exec.CommandContext(ctx, "git", "-C", stackDir, "ls-remote", "--tags", "origin", "refs/tags/"+ref, "refs/tags/"+ref+"^{}").Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return cached, "", false, fmt.Errorf("git ls-remote failed: %w", err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if fields[1] == "refs/tags/"+ref+"^{}" || remote == "" {
+			remote = fields[0]
+		}
+	}
+
+	return cached, remote, remote != "" && remote != cached, nil
+}
+
+// shortSHA abbreviates a commit SHA for messages
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
+
+// validateStackCache checks the cached stack of ref without touching it or the network
+// The error names the reason: missing, not a git repository, on another ref, or modified
+func validateStackCache(ref, subdir string) error {
+	stackCacheDir := filepath.Join(stackCacheDirRoot, ref)
+	if _, err := os.Stat(stackCacheDir); os.IsNotExist(err) {
+		return &CacheError{Err: fmt.Errorf("stack %s is not cached at %s, run 'klabctl pull'", ref, stackCacheDir)}
+	}
+	if !isGitRepo(stackCacheDir) {
+		return &CacheError{Err: fmt.Errorf("stack cache %s is not a git repository", stackCacheDir)}
+	}
+	if err := verifyCachedRef(stackCacheDir, ref); err != nil {
+		return &CacheError{Err: err}
+	}
+	if !isValidCache(stackCacheDir, subdir) {
+		return &CacheError{Err: fmt.Errorf("stack cache %s has modified files or misses stack directories, run 'klabctl pull' to repair it", stackCacheDir)}
+	}
+	return nil
+}
+
+// isValidCache validates the cache integrity using git, the stack/ directory is expected in subdir
+func isValidCache(stackDir, subdir string) bool {
 	if !isGitRepo(stackDir) {
 		return false
 	}
@@ -140,9 +451,9 @@ func isValidCache(stackDir string) bool {
 
 	// Check required stack directories exist
 	requiredPaths := []string{
-		filepath.Join(stackDir, "stack"),
-		filepath.Join(stackDir, "stack/apps"),
-		filepath.Join(stackDir, "stack/templates"),
+		filepath.Join(stackDir, subdir, "stack"),
+		filepath.Join(stackDir, subdir, "stack", "apps"),
+		filepath.Join(stackDir, subdir, "stack", "templates"),
 	}
 
 	for _, path := range requiredPaths {
@@ -160,7 +471,7 @@ func repairCache(stackDir string) error {
 		return fmt.Errorf("not a git repository")
 	}
 
-	fmt.Fprintln(os.Stderr, "🔧 Repairing cache...")
+	statusln(os.Stderr, "🔧 Repairing cache...")
 
 	// Reset to clean state
 	cmd := exec.Command("git", "-C", stackDir, "reset", "--hard", "HEAD")
@@ -174,16 +485,17 @@ func repairCache(stackDir string) error {
 		return fmt.Errorf("git clean failed: %w", err)
 	}
 
-	fmt.Fprintln(os.Stderr, "✓ Cache repaired")
+	statusln(os.Stderr, "✓ Cache repaired")
 	return nil
 }
 
 // updateGitRepo updates an existing git repository to a specific version
+// Git output is progress and goes to stderr, stdout is reserved for command output such as get defaults
 func updateGitRepo(dir, version string) error {
 	// Fetch latest
 	fmt.Fprintln(os.Stderr, "Fetching updates...")
 	cmd := exec.Command("git", "-C", dir, "fetch", "origin")
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = os.Stderr
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("git fetch failed: %w", err)
@@ -191,7 +503,7 @@ func updateGitRepo(dir, version string) error {
 
 	// Checkout requested version
 	cmd = exec.Command("git", "-C", dir, "checkout", version)
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = os.Stderr
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("git checkout failed: %w", err)
@@ -204,11 +516,28 @@ func updateGitRepo(dir, version string) error {
 	return nil
 }
 
+// refreshStack fetches and fast-forwards an existing cache so branch refs reflect the remote
+// A missing cache is left for EnsureStackAvailable to pull
+func refreshStack(ref string) error {
+	stackCacheDir := filepath.Join(stackCacheDirRoot, ref)
+	if !isGitRepo(stackCacheDir) {
+		return nil
+	}
+
+	statusf(os.Stderr, "🔄 Refreshing cached stack %s...\n", ref)
+	forgetStackValidation(stackCacheDir)
+	if err := updateGitRepo(stackCacheDir, ref); err != nil {
+		return fmt.Errorf("failed to refresh stack: %w", err)
+	}
+
+	return nil
+}
+
 // pullStack clones the stack repository to the cache directory
-func pullStack(source, version, destDir string) error {
+func pullStack(source, version, destDir string, depth int) error {
 	// Check if git is available
 	if _, err := exec.LookPath("git"); err != nil {
-		return fmt.Errorf("git not found in PATH")
+		return &ToolNotFoundError{Tool: "git"}
 	}
 
 	// Remove existing directory if it exists
@@ -221,9 +550,9 @@ func pullStack(source, version, destDir string) error {
 		return fmt.Errorf("failed to create cache directory: %w", err)
 	}
 
-	// Clone repository
-	cmd := exec.Command("git", "clone", "--depth", "1", "--branch", version, source, destDir)
-	cmd.Stdout = os.Stdout
+	// Clone repository, git output goes to stderr like all progress messages
+	cmd := exec.Command("git", cloneArgs(source, version, destDir, depth)...)
+	cmd.Stdout = os.Stderr
 	cmd.Stderr = os.Stderr
 
 	if err := cmd.Run(); err != nil {
@@ -235,12 +564,89 @@ func pullStack(source, version, destDir string) error {
 	return nil
 }
 
+// applyCloneDepth brings the history of an existing cache to depth, 0 fetches the full history
+// A full clone is left as is, it already holds every commit a shallower depth would
+func applyCloneDepth(stackDir, ref string, depth int) error {
+	output, err := exec.Command("git", "-C", stackDir, "rev-parse", "--is-shallow-repository").Output()
+	if err != nil {
+		return &CacheError{Err: fmt.Errorf("failed to check the clone depth of %s: %w", stackDir, err)}
+	}
+	if strings.TrimSpace(string(output)) != "true" {
+		return nil
+	}
+
+	args := []string{"-C", stackDir, "fetch", "--unshallow", "origin"}
+	if depth > 0 {
+		args = []string{"-C", stackDir, "fetch", "--depth", strconv.Itoa(depth), "origin", ref}
+	}
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return &CacheError{Err: fmt.Errorf("failed to change the clone depth of %s to %d: %w (run 'klabctl pull --force --clone-depth %d' to clone it again)", stackDir, depth, err, depth)}
+	}
+
+	if depth > 0 {
+		statusf(os.Stderr, "✓ Stack cache %s has a clone depth of %d\n", ref, depth)
+	} else {
+		statusf(os.Stderr, "✓ Stack cache %s holds the full history\n", ref)
+	}
+	return nil
+}
+
+// cloneArgs returns the git clone arguments for a stack, a depth of 0 or less clones the full history
+func cloneArgs(source, version, destDir string, depth int) []string {
+	args := []string{"clone"}
+	if depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(depth))
+	}
+	return append(args, "--branch", version, source, destDir)
+}
+
 // EnsureStackAvailable ensures the stack is cached and valid, pulling/repairing as needed
 // This is the main function that implements the "always validate" strategy
-func EnsureStackAvailable(source, ref string, force bool) error {
+// A corrupted cache is re-pulled at most stackMaxAttempts times before giving up
+// A cache that passed the full check within stackValidationTTL is used without running git
+// A cached tag is only compared with the remote on pull, --refresh or once stackRemoteCheckTTL has passed
+func EnsureStackAvailable(source, ref, subdir string, force bool) error {
+	stackCacheDir := filepath.Join(stackCacheDirRoot, ref)
+	if !force && isRecentlyValidated(stackCacheDir, ref, subdir) {
+		statusf(os.Stderr, "✓ Using cached stack %s\n", ref)
+		return nil
+	}
+	checkRemote := force || remoteCheckDue(stackCacheDir)
+
+	var causes []error
+	for attempt := 1; attempt <= stackMaxAttempts; attempt++ {
+		retry, err := ensureStackOnce(source, ref, subdir, force, checkRemote)
+		if !retry {
+			if err == nil {
+				// Never render from a cache that ended up on another version than requested
+				err = verifyCachedRef(stackCacheDir, ref)
+			}
+			if err == nil {
+				err = verifyStackSubdir(ref, subdir)
+			}
+			if err != nil {
+				return &CacheError{Err: err}
+			}
+			recordStackValidation(stackCacheDir, ref, subdir, checkRemote)
+			return nil
+		}
+		causes = append(causes, err)
+
+		// Force only applies to the first attempt
+		force = false
+	}
+
+	return &CacheError{Err: fmt.Errorf("stack %s@%s still unavailable after %d attempts: %w", source, ref, stackMaxAttempts, errors.Join(causes...))}
+}
 
+// ensureStackOnce makes a single attempt at making the stack available
+// Returns retry=true with the cause when the cache was removed and has to be pulled again
+func ensureStackOnce(source, ref, subdir string, force, checkRemote bool) (bool, error) {
 	if err := createHiddenKlabctlDir(); err != nil {
-		return fmt.Errorf("failed to create %s directory: %w", hiddenKlabctlDir, err)
+		return false, fmt.Errorf("failed to create %s directory: %w", hiddenKlabctlDir, err)
 	}
 
 	stackCacheDir := filepath.Join(stackCacheDirRoot, ref)
@@ -257,83 +663,98 @@ func EnsureStackAvailable(source, ref string, force bool) error {
 	// Check if directory exists
 	if _, err := os.Stat(stackCacheDir); os.IsNotExist(err) {
 		// Cache doesn't exist - clone it
-		fmt.Fprintf(os.Stderr, "📦 Pulling stack %s@%s...\n", source, ref)
-		if err := pullStack(source, ref, stackCacheDir); err != nil {
-			return fmt.Errorf("failed to pull stack: %w", err)
+		statusf(os.Stderr, "📦 Pulling stack %s@%s...\n", source, ref)
+		if err := pullStack(source, ref, stackCacheDir, pullCloneDepth); err != nil {
+			return false, fmt.Errorf("failed to pull stack: %w", err)
 		}
-		fmt.Fprintln(os.Stderr, "✓ Stack pulled successfully")
-		return nil
+		statusln(os.Stderr, "✓ Stack pulled successfully")
+		return false, nil
 	}
 
 	// Cache exists - validate it
 	if !isGitRepo(stackCacheDir) {
 		// Not a git repo (corrupted) - remove and re-clone
-		fmt.Fprintln(os.Stderr, "⚠ Cache is not a git repository, re-pulling...")
+		statusln(os.Stderr, "⚠ Cache is not a git repository, re-pulling...")
 		if err := os.RemoveAll(stackCacheDir); err != nil {
-			return fmt.Errorf("failed to remove invalid cache: %w", err)
+			return false, fmt.Errorf("failed to remove invalid cache: %w", err)
+		}
+		return true, fmt.Errorf("cache is not a git repository")
+	}
+
+	// A tag force-moved upstream leaves the cache on the old commit, pull it again
+	if checkRemote {
+		cached, remote, moved, err := checkMovedTag(stackCacheDir, ref)
+		if err != nil {
+			warnf("could not check whether tag %s moved upstream, using the cached commit: %v", ref, err)
+		}
+		if moved {
+			statusf(os.Stderr, "⚠ Tag %s moved upstream from %s to %s, re-pulling stack...\n", ref, shortSHA(cached), shortSHA(remote))
+			if err := os.RemoveAll(stackCacheDir); err != nil {
+				return false, fmt.Errorf("failed to remove stale cache: %w", err)
+			}
+			return true, fmt.Errorf("tag %s moved upstream", ref)
 		}
-		return EnsureStackAvailable(source, ref, false)
 	}
 
 	// Check current version
 	currentRef, err := getCachedVersion(stackCacheDir)
 	if err != nil {
 		// Can't determine ref (corrupted) - re-clone
-		fmt.Fprintf(os.Stderr, "⚠ Cannot determine cache ref: %v\n", err)
-		fmt.Fprintln(os.Stderr, "⚠ Re-pulling stack...")
-		if err := os.RemoveAll(stackCacheDir); err != nil {
-			return fmt.Errorf("failed to remove invalid cache: %w", err)
+		statusf(os.Stderr, "⚠ Cannot determine cache ref: %v\n", err)
+		statusln(os.Stderr, "⚠ Re-pulling stack...")
+		if rmErr := os.RemoveAll(stackCacheDir); rmErr != nil {
+			return false, fmt.Errorf("failed to remove invalid cache: %w", rmErr)
 		}
-		return EnsureStackAvailable(source, ref, false)
+		return true, fmt.Errorf("cannot determine cache ref: %w", err)
 	}
 
-	// Already on correct version?
-	if currentRef == ref {
+	// Already on correct version? A tag checkout reports its commit, so it is compared by commit
+	if currentRef == ref || verifyCachedRef(stackCacheDir, ref) == nil {
 		// Validate integrity
-		if !isValidCache(stackCacheDir) {
-			fmt.Fprintln(os.Stderr, "⚠ Cache is corrupted or has modifications")
+		if !isValidCache(stackCacheDir, subdir) {
+			statusln(os.Stderr, "⚠ Cache is corrupted or has modifications")
 			// Try to repair
 			if err := repairCache(stackCacheDir); err != nil {
 				// Repair failed - re-clone
-				fmt.Fprintf(os.Stderr, "⚠ Repair failed: %v\n", err)
-				fmt.Fprintln(os.Stderr, "⚠ Re-pulling stack...")
-				if err := os.RemoveAll(stackCacheDir); err != nil {
-					return fmt.Errorf("failed to remove invalid cache: %w", err)
+				statusf(os.Stderr, "⚠ Repair failed: %v\n", err)
+				statusln(os.Stderr, "⚠ Re-pulling stack...")
+				if rmErr := os.RemoveAll(stackCacheDir); rmErr != nil {
+					return false, fmt.Errorf("failed to remove invalid cache: %w", rmErr)
 				}
-				return EnsureStackAvailable(source, ref, false)
+				return true, fmt.Errorf("repair failed: %w", err)
 			}
 		}
 
-		fmt.Fprintf(os.Stderr, "✓ Using cached stack %s\n", ref)
-		return nil
+		statusf(os.Stderr, "✓ Using cached stack %s\n", ref)
+		return false, nil
 	}
 
 	// Different version - switch to requested version
 	fmt.Fprintf(os.Stderr, "Switching cache from %s to %s...\n", currentRef, ref)
 	if err := updateGitRepo(stackCacheDir, ref); err != nil {
 		// Update failed - re-clone
-		fmt.Fprintf(os.Stderr, "⚠ Version switch failed: %v\n", err)
-		fmt.Fprintln(os.Stderr, "⚠ Re-pulling stack...")
-		if err := os.RemoveAll(stackCacheDir); err != nil {
-			return fmt.Errorf("failed to remove invalid cache: %w", err)
+		statusf(os.Stderr, "⚠ Version switch failed: %v\n", err)
+		statusln(os.Stderr, "⚠ Re-pulling stack...")
+		if rmErr := os.RemoveAll(stackCacheDir); rmErr != nil {
+			return false, fmt.Errorf("failed to remove invalid cache: %w", rmErr)
 		}
-		return EnsureStackAvailable(source, ref, false)
+		return true, fmt.Errorf("version switch failed: %w", err)
 	}
 
 	// Validate after switching
-	if !isValidCache(stackCacheDir) {
-		fmt.Fprintln(os.Stderr, "⚠ Cache invalid after version switch")
+	if !isValidCache(stackCacheDir, subdir) {
+		statusln(os.Stderr, "⚠ Cache invalid after version switch")
 		if err := repairCache(stackCacheDir); err != nil {
-			fmt.Fprintf(os.Stderr, "⚠ Repair failed: %v\n", err)
-			fmt.Fprintln(os.Stderr, "⚠ Re-pulling stack...")
-			if err := os.RemoveAll(stackCacheDir); err != nil {
-				return fmt.Errorf("failed to remove invalid cache: %w", err)
+			statusf(os.Stderr, "⚠ Repair failed: %v\n", err)
+			statusln(os.Stderr, "⚠ Re-pulling stack...")
+			if rmErr := os.RemoveAll(stackCacheDir); rmErr != nil {
+				return false, fmt.Errorf("failed to remove invalid cache: %w", rmErr)
 			}
-			return EnsureStackAvailable(source, ref, false)
+			return true, fmt.Errorf("repair after version switch failed: %w", err)
 		}
 	}
 
-	fmt.Fprintln(os.Stderr, "✓ Cache switched and validated")
+	statusln(os.Stderr, "✓ Cache switched and validated")
 
-	return nil
+	return false, nil
 }
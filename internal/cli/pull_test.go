@@ -0,0 +1,556 @@
+package cli
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestUpstream creates a bare repository of a test stack with apps holding the given number of commits
+// on branch main and returns its file:// URL
+func newTestUpstream(t testing.TB, apps map[string]testApp, commits int) string {
+	t.Helper()
+	upstream := useTestStack(t, apps)
+	commitTestStack(t, upstream)
+	for i := 1; i < commits; i++ {
+		runTestGit(t, upstream, "commit", "-q", "--allow-empty", "-m", "change")
+	}
+
+	// Move the repository out of the cache, it acts as the remote
+	remoteDir := filepath.Join(t.TempDir(), "stack.git")
+	runTestGit(t, ".", "clone", "-q", "--bare", upstream, remoteDir)
+	return "file://" + remoteDir
+}
+
+func TestApplyCloneDepth(t *testing.T) {
+	tests := []struct {
+		name        string
+		cloneDepth  int
+		depth       int
+		wantCommits string
+		wantShallow string
+	}{
+		{name: "unshallow", cloneDepth: 1, depth: 0, wantCommits: "3", wantShallow: "false"},
+		{name: "deepen", cloneDepth: 1, depth: 2, wantCommits: "2", wantShallow: "true"},
+		{name: "full clone is kept", cloneDepth: 0, depth: 1, wantCommits: "3", wantShallow: "false"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := newTestUpstream(t, nil, 3)
+			cacheDir := filepath.Join(t.TempDir(), "main")
+			runTestGit(t, ".", cloneArgs(source, "main", cacheDir, tt.cloneDepth)...)
+
+			if err := applyCloneDepth(cacheDir, "main", tt.depth); err != nil {
+				t.Fatalf("applyCloneDepth: %v", err)
+			}
+
+			if got := strings.TrimSpace(runTestGit(t, cacheDir, "rev-list", "--count", "HEAD")); got != tt.wantCommits {
+				t.Errorf("commits = %s, want %s", got, tt.wantCommits)
+			}
+			if got := strings.TrimSpace(runTestGit(t, cacheDir, "rev-parse", "--is-shallow-repository")); got != tt.wantShallow {
+				t.Errorf("shallow = %s, want %s", got, tt.wantShallow)
+			}
+		})
+	}
+}
+
+func TestApplyCloneDepthUnreachableRemote(t *testing.T) {
+	source := newTestUpstream(t, nil, 2)
+	cacheDir := filepath.Join(t.TempDir(), "main")
+	runTestGit(t, ".", cloneArgs(source, "main", cacheDir, 1)...)
+	runTestGit(t, cacheDir, "remote", "set-url", "origin", "file://"+filepath.Join(t.TempDir(), "missing.git"))
+
+	err := applyCloneDepth(cacheDir, "main", 0)
+	if err == nil || !strings.Contains(err.Error(), "klabctl pull --force --clone-depth 0") {
+		t.Errorf("error = %v, want a hint to clone again", err)
+	}
+}
+
+// testClusterSite returns testSiteYaml for cluster name on the stack source and ref
+func testClusterSite(name, source, ref string) string {
+	site := strings.Replace(testSiteYaml, "name: demo", "name: "+name, 1)
+	site = strings.Replace(site, "https://example.com/stack.git", source, 1)
+	return strings.Replace(site, "ref: main", "ref: "+ref, 1)
+}
+
+// testSubdirClusterSite returns testClusterSite with the stack kept in subdir of the repository
+func testSubdirClusterSite(name, source, ref, subdir string) string {
+	site := testClusterSite(name, source, ref)
+	if subdir == "" {
+		return site
+	}
+	return strings.Replace(site, "    ref: "+ref+"\n", "    ref: "+ref+"\n    subdir: "+subdir+"\n", 1)
+}
+
+func TestPullAllClusterStacks(t *testing.T) {
+	type cluster struct{ source, ref, subdir string }
+	tests := []struct {
+		name      string
+		clusters  map[string]cluster
+		wantRefs  []string
+		wantError string
+	}{
+		{
+			name:     "shared ref is pulled once",
+			clusters: map[string]cluster{"a": {"upstream", "main", ""}, "b": {"upstream", "main", ""}},
+			wantRefs: []string{"main"},
+		},
+		{
+			name:     "distinct refs",
+			clusters: map[string]cluster{"a": {"upstream", "main", ""}, "b": {"upstream", "v2", ""}},
+			wantRefs: []string{"main", "v2"},
+		},
+		{
+			name:     "shared ref with distinct subdirs",
+			clusters: map[string]cluster{"a": {"upstream", "main", ""}, "b": {"upstream", "main", "nested"}},
+			wantRefs: []string{"main"},
+		},
+		{
+			name:      "shared ref with a missing subdir",
+			clusters:  map[string]cluster{"a": {"upstream", "main", ""}, "b": {"upstream", "main", "missing"}},
+			wantError: "failed to pull 1 of 1 stacks",
+		},
+		{
+			name:      "ref with different sources",
+			clusters:  map[string]cluster{"a": {"upstream", "main", ""}, "b": {"https://example.com/other.git", "main", ""}},
+			wantError: "is used with different sources",
+		},
+		{
+			name:      "no clusters",
+			wantError: "no clusters found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := newTestUpstream(t, nil, 1)
+			// The repository also holds a copy of the stack in nested/
+			pushDir := filepath.Join(t.TempDir(), "push")
+			runTestGit(t, ".", "clone", "-q", source, pushDir)
+			if err := copyDir(filepath.Join(pushDir, "stack"), filepath.Join(pushDir, "nested", "stack")); err != nil {
+				t.Fatal(err)
+			}
+			runTestGit(t, pushDir, "add", "-A")
+			runTestGit(t, pushDir, "commit", "-q", "-m", "nested stack")
+			runTestGit(t, pushDir, "push", "-q", "origin", testStackRef)
+			runTestGit(t, strings.TrimPrefix(source, "file://"), "branch", "v2", "main")
+			t.Chdir(t.TempDir())
+			for name, c := range tt.clusters {
+				if c.source == "upstream" {
+					c.source = source
+				}
+				writeTestFile(t, filepath.Join("clusters", name, "site.yaml"), testSubdirClusterSite(name, c.source, c.ref, c.subdir))
+			}
+
+			var err error
+			captureStderr(t, func() { err = pullAllClusterStacks(false, 2, false) })
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("pullAllClusterStacks: %v", err)
+			}
+
+			entries, err := os.ReadDir(stackCacheDirRoot)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var refs []string
+			for _, entry := range entries {
+				refs = append(refs, entry.Name())
+			}
+			if !reflect.DeepEqual(refs, tt.wantRefs) {
+				t.Errorf("cached refs = %v, want %v", refs, tt.wantRefs)
+			}
+		})
+	}
+}
+
+func TestEnsureStackAvailableAttempts(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxAttempts int
+		corrupt     bool
+		missing     bool
+		wantError   string
+	}{
+		{name: "fresh pull", maxAttempts: 3},
+		{name: "corrupted cache is pulled again", maxAttempts: 3, corrupt: true},
+		{name: "attempts are bounded", maxAttempts: 1, corrupt: true, wantError: "still unavailable after 1 attempts"},
+		{name: "unreachable source", maxAttempts: 3, missing: true, wantError: "failed to pull stack"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := newTestUpstream(t, nil, 1)
+			if tt.missing {
+				source = "file://" + filepath.Join(t.TempDir(), "missing.git")
+			}
+			t.Chdir(t.TempDir())
+			if tt.corrupt {
+				writeTestFile(t, filepath.Join(stackCacheDirRoot, testStackRef, "stack", "README.md"), "not a clone\n")
+			}
+			attempts := stackMaxAttempts
+			stackMaxAttempts = tt.maxAttempts
+			t.Cleanup(func() { stackMaxAttempts = attempts })
+
+			err := EnsureStackAvailable(source, testStackRef, "", false)
+			if tt.wantError == "" {
+				if err != nil {
+					t.Fatalf("EnsureStackAvailable: %v", err)
+				}
+				if !isGitRepo(filepath.Join(stackCacheDirRoot, testStackRef)) {
+					t.Error("cache is not a git repository")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+			}
+			if exitCode(err) != exitCodeCacheMissing {
+				t.Errorf("exit code = %d, want %d", exitCode(err), exitCodeCacheMissing)
+			}
+		})
+	}
+}
+
+// pushTestCommit pushes an empty commit to branch main of the upstream at source and returns it
+func pushTestCommit(t testing.TB, source string) string {
+	t.Helper()
+	pushDir := filepath.Join(t.TempDir(), "push")
+	runTestGit(t, ".", "clone", "-q", source, pushDir)
+	runTestGit(t, pushDir, "commit", "-q", "--allow-empty", "-m", "upstream change")
+	runTestGit(t, pushDir, "push", "-q", "origin", testStackRef)
+	return strings.TrimSpace(runTestGit(t, pushDir, "rev-parse", "HEAD"))
+}
+
+func TestRefreshStack(t *testing.T) {
+	tests := []struct {
+		name   string
+		cached bool
+	}{
+		{name: "cached branch is updated", cached: true},
+		{name: "nothing cached", cached: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := newTestUpstream(t, nil, 1)
+			t.Chdir(t.TempDir())
+			cacheDir := filepath.Join(stackCacheDirRoot, testStackRef)
+			if tt.cached {
+				if err := EnsureStackAvailable(source, testStackRef, "", false); err != nil {
+					t.Fatalf("EnsureStackAvailable: %v", err)
+				}
+			}
+			upstream := pushTestCommit(t, source)
+			colorPolicy = colorNever
+			t.Cleanup(func() { colorPolicy = colorAuto })
+
+			var err error
+			stderr := captureStderr(t, func() { err = refreshStack(testStackRef) })
+			if err != nil {
+				t.Fatalf("refreshStack: %v", err)
+			}
+
+			if !tt.cached {
+				if _, err := os.Stat(cacheDir); !os.IsNotExist(err) {
+					t.Errorf("refresh created a cache: %v", err)
+				}
+				return
+			}
+			if head := strings.TrimSpace(runTestGit(t, cacheDir, "rev-parse", "HEAD")); head != upstream {
+				t.Errorf("cache is on %s, want the upstream commit %s", head, upstream)
+			}
+			if isRecentlyValidated(cacheDir, testStackRef, "") {
+				t.Error("refreshed cache keeps its validation record")
+			}
+			if !strings.HasPrefix(stderr, "[refresh] Refreshing cached stack main...\n") {
+				t.Errorf("stderr doesn't start with the ASCII refresh marker:\n%s", stderr)
+			}
+		})
+	}
+}
+
+func TestGetAppBaseDir(t *testing.T) {
+	tests := []struct {
+		name     string
+		basePath string
+		want     string
+		wantErr  bool
+	}{
+		{name: "default", want: filepath.Join(stackCacheDirRoot, "main", "stack", "apps", "pihole", "base")},
+		{name: "override", basePath: "bases/pihole", want: filepath.Join(stackCacheDirRoot, "main", "bases", "pihole")},
+		{name: "override is cleaned", basePath: "bases/../shared/pihole/", want: filepath.Join(stackCacheDirRoot, "main", "shared", "pihole")},
+		{name: "escaping the repository", basePath: "../other/pihole", wantErr: true},
+		{name: "absolute", basePath: "/srv/pihole", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			site := parseTestSite(t, testSiteYaml)
+			component := site.Spec.Apps.Catalog["pihole"]
+			component.BasePath = tt.basePath
+			site.Spec.Apps.Catalog["pihole"] = component
+
+			got, err := getAppBaseDir(site, generateOptions{}, "pihole")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getAppBaseDir error = %v, want an error: %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("getAppBaseDir = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyCachedRef(t *testing.T) {
+	tests := []struct {
+		name     string
+		checkout []string
+		ref      string
+		wantErr  bool
+	}{
+		{name: "branch", ref: "main"},
+		{name: "tag", checkout: []string{"--detach", "v1"}, ref: "v1"},
+		{name: "commit", checkout: []string{"--detach", "v1"}, ref: "first"},
+		{name: "other branch", checkout: []string{"-b", "feature", "v1"}, ref: "main", wantErr: true},
+		{name: "other commit", checkout: []string{"--detach", "v1"}, ref: "main", wantErr: true},
+		{name: "unknown ref", ref: "v9", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := useTestStack(t, testStackApps)
+			commitTestStack(t, cacheDir)
+			first := strings.TrimSpace(runTestGit(t, cacheDir, "rev-parse", "HEAD"))
+			runTestGit(t, cacheDir, "tag", "v1")
+			runTestGit(t, cacheDir, "commit", "-q", "--allow-empty", "-m", "second")
+			if tt.checkout != nil {
+				runTestGit(t, cacheDir, append([]string{"checkout", "-q"}, tt.checkout...)...)
+			}
+			ref := tt.ref
+			if ref == "first" {
+				ref = first
+			}
+
+			err := verifyCachedRef(cacheDir, ref)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyCachedRef(%s) = %v, want an error: %t", ref, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckMovedTag(t *testing.T) {
+	tests := []struct {
+		name        string
+		ref         string
+		move        bool
+		unreachable bool
+		wantMoved   bool
+		wantErr     bool
+	}{
+		{name: "tag unchanged", ref: "v1"},
+		{name: "tag moved upstream", ref: "v1", move: true, wantMoved: true},
+		{name: "branch", ref: testStackRef, move: true},
+		{name: "remote unreachable", ref: "v1", move: true, unreachable: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := newTestUpstream(t, nil, 1)
+			pushDir := filepath.Join(t.TempDir(), "push")
+			runTestGit(t, ".", "clone", "-q", source, pushDir)
+			runTestGit(t, pushDir, "tag", "v1")
+			runTestGit(t, pushDir, "push", "-q", "origin", "v1")
+			t.Chdir(t.TempDir())
+			if err := EnsureStackAvailable(source, tt.ref, "", false); err != nil {
+				t.Fatalf("EnsureStackAvailable: %v", err)
+			}
+			cacheDir := filepath.Join(stackCacheDirRoot, tt.ref)
+
+			var upstream string
+			if tt.move {
+				runTestGit(t, pushDir, "commit", "-q", "--allow-empty", "-m", "retagged")
+				runTestGit(t, pushDir, "tag", "-f", "v1")
+				runTestGit(t, pushDir, "push", "-q", "-f", "origin", testStackRef, "v1")
+				upstream = strings.TrimSpace(runTestGit(t, pushDir, "rev-parse", "HEAD"))
+			}
+			if tt.unreachable {
+				runTestGit(t, cacheDir, "remote", "set-url", "origin", "file://"+filepath.Join(t.TempDir(), "missing.git"))
+			}
+
+			_, remote, moved, err := checkMovedTag(cacheDir, tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkMovedTag error = %v, want an error: %t", err, tt.wantErr)
+			}
+			if moved != tt.wantMoved {
+				t.Fatalf("checkMovedTag moved = %t, want %t", moved, tt.wantMoved)
+			}
+			if !tt.wantMoved {
+				return
+			}
+			if remote != upstream {
+				t.Errorf("remote commit = %s, want %s", remote, upstream)
+			}
+
+			// Without a recent validation the moved tag is pulled again
+			if err := os.Remove(stackValidationPath(cacheDir)); err != nil {
+				t.Fatal(err)
+			}
+			captureStderr(t, func() { err = EnsureStackAvailable(source, tt.ref, "", false) })
+			if err != nil {
+				t.Fatalf("EnsureStackAvailable: %v", err)
+			}
+			if head := strings.TrimSpace(runTestGit(t, cacheDir, "rev-parse", "HEAD")); head != upstream {
+				t.Errorf("cache is on %s, want the moved tag's commit %s", head, upstream)
+			}
+		})
+	}
+}
+
+func TestEnsureStackAvailableRemoteCheck(t *testing.T) {
+	tests := []struct {
+		name          string
+		remoteChecked time.Duration
+		unreachable   bool
+		wantRepulled  bool
+		wantWarnings  int
+	}{
+		{name: "remote checked recently", remoteChecked: time.Minute},
+		{name: "remote check due", remoteChecked: 2 * stackRemoteCheckTTL, wantRepulled: true},
+		{name: "unreachable remote warns", remoteChecked: 2 * stackRemoteCheckTTL, unreachable: true, wantWarnings: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := newTestUpstream(t, nil, 1)
+			pushDir := filepath.Join(t.TempDir(), "push")
+			runTestGit(t, ".", "clone", "-q", source, pushDir)
+			runTestGit(t, pushDir, "tag", "v1")
+			runTestGit(t, pushDir, "push", "-q", "origin", "v1")
+			t.Chdir(t.TempDir())
+			if err := EnsureStackAvailable(source, "v1", "", false); err != nil {
+				t.Fatalf("EnsureStackAvailable: %v", err)
+			}
+			cacheDir := filepath.Join(stackCacheDirRoot, "v1")
+			cached := strings.TrimSpace(runTestGit(t, cacheDir, "rev-parse", "HEAD"))
+
+			runTestGit(t, pushDir, "commit", "-q", "--allow-empty", "-m", "retagged")
+			runTestGit(t, pushDir, "tag", "-f", "v1")
+			runTestGit(t, pushDir, "push", "-q", "-f", "origin", "v1")
+			upstream := strings.TrimSpace(runTestGit(t, pushDir, "rev-parse", "HEAD"))
+			if tt.unreachable {
+				runTestGit(t, cacheDir, "remote", "set-url", "origin", "file://"+filepath.Join(t.TempDir(), "missing.git"))
+			}
+
+			// The full check runs, the remote check only when it is due
+			record, ok := readStackValidation(cacheDir)
+			if !ok {
+				t.Fatal("no validation record")
+			}
+			record.ValidatedAt = time.Now().Add(-2 * stackValidationTTL)
+			record.RemoteCheckedAt = time.Now().Add(-tt.remoteChecked)
+			data, err := json.Marshal(record)
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeTestFile(t, stackValidationPath(cacheDir), string(data))
+
+			warningCount = 0
+			t.Cleanup(func() { warningCount = 0 })
+			captureStderr(t, func() { err = EnsureStackAvailable(source, "v1", "", false) })
+			if err != nil {
+				t.Fatalf("EnsureStackAvailable: %v", err)
+			}
+
+			want := cached
+			if tt.wantRepulled {
+				want = upstream
+			}
+			if head := strings.TrimSpace(runTestGit(t, cacheDir, "rev-parse", "HEAD")); head != want {
+				t.Errorf("cache is on %s, want %s", head, want)
+			}
+			if warningCount != tt.wantWarnings {
+				t.Errorf("warnings = %d, want %d", warningCount, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestValidateStackCache(t *testing.T) {
+	tests := []struct {
+		name      string
+		setup     func(t *testing.T, cacheDir string)
+		wantError string
+	}{
+		{
+			name:  "valid cache",
+			setup: func(t *testing.T, cacheDir string) {},
+		},
+		{
+			name: "not cached",
+			setup: func(t *testing.T, cacheDir string) {
+				if err := os.RemoveAll(cacheDir); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantError: "is not cached",
+		},
+		{
+			name: "not a git repository",
+			setup: func(t *testing.T, cacheDir string) {
+				if err := os.RemoveAll(filepath.Join(cacheDir, ".git")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantError: "is not a git repository",
+		},
+		{
+			name: "on another ref",
+			setup: func(t *testing.T, cacheDir string) {
+				runTestGit(t, cacheDir, "commit", "-q", "--allow-empty", "-m", "second")
+				runTestGit(t, cacheDir, "checkout", "-q", "-b", "feature", "HEAD~1")
+			},
+			wantError: "instead of the requested ref",
+		},
+		{
+			name: "modified file",
+			setup: func(t *testing.T, cacheDir string) {
+				writeTestFile(t, filepath.Join(cacheDir, "stack", "apps", "pihole", "values.yaml"), "host: changed\n")
+			},
+			wantError: "has modified files",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := useTestStack(t, testStackApps)
+			commitTestStack(t, cacheDir)
+			tt.setup(t, cacheDir)
+
+			err := validateStackCache(testStackRef, "")
+			if tt.wantError == "" {
+				if err != nil {
+					t.Errorf("validateStackCache: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+			}
+			if exitCode(err) != exitCodeCacheMissing {
+				t.Errorf("exit code = %d, want %d", exitCode(err), exitCodeCacheMissing)
+			}
+		})
+	}
+}
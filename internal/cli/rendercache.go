@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bamaas/klabctl/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+var renderCacheDirRoot = filepath.Join(hiddenKlabctlDir, "cache", "render")
+
+// renderCacheKey hashes everything a component's rendered output depends on:
+// the stack ref, the content of the templates used and the site (templates receive the full site and catalog)
+func renderCacheKey(site *config.Site, opts generateOptions, componentName string, templateNames []string) (string, error) {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "ref:%s\ncomponent:%s\nlabels:%t\ninput-hash:%s\n", renderedStackRef(site, opts), componentName, opts.emitKustomizeLabels, opts.inputHashes[componentName])
+
+	siteData, err := yaml.Marshal(site)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal site: %w", err)
+	}
+	fmt.Fprintf(hash, "site:%d\n", len(siteData))
+	hash.Write(siteData)
+
+	templates := append([]string{"header.kustomization.yaml.tmpl", "base.kustomization.yaml.tmpl"}, templateNames...)
+	for _, templateName := range templates {
+		content, err := readTemplateFromCache(site, opts, templateName)
+		if err != nil {
+			return "", fmt.Errorf("failed to read template %s: %w", templateName, err)
+		}
+		fmt.Fprintf(hash, "template:%s:%d\n", templateName, len(content))
+		hash.Write(content)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// restoreRenderCache copies the cached outputs for key into outputDir
+// Returns the number of restored files, 0 on a cache miss
+func restoreRenderCache(key, outputDir string) (int, error) {
+	entries, err := os.ReadDir(filepath.Join(renderCacheDirRoot, key))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	restored := 0
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if err := copyFile(filepath.Join(renderCacheDirRoot, key, entry.Name()), filepath.Join(outputDir, entry.Name())); err != nil {
+			return restored, fmt.Errorf("failed to restore %s from render cache: %w", entry.Name(), err)
+		}
+		restored++
+	}
+
+	return restored, nil
+}
+
+// storeRenderCache stores the rendered files of outputDir under key
+// Entries are written to a temporary directory first so a partial entry is never restored
+func storeRenderCache(key, outputDir string, fileNames []string) error {
+	if err := createHiddenKlabctlDir(); err != nil {
+		return fmt.Errorf("failed to create %s directory: %w", hiddenKlabctlDir, err)
+	}
+	if err := os.MkdirAll(renderCacheDirRoot, 0755); err != nil {
+		return err
+	}
+
+	tmpDir, err := os.MkdirTemp(renderCacheDirRoot, key+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for _, fileName := range fileNames {
+		if err := copyFile(filepath.Join(outputDir, fileName), filepath.Join(tmpDir, fileName)); err != nil {
+			return fmt.Errorf("failed to store %s in render cache: %w", fileName, err)
+		}
+	}
+
+	entryDir := filepath.Join(renderCacheDirRoot, key)
+	if err := os.Rename(tmpDir, entryDir); err != nil {
+		// Another run stored the same entry in the meantime
+		if _, statErr := os.Stat(entryDir); statErr == nil {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
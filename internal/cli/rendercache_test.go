@@ -0,0 +1,158 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bamaas/klabctl/internal/config"
+)
+
+func TestRenderCacheKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(t *testing.T, site *config.Site, opts *generateOptions)
+		changed bool
+	}{
+		{
+			name:    "unchanged inputs",
+			change:  func(t *testing.T, site *config.Site, opts *generateOptions) {},
+			changed: false,
+		},
+		{
+			name: "values of another app",
+			change: func(t *testing.T, site *config.Site, opts *generateOptions) {
+				site.Spec.Apps.Catalog["pihole"].Values["host"] = "dns.lan"
+			},
+			changed: true,
+		},
+		{
+			name: "stack ref",
+			change: func(t *testing.T, site *config.Site, opts *generateOptions) {
+				opts.pinnedRef = "abc123"
+			},
+			changed: true,
+		},
+		{
+			name: "labels",
+			change: func(t *testing.T, site *config.Site, opts *generateOptions) {
+				opts.emitKustomizeLabels = true
+			},
+			changed: true,
+		},
+		{
+			name: "header template",
+			change: func(t *testing.T, site *config.Site, opts *generateOptions) {
+				path := filepath.Join(getStackTemplatesDir(site, generateOptions{}), "header.kustomization.yaml.tmpl")
+				writeTestFile(t, path, readTestFile(t, path)+"\n# changed\n")
+			},
+			changed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestStack(t, testStackApps)
+			site := parseTestSite(t, testSiteYaml)
+			var opts generateOptions
+			templates := []string{"apps/external-dns/templates/kustomization.yaml.tmpl"}
+
+			before, err := renderCacheKey(site, opts, "external-dns", templates)
+			if err != nil {
+				t.Fatalf("renderCacheKey: %v", err)
+			}
+			tt.change(t, site, &opts)
+			after, err := renderCacheKey(site, opts, "external-dns", templates)
+			if err != nil {
+				t.Fatalf("renderCacheKey: %v", err)
+			}
+
+			if (before != after) != tt.changed {
+				t.Errorf("key changed = %t, want %t", before != after, tt.changed)
+			}
+		})
+	}
+}
+
+func TestRenderCacheHit(t *testing.T) {
+	const marker = "# restored from the render cache\n"
+
+	tests := []struct {
+		name    string
+		change  func(t *testing.T, site *config.Site)
+		wantHit bool
+	}{
+		{
+			name:    "unchanged inputs",
+			change:  func(t *testing.T, site *config.Site) {},
+			wantHit: true,
+		},
+		{
+			name: "values changed",
+			change: func(t *testing.T, site *config.Site) {
+				site.Spec.Apps.Catalog["external-dns"].Values["interval"] = "2m"
+			},
+			wantHit: false,
+		},
+		{
+			name: "app template changed",
+			change: func(t *testing.T, site *config.Site) {
+				path := filepath.Join(getStackAppsDir(site, generateOptions{}), "external-dns", "templates", "kustomization.yaml.tmpl")
+				writeTestFile(t, path, readTestFile(t, path)+"# changed\n")
+			},
+			wantHit: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestStack(t, testStackApps)
+			site := parseTestSite(t, testSiteYaml)
+			opts := generateOptions{renderCache: true}
+			if _, err := generateAppManifests(site, opts); err != nil {
+				t.Fatalf("generateAppManifests: %v", err)
+			}
+
+			// Mark the cached outputs so a restore is visible
+			entries, err := filepath.Glob(filepath.Join(renderCacheDirRoot, "*", "kustomization.yaml"))
+			if err != nil || len(entries) == 0 {
+				t.Fatalf("no render cache entries stored: %v", err)
+			}
+			for _, entry := range entries {
+				writeTestFile(t, entry, readTestFile(t, entry)+marker)
+			}
+
+			tt.change(t, site)
+			if _, err := generateAppManifests(site, opts); err != nil {
+				t.Fatalf("generateAppManifests: %v", err)
+			}
+
+			kustomization := readTestFile(t, filepath.Join("clusters", "demo", "apps", "system", "apps", "external-dns", "generated", "kustomization.yaml"))
+			if hit := strings.Contains(kustomization, marker); hit != tt.wantHit {
+				t.Errorf("restored from cache = %t, want %t:\n%s", hit, tt.wantHit, kustomization)
+			}
+		})
+	}
+}
+
+func TestStoreRenderCacheIsAtomic(t *testing.T) {
+	t.Chdir(t.TempDir())
+	outputDir := "out"
+	writeTestFile(t, filepath.Join(outputDir, "kustomization.yaml"), "resources: []\n")
+
+	// A missing output leaves no entry behind that could be restored later
+	if err := storeRenderCache("key", outputDir, []string{"kustomization.yaml", "missing.yaml"}); err == nil {
+		t.Fatal("storing a missing output succeeded")
+	}
+	if restored, err := restoreRenderCache("key", t.TempDir()); err != nil || restored != 0 {
+		t.Errorf("restored %d files (%v) from a failed store", restored, err)
+	}
+	leftovers, err := os.ReadDir(renderCacheDirRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leftovers) != 0 {
+		t.Errorf("render cache holds %d entries after a failed store", len(leftovers))
+	}
+}
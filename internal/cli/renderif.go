@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bamaas/klabctl/internal/config"
+)
+
+// applyRenderIf disables the enabled components whose renderIf condition is false and reports them
+// Conditions are all evaluated against the site as loaded, before any component is disabled
+func applyRenderIf(site *config.Site) error {
+	var skipped []string
+	for name, component := range site.Spec.Apps.Catalog {
+		if !component.Enabled || component.RenderIf == "" {
+			continue
+		}
+		render, err := config.EvalRenderIf(component.RenderIf, site)
+		if err != nil {
+			return newValidationError("failed to evaluate renderIf of app %s: %v", name, err)
+		}
+		if !render {
+			skipped = append(skipped, name)
+		}
+	}
+	if len(skipped) == 0 {
+		return nil
+	}
+	sort.Strings(skipped)
+
+	for _, name := range skipped {
+		component := site.Spec.Apps.Catalog[name]
+		component.Enabled = false
+		site.Spec.Apps.Catalog[name] = component
+	}
+	fmt.Fprintf(os.Stderr, "Skipped by renderIf: %s\n", strings.Join(skipped, ", "))
+
+	return nil
+}
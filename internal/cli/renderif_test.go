@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyRenderIf(t *testing.T) {
+	tests := []struct {
+		name        string
+		piholeIf    string
+		dnsIf       string
+		wantEnabled map[string]bool
+		wantStderr  string
+	}{
+		{
+			name:        "no conditions",
+			wantEnabled: map[string]bool{"pihole": true, "external-dns": true},
+		},
+		{
+			name:        "true condition renders",
+			piholeIf:    `metadata.name == "demo"`,
+			wantEnabled: map[string]bool{"pihole": true, "external-dns": true},
+		},
+		{
+			name:        "false condition skips",
+			piholeIf:    `metadata.name == "prod"`,
+			wantEnabled: map[string]bool{"pihole": false, "external-dns": true},
+			wantStderr:  "Skipped by renderIf: pihole\n",
+		},
+		{
+			name:        "conditions see the site as loaded",
+			piholeIf:    `metadata.name == "prod"`,
+			dnsIf:       "spec.apps.catalog.pihole.enabled",
+			wantEnabled: map[string]bool{"pihole": false, "external-dns": true},
+			wantStderr:  "Skipped by renderIf: pihole\n",
+		},
+		{
+			name:        "skipped apps are sorted",
+			piholeIf:    "false",
+			dnsIf:       "false",
+			wantEnabled: map[string]bool{"pihole": false, "external-dns": false},
+			wantStderr:  "Skipped by renderIf: external-dns, pihole\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			site := parseTestSite(t, testSiteYaml)
+			for name, expr := range map[string]string{"pihole": tt.piholeIf, "external-dns": tt.dnsIf} {
+				component := site.Spec.Apps.Catalog[name]
+				component.RenderIf = expr
+				site.Spec.Apps.Catalog[name] = component
+			}
+
+			var err error
+			stderr := captureStderr(t, func() { err = applyRenderIf(site) })
+			if err != nil {
+				t.Fatalf("applyRenderIf: %v", err)
+			}
+			if stderr != tt.wantStderr {
+				t.Errorf("stderr = %q, want %q", stderr, tt.wantStderr)
+			}
+			for name, want := range tt.wantEnabled {
+				if got := site.Spec.Apps.Catalog[name].Enabled; got != want {
+					t.Errorf("%s enabled = %t, want %t", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyRenderIfInvalid(t *testing.T) {
+	site := parseTestSite(t, testSiteYaml)
+	component := site.Spec.Apps.Catalog["pihole"]
+	component.RenderIf = "metadata.name =="
+	site.Spec.Apps.Catalog["pihole"] = component
+
+	err := applyRenderIf(site)
+	if err == nil || !strings.Contains(err.Error(), "failed to evaluate renderIf of app pihole") {
+		t.Fatalf("error = %v, want a renderIf error", err)
+	}
+	if exitCode(err) != exitCodeValidation {
+		t.Errorf("exit code = %d, want %d", exitCode(err), exitCodeValidation)
+	}
+}
@@ -8,23 +8,69 @@ import (
 
 var sitePath string
 
+// maxTemplateSize is the largest template file in bytes that is read from a stack
+var maxTemplateSize int64
+
 var rootCmd = &cobra.Command{
 	Use:   "klabctl",
 	Short: "Klabctl as a Product CLI",
-	Long:  "klabctl: takes a site.yaml and produces cluster GitOps artifacts and can provision infra.",
+	Long: `klabctl: takes a site.yaml and produces cluster GitOps artifacts and can provision infra.
+
+Exit codes:
+  0  success
+  1  generic failure
+  2  invalid site configuration
+  3  stack cache missing or unavailable
+  4  required external tool (git, terraform) not found
+
+Flag defaults:
+  The flags stack-source, stack-ref, stack-subdir, clone-depth, concurrency,
+  color, output, site-dir and trace-dir, when not given on the command line, are
+  read from KLABCTL_<FLAG> environment variables (e.g. KLABCTL_STACK_SOURCE) and
+  then from .klabctl/config.yaml. Other flags only take effect on the command line.
+
+    color: never
+    stack-source: https://github.com/example/stack
+    concurrency: 4
+
+  These only default the flags, they never change spec.stack of a site.yaml.
+  KLABCTL_SITE_STACK_REF and KLABCTL_SITE_STACK_SOURCE override spec.stack of the
+  loaded site.yaml, with a warning, without modifying the file.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := applyFlagDefaults(cmd); err != nil {
+			return err
+		}
+		if err := validateColorPolicy(); err != nil {
+			return err
+		}
+		startHistory(cmd)
+		return nil
+	},
 }
 
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
+	cmd, err := rootCmd.ExecuteC()
+	recordHistory(cmd, err)
+	if err != nil {
+		os.Exit(exitCode(err))
 	}
 }
 
 func init() {
 	rootCmd.PersistentFlags().StringVarP(&sitePath, "site", "s", "", "Path to site.yaml")
+	rootCmd.PersistentFlags().StringVar(&colorPolicy, "color", colorAuto, "Emoji status markers: auto (on a terminal unless NO_COLOR is set), always or never (ASCII markers)")
+	rootCmd.PersistentFlags().StringSliceVar(&allowedEnvironments, "allowed-environments", nil, "Environments spec.environment must be one of, e.g. dev,staging,prod (usually set in .klabctl/config.yaml)")
+	rootCmd.PersistentFlags().Int64Var(&maxTemplateSize, "max-template-size", 4<<20, "Maximum size in bytes of a stack template file")
 	rootCmd.AddCommand(newGenerateCmd())
 	rootCmd.AddCommand(newProvisionInfraCmd())
 	rootCmd.AddCommand(newInitCmd())
 	rootCmd.AddCommand(newPullCmd())
 	rootCmd.AddCommand(newGetCmd())
+	rootCmd.AddCommand(newCheckTemplatesCmd())
+	rootCmd.AddCommand(newMigrateCmd())
+	rootCmd.AddCommand(newAffectedCmd())
+	rootCmd.AddCommand(newVerifyCmd())
+	rootCmd.AddCommand(newHistoryCmd())
+	rootCmd.AddCommand(newGraphCmd())
+	rootCmd.AddCommand(newTemplateFuncsCmd())
 }
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bamaas/klabctl/internal/config"
+)
+
+// loadSite loads a site.yaml and verifies it is consistent with its location on disk
+func loadSite(path string) (*config.Site, error) {
+	site, err := config.LoadSiteFromFile(path)
+	if err != nil {
+		// A missing or unreadable file (site.yaml or one it references) is not a validation failure
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
+			return nil, err
+		}
+		return nil, &ValidationError{Err: err}
+	}
+
+	if err := checkSiteLocation(path, site); err != nil {
+		return nil, err
+	}
+
+	if err := checkEnvironment(site); err != nil {
+		return nil, err
+	}
+
+	applyStackEnvOverrides(site)
+
+	return site, nil
+}
+
+// allowedEnvironments restricts spec.environment when set (--allowed-environments)
+var allowedEnvironments []string
+
+// checkEnvironment ensures spec.environment is set and allowed when allowed environments are configured
+func checkEnvironment(site *config.Site) error {
+	if len(allowedEnvironments) == 0 {
+		return nil
+	}
+	if !containsString(allowedEnvironments, site.Spec.Environment) {
+		return newValidationError("spec.environment '%s' of cluster %s is not one of the allowed environments: %s", site.Spec.Environment, site.Metadata.Name, strings.Join(allowedEnvironments, ", "))
+	}
+	return nil
+}
+
+// Environment variables overriding spec.stack of the loaded site.yaml, e.g. to render one site
+// against several stack versions in a CI matrix (flags like generate --assume-ref still take precedence)
+// They are distinct from KLABCTL_STACK_REF and KLABCTL_STACK_SOURCE, which only default the flags
+const (
+	siteStackRefEnv    = "KLABCTL_SITE_STACK_REF"
+	siteStackSourceEnv = "KLABCTL_SITE_STACK_SOURCE"
+)
+
+// applyStackEnvOverrides replaces the stack ref and source with KLABCTL_SITE_STACK_REF and KLABCTL_SITE_STACK_SOURCE
+// Each override is a warning, so --fail-on-warning rejects renders that don't match site.yaml. The file itself is never modified
+func applyStackEnvOverrides(site *config.Site) {
+	if source := os.Getenv(siteStackSourceEnv); source != "" && source != site.Spec.Stack.Source {
+		warnf("Using stack source %s from %s instead of %s", source, siteStackSourceEnv, site.Spec.Stack.Source)
+		site.Spec.Stack.Source = source
+	}
+	if ref := os.Getenv(siteStackRefEnv); ref != "" && ref != site.Spec.Stack.Ref {
+		warnf("Using stack ref %s from %s instead of %s", ref, siteStackRefEnv, site.Spec.Stack.Ref)
+		site.Spec.Stack.Ref = ref
+	}
+}
+
+// checkSiteLocation ensures a site.yaml inside clusters/<dir>/ has metadata.name set to <dir>
+// All output paths are built from metadata.name, so a mismatch would write to another cluster's directory
+func checkSiteLocation(path string, site *config.Site) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+
+	clusterDir := filepath.Dir(absPath)
+	if filepath.Base(filepath.Dir(clusterDir)) != "clusters" {
+		return nil
+	}
+
+	dirName := filepath.Base(clusterDir)
+	if dirName != site.Metadata.Name {
+		return newValidationError("metadata.name '%s' in %s does not match its cluster directory 'clusters/%s'; output would be written to clusters/%s", site.Metadata.Name, path, dirName, site.Metadata.Name)
+	}
+
+	return nil
+}
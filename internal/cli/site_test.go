@@ -0,0 +1,177 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyStackEnvOverrides(t *testing.T) {
+	tests := []struct {
+		name         string
+		env          map[string]string
+		wantSource   string
+		wantRef      string
+		wantWarnings int
+	}{
+		{name: "no overrides", wantSource: "https://example.com/stack.git", wantRef: "main"},
+		{name: "same values", env: map[string]string{siteStackRefEnv: "main", siteStackSourceEnv: "https://example.com/stack.git"}, wantSource: "https://example.com/stack.git", wantRef: "main"},
+		{name: "ref", env: map[string]string{siteStackRefEnv: "v2"}, wantSource: "https://example.com/stack.git", wantRef: "v2", wantWarnings: 1},
+		{name: "source and ref", env: map[string]string{siteStackRefEnv: "v2", siteStackSourceEnv: "https://example.com/fork.git"}, wantSource: "https://example.com/fork.git", wantRef: "v2", wantWarnings: 2},
+		{name: "flag defaults", env: map[string]string{flagEnvName("stack-ref"): "v2", flagEnvName("stack-source"): "https://example.com/fork.git"}, wantSource: "https://example.com/stack.git", wantRef: "main"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(siteStackRefEnv, "")
+			t.Setenv(siteStackSourceEnv, "")
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			warningCount = 0
+			t.Cleanup(func() { warningCount = 0 })
+
+			site := parseTestSite(t, testSiteYaml)
+			applyStackEnvOverrides(site)
+
+			if site.Spec.Stack.Source != tt.wantSource || site.Spec.Stack.Ref != tt.wantRef {
+				t.Errorf("stack = %s@%s, want %s@%s", site.Spec.Stack.Source, site.Spec.Stack.Ref, tt.wantSource, tt.wantRef)
+			}
+			if warningCount != tt.wantWarnings {
+				t.Errorf("warnings = %d, want %d", warningCount, tt.wantWarnings)
+			}
+
+			// Overrides are warnings, so --fail-on-warning rejects them with the validation exit code
+			err := checkWarnings(true)
+			if got, want := err != nil, tt.wantWarnings > 0; got != want {
+				t.Fatalf("checkWarnings(true) = %v, want an error: %t", err, want)
+			}
+			if err != nil && exitCode(err) != exitCodeValidation {
+				t.Errorf("exit code = %d, want %d", exitCode(err), exitCodeValidation)
+			}
+			if err := checkWarnings(false); err != nil {
+				t.Errorf("checkWarnings(false) = %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckEnvironment(t *testing.T) {
+	tests := []struct {
+		name        string
+		allowed     []string
+		environment string
+		wantErr     bool
+	}{
+		{name: "no restriction", environment: "anything"},
+		{name: "allowed", allowed: []string{"dev", "prod"}, environment: "prod"},
+		{name: "not allowed", allowed: []string{"dev", "prod"}, environment: "staging", wantErr: true},
+		{name: "missing", allowed: []string{"dev", "prod"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowedEnvironments = tt.allowed
+			t.Cleanup(func() { allowedEnvironments = nil })
+
+			site := parseTestSite(t, testSiteYaml)
+			site.Spec.Environment = tt.environment
+
+			err := checkEnvironment(site)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkEnvironment = %v, want an error: %t", err, tt.wantErr)
+			}
+			if err != nil && exitCode(err) != exitCodeValidation {
+				t.Errorf("exit code = %d, want %d", exitCode(err), exitCodeValidation)
+			}
+		})
+	}
+}
+
+func TestCheckSiteLocation(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		wantErr string
+	}{
+		{name: "matching cluster directory", path: filepath.Join("clusters", "demo", "site.yaml")},
+		{name: "outside clusters", path: filepath.Join("sites", "other", "site.yaml")},
+		{name: "other cluster directory", path: filepath.Join("clusters", "other", "site.yaml"), wantErr: "does not match its cluster directory 'clusters/other'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkSiteLocation(tt.path, parseTestSite(t, testSiteYaml))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkSiteLocation: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadSiteExitCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(t *testing.T, path string)
+		wantCode int
+	}{
+		{
+			name:     "missing file",
+			setup:    func(t *testing.T, path string) {},
+			wantCode: exitCodeGeneric,
+		},
+		{
+			name: "unreadable file",
+			setup: func(t *testing.T, path string) {
+				if err := os.MkdirAll(path, 0755); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantCode: exitCodeGeneric,
+		},
+		{
+			name: "missing valuesFrom file",
+			setup: func(t *testing.T, path string) {
+				writeTestFile(t, path, strings.Replace(testSiteYaml, "        values:\n          host: pihole.lan\n", "        valuesFrom: pihole.yaml\n", 1))
+			},
+			wantCode: exitCodeGeneric,
+		},
+		{
+			name: "invalid yaml",
+			setup: func(t *testing.T, path string) {
+				writeTestFile(t, path, "spec: [\n")
+			},
+			wantCode: exitCodeValidation,
+		},
+		{
+			name: "invalid site",
+			setup: func(t *testing.T, path string) {
+				writeTestFile(t, path, strings.Replace(testSiteYaml, "    ref: main\n", "    ref: main\n    subdir: ../outside\n", 1))
+			},
+			wantCode: exitCodeValidation,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			path := filepath.Join("clusters", "demo", "site.yaml")
+			tt.setup(t, path)
+
+			_, err := loadSite(path)
+			if err == nil {
+				t.Fatal("loadSite succeeded, want an error")
+			}
+			if code := exitCode(err); code != tt.wantCode {
+				t.Errorf("exit code = %d, want %d (%v)", code, tt.wantCode, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Decoration policies of the --color flag
+const (
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+// colorPolicy selects whether status lines use emoji markers (auto, always or never)
+var colorPolicy = colorAuto
+
+// asciiMarkers replaces the emoji status markers for terminals and logs that can't render them
+var asciiMarkers = strings.NewReplacer(
+	"✓", "[ok]",
+	"✗", "[fail]",
+	"⚠", "[warn]",
+	"📦", "[pull]",
+	"🔧", "[repair]",
+	"🚀", "[init]",
+	"✨", "[done]",
+	"🔄", "[refresh]",
+	"•", "-",
+)
+
+// validateColorPolicy checks the value of the --color flag
+func validateColorPolicy() error {
+	switch colorPolicy {
+	case colorAuto, colorAlways, colorNever:
+		return nil
+	default:
+		return newValidationError("unsupported --color '%s' (supported: auto, always, never)", colorPolicy)
+	}
+}
+
+// useEmoji reports whether status lines written to w keep their emoji markers
+// With auto, emoji are used on a terminal unless NO_COLOR is set or TERM is dumb
+func useEmoji(w io.Writer) bool {
+	switch colorPolicy {
+	case colorAlways:
+		return true
+	case colorNever:
+		return false
+	}
+
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// markers returns s with its emoji markers substituted according to the policy for w
+func markers(w io.Writer, s string) string {
+	if useEmoji(w) {
+		return s
+	}
+	return asciiMarkers.Replace(s)
+}
+
+// statusf prints a formatted status line, only the markers in format are substituted, never the arguments
+func statusf(w io.Writer, format string, args ...interface{}) {
+	fmt.Fprintf(w, markers(w, format), args...)
+}
+
+// statusln prints a status message followed by a newline
+func statusln(w io.Writer, message string) {
+	fmt.Fprintln(w, markers(w, message))
+}
@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestUseEmoji(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		noColor string
+		term    string
+		want    bool
+	}{
+		{name: "always", policy: colorAlways, noColor: "1", want: true},
+		{name: "never", policy: colorNever, term: "xterm", want: false},
+		{name: "auto without a terminal", policy: colorAuto, term: "xterm", want: false},
+		{name: "auto with NO_COLOR", policy: colorAuto, noColor: "1", want: false},
+		{name: "auto with a dumb terminal", policy: colorAuto, term: "dumb", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			colorPolicy = tt.policy
+			t.Cleanup(func() { colorPolicy = colorAuto })
+			t.Setenv("NO_COLOR", tt.noColor)
+			t.Setenv("TERM", tt.term)
+
+			if got := useEmoji(&bytes.Buffer{}); got != tt.want {
+				t.Errorf("useEmoji = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatusMarkers(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		want   string
+	}{
+		{name: "emoji", policy: colorAlways, want: "✓ rendered ✗.yaml\n"},
+		{name: "ascii", policy: colorNever, want: "[ok] rendered ✗.yaml\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			colorPolicy = tt.policy
+			t.Cleanup(func() { colorPolicy = colorAuto })
+
+			// Arguments are printed as is, only the format's markers are substituted
+			var out bytes.Buffer
+			statusf(&out, "✓ rendered %s\n", "✗.yaml")
+			if out.String() != tt.want {
+				t.Errorf("statusf = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateColorPolicy(t *testing.T) {
+	tests := []struct {
+		policy  string
+		wantErr bool
+	}{
+		{policy: colorAuto},
+		{policy: colorAlways},
+		{policy: colorNever},
+		{policy: "rainbow", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			colorPolicy = tt.policy
+			t.Cleanup(func() { colorPolicy = colorAuto })
+
+			if err := validateColorPolicy(); (err != nil) != tt.wantErr {
+				t.Errorf("validateColorPolicy = %v, want an error: %t", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bamaas/klabctl/internal/config"
+)
+
+// checkOutputPaths verifies every path a render writes to before anything is written (--strict-paths)
+// All paths must stay inside clusters/<name> and may not pass through or contain a symlink
+func checkOutputPaths(site *config.Site, opts generateOptions) error {
+	outputRoot := filepath.Join("clusters", site.Metadata.Name)
+	if filepath.Dir(outputRoot) != "clusters" || filepath.Base(outputRoot) == ".." {
+		return newValidationError("strict paths: metadata.name '%s' does not resolve to a directory in clusters/", site.Metadata.Name)
+	}
+
+	// Directories owned by generate are checked with their content, other paths only up to themselves
+	ownedDirs := []string{
+		filepath.Join(outputRoot, "infra", "base"),
+		filepath.Join(outputRoot, "infra", "generated"),
+		filepath.Join(outputRoot, "bootstrap", "base"),
+	}
+	paths := []string{filepath.Join(outputRoot, "apps")}
+	if opts.manifestFormat == "helmfile" {
+		paths = append(paths, filepath.Join(outputRoot, "helmfile.yaml"))
+	}
+	if opts.index {
+		paths = append(paths, filepath.Join(outputRoot, "README.md"))
+	}
+
+	for name, component := range site.Spec.Apps.Catalog {
+		if !component.Enabled || (len(opts.onlyApps) > 0 && !containsString(opts.onlyApps, name)) {
+			continue
+		}
+		componentPath := filepath.Join(outputRoot, "apps", component.Project, component.Namespace, name)
+		paths = append(paths, componentPath, filepath.Join(componentPath, "kustomization.yaml"))
+		ownedDirs = append(ownedDirs,
+			filepath.Join(componentPath, "base"),
+			filepath.Join(componentPath, site.Spec.Layout.GeneratedDir),
+		)
+	}
+
+	for _, path := range append(paths, ownedDirs...) {
+		if err := checkOutputPath(outputRoot, path); err != nil {
+			return newValidationError("strict paths: %v", err)
+		}
+	}
+	for _, dir := range ownedDirs {
+		if err := checkNoSymlinks(dir); err != nil {
+			return newValidationError("strict paths: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// checkOutputPath fails when path lies outside root or when path or any of its parents is a symlink
+func checkOutputPath(root, path string) error {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return fmt.Errorf("output path %s escapes the output root %s", path, root)
+	}
+
+	for current := path; current != "."; current = filepath.Dir(current) {
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("output path %s passes through the symlink %s", path, current)
+		}
+	}
+	return nil
+}
+
+// checkNoSymlinks fails when dir contains a symlink, a missing dir has none
+func checkNoSymlinks(dir string) error {
+	if _, err := os.Lstat(dir); os.IsNotExist(err) {
+		return nil
+	}
+
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("output directory %s contains the symlink %s", dir, path)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,136 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bamaas/klabctl/internal/config"
+)
+
+func TestCheckOutputPaths(t *testing.T) {
+	appPath := filepath.Join("clusters", "demo", "apps", "system", "apps", "pihole")
+
+	tests := []struct {
+		name      string
+		setup     func(t *testing.T, site *config.Site)
+		wantError string
+	}{
+		{
+			name:  "clean tree",
+			setup: func(t *testing.T, site *config.Site) {},
+		},
+		{
+			name: "existing output",
+			setup: func(t *testing.T, site *config.Site) {
+				writeTestFile(t, filepath.Join(appPath, "generated", "kustomization.yaml"), "resources: []\n")
+			},
+		},
+		{
+			name: "cluster name escapes clusters",
+			setup: func(t *testing.T, site *config.Site) {
+				site.Metadata.Name = "../demo"
+			},
+			wantError: "does not resolve to a directory in clusters/",
+		},
+		{
+			name: "project escapes the output root",
+			setup: func(t *testing.T, site *config.Site) {
+				component := site.Spec.Apps.Catalog["pihole"]
+				component.Project = "../../.."
+				site.Spec.Apps.Catalog["pihole"] = component
+			},
+			wantError: "escapes the output root",
+		},
+		{
+			name: "symlinked apps directory",
+			setup: func(t *testing.T, site *config.Site) {
+				if err := os.MkdirAll(filepath.Join("clusters", "demo"), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Symlink(t.TempDir(), filepath.Join("clusters", "demo", "apps")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantError: "passes through the symlink",
+		},
+		{
+			name: "symlink in the generated directory",
+			setup: func(t *testing.T, site *config.Site) {
+				writeTestFile(t, filepath.Join(appPath, "generated", "kustomization.yaml"), "resources: []\n")
+				if err := os.Symlink("/etc/passwd", filepath.Join(appPath, "generated", "values.yaml")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantError: "contains the symlink",
+		},
+		{
+			name: "symlink in a custom directory is allowed",
+			setup: func(t *testing.T, site *config.Site) {
+				writeTestFile(t, filepath.Join(appPath, "custom", "values.yaml"), "host: pihole.lan\n")
+				if err := os.Symlink("values.yaml", filepath.Join(appPath, "custom", "shared.yaml")); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			site := parseTestSite(t, testSiteYaml)
+			tt.setup(t, site)
+
+			err := checkOutputPaths(site, generateOptions{})
+			if tt.wantError == "" {
+				if err != nil {
+					t.Errorf("checkOutputPaths: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+			}
+			if exitCode(err) != exitCodeValidation {
+				t.Errorf("exit code = %d, want %d", exitCode(err), exitCodeValidation)
+			}
+		})
+	}
+}
+
+func TestGenerateStrictPaths(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		wantError bool
+	}{
+		{name: "symlinks followed without strict paths"},
+		{name: "symlinks rejected with strict paths", args: []string{"--strict-paths"}, wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := useTestStack(t, testStackApps)
+			commitTestStack(t, cacheDir)
+			writeTestSite(t, testSiteYaml)
+			target := t.TempDir()
+			if err := os.Symlink(target, filepath.Join("clusters", "demo", "apps")); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := runTestGenerate(t, tt.args...)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("generate error = %v, want an error: %t", err, tt.wantError)
+			}
+
+			entries, readErr := os.ReadDir(target)
+			if readErr != nil {
+				t.Fatal(readErr)
+			}
+			if written := len(entries) > 0; written == tt.wantError {
+				t.Errorf("wrote through the symlink = %t, want %t", written, !tt.wantError)
+			}
+		})
+	}
+}
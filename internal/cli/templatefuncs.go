@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+func newTemplateFuncsCmd() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "template-funcs",
+		Short: "List the custom functions available to stack templates",
+		Long: `List the functions klabctl registers for stack templates, with a short description.
+
+The text/template builtins (and, or, not, eq, ne, lt, le, gt, ge, index, len,
+print, printf, println, slice, html, js, urlquery, call) are available as well.
+
+Examples:
+  klabctl template-funcs
+  klabctl template-funcs -o json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch output {
+			case "text":
+				w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				for _, f := range templateFuncs {
+					fmt.Fprintf(w, "%s\t%s\n", f.Name, f.Description)
+				}
+				return w.Flush()
+			case "json":
+				data, err := json.MarshalIndent(templateFuncs, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to marshal template functions: %w", err)
+				}
+				fmt.Println(string(data))
+				return nil
+			default:
+				return newValidationError("unsupported output format '%s' (supported: text, json)", output)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "text", "Output format: text or json")
+
+	return cmd
+}
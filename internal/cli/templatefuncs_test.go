@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestTemplateFuncMap(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		data     interface{}
+		want     string
+	}{
+		{name: "quote", template: "{{ .host | quote }}", data: map[string]interface{}{"host": "pihole.lan"}, want: `"pihole.lan"`},
+		{name: "toJson list", template: "{{ toJson .servers }}", data: map[string]interface{}{"servers": []string{"1.1.1.1", "9.9.9.9"}}, want: `["1.1.1.1","9.9.9.9"]`},
+		{name: "toJson map", template: "{{ toJson .dns }}", data: map[string]interface{}{"dns": map[string]interface{}{"cache": true}}, want: `{"cache":true}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := template.New(tt.name).Funcs(templateFuncMap()).Parse(tt.template)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			var out strings.Builder
+			if err := tmpl.Execute(&out, tt.data); err != nil {
+				t.Fatalf("execute: %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("output = %s, want %s", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateFuncsCmd(t *testing.T) {
+	tests := []struct {
+		name      string
+		output    string
+		wantError string
+	}{
+		{name: "text", output: "text"},
+		{name: "json", output: "json"},
+		{name: "unsupported output", output: "yaml", wantError: "unsupported output format 'yaml'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := newTemplateFuncsCmd()
+			cmd.SetArgs([]string{"-o", tt.output})
+			cmd.SilenceUsage = true
+			cmd.SilenceErrors = true
+
+			var err error
+			stdout := captureStdout(t, func() { err = cmd.Execute() })
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("template-funcs: %v", err)
+			}
+
+			var names []string
+			if tt.output == "json" {
+				var funcs []templateFunc
+				if err := json.Unmarshal([]byte(stdout), &funcs); err != nil {
+					t.Fatalf("invalid json: %v\n%s", err, stdout)
+				}
+				for _, f := range funcs {
+					if f.Description == "" {
+						t.Errorf("%s has no description", f.Name)
+					}
+					names = append(names, f.Name)
+				}
+			} else {
+				for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+					names = append(names, strings.Fields(line)[0])
+				}
+			}
+
+			// Every listed function is registered and every registered function is listed
+			funcMap := templateFuncMap()
+			if len(names) != len(funcMap) {
+				t.Errorf("listed %v, want the %d registered functions", names, len(funcMap))
+			}
+			for _, name := range names {
+				if _, ok := funcMap[name]; !ok {
+					t.Errorf("listed function %s is not registered", name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// formatTerraform runs terraform fmt on the generated terraform directory
+// With check the files are only verified, unformatted files fail the render
+// A missing terraform binary skips the step with a warning
+func formatTerraform(dir string, check bool) error {
+	if _, err := exec.LookPath("terraform"); err != nil {
+		warnf("terraform not found, skipping terraform fmt of %s", dir)
+		return nil
+	}
+
+	args := []string{"-chdir=" + dir, "fmt", "-list=true"}
+	if check {
+		args = append(args, "-check")
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("terraform", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	files := strings.Fields(stdout.String())
+
+	// terraform fmt -check exits with 3 when files need formatting
+	var exitErr *exec.ExitError
+	if check && errors.As(err, &exitErr) && exitErr.ExitCode() == 3 {
+		return fmt.Errorf("generated terraform in %s is not formatted: %s (run generate with --terraform-fmt)", dir, strings.Join(files, ", "))
+	}
+	if err != nil {
+		return fmt.Errorf("terraform fmt failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	if !check && len(files) > 0 {
+		statusf(os.Stdout, "✓ Formatted %d terraform files\n", len(files))
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useFakeTerraformFmt puts a terraform script first in PATH whose fmt lists output and exits with exitCode
+func useFakeTerraformFmt(t *testing.T, output string, exitCode string) {
+	t.Helper()
+	binDir := t.TempDir()
+	script := "#!/bin/sh\nprintf '" + output + "'\necho fmt-error >&2\nexit " + exitCode + "\n"
+	if err := os.WriteFile(filepath.Join(binDir, "terraform"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestFormatTerraform(t *testing.T) {
+	tests := []struct {
+		name         string
+		installed    bool
+		output       string
+		exitCode     string
+		check        bool
+		wantStdout   string
+		wantWarnings int
+		wantError    string
+	}{
+		{name: "terraform not installed", wantWarnings: 1},
+		{name: "formats files", installed: true, output: "main.tf\\nvariables.tf\\n", exitCode: "0", wantStdout: "Formatted 2 terraform files"},
+		{name: "already formatted", installed: true, exitCode: "0"},
+		{name: "check passes", installed: true, exitCode: "0", check: true},
+		{name: "check fails on unformatted files", installed: true, output: "main.tf\\n", exitCode: "3", check: true, wantError: "is not formatted: main.tf"},
+		{name: "fmt error", installed: true, exitCode: "2", wantError: "terraform fmt failed: exit status 2: fmt-error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.installed {
+				useFakeTerraformFmt(t, tt.output, tt.exitCode)
+			} else {
+				t.Setenv("PATH", t.TempDir())
+			}
+			warningCount, colorPolicy = 0, colorNever
+			t.Cleanup(func() { warningCount, colorPolicy = 0, colorAuto })
+
+			var err error
+			stdout := captureStdout(t, func() {
+				captureStderr(t, func() { err = formatTerraform(t.TempDir(), tt.check) })
+			})
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("formatTerraform: %v", err)
+			}
+			if tt.wantStdout != "" && !strings.Contains(stdout, tt.wantStdout) {
+				t.Errorf("stdout = %q, want it to contain %q", stdout, tt.wantStdout)
+			}
+			if tt.wantStdout == "" && stdout != "" {
+				t.Errorf("stdout = %q, want nothing", stdout)
+			}
+			if warningCount != tt.wantWarnings {
+				t.Errorf("warnings = %d, want %d", warningCount, tt.wantWarnings)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"text/template/parse"
+
+	"github.com/bamaas/klabctl/internal/config"
+)
+
+// allComponents marks a reference that covers the values of every component
+const allComponents = "*"
+
+// valuesRoots are the template data paths leading to component values, "*" is the component name
+var valuesRoots = [][]string{
+	{"AllComponents", "*", "Values"},
+	{"Site", "Spec", "Apps", "Catalog", "*", "Values"},
+}
+
+// valueReferences maps a component to the value paths its templates reference
+// An empty path references all values of the component
+type valueReferences map[string][][]string
+
+// warnUnusedValues warns about component values that no stack template references
+// The general templates and the templates of every rendered component are scanned, so a value read
+// by another component's template (e.g. .AllComponents.pihole.Values.ip) counts as used
+func warnUnusedValues(site *config.Site, opts generateOptions, componentNames []string) error {
+	references := make(valueReferences)
+
+	generalTemplates, err := findTemplateFiles(getStackTemplatesDir(site, opts))
+	if err != nil {
+		return fmt.Errorf("failed to list stack templates: %w", err)
+	}
+
+	for _, componentName := range componentNames {
+		appTemplates, err := FindAppTemplates(site, opts, componentName)
+		if err != nil {
+			return fmt.Errorf("failed to find templates for %s: %w", componentName, err)
+		}
+
+		paths := append([]string{}, generalTemplates...)
+		for _, templateName := range appTemplates {
+			paths = append(paths, filepath.Join(getStackRoot(site, opts), templateName))
+		}
+
+		for _, path := range paths {
+			tree, err := parseTemplateTree(site, path)
+			if err != nil {
+				return err
+			}
+			collectValueReferences(tree.Root, componentName, references)
+		}
+	}
+
+	for _, componentName := range componentNames {
+		component := site.Spec.Apps.Catalog[componentName]
+		paths := append(append([][]string{}, references[componentName]...), references[allComponents]...)
+		for _, unused := range findUnusedValues("", component.Values, paths) {
+			warnf("%s: value %s is not referenced by any template", componentName, unused)
+		}
+	}
+
+	return nil
+}
+
+// parseTemplateTree parses a template file without executing it
+func parseTemplateTree(site *config.Site, path string) (*parse.Tree, error) {
+	content, err := readTemplateFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template %s: %w", path, err)
+	}
+
+	tmpl, err := newStackTemplate(site, filepath.Base(path)).Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", path, err)
+	}
+	return tmpl.Tree, nil
+}
+
+// collectValueReferences walks a template AST and records the component values it references
+func collectValueReferences(node parse.Node, componentName string, references valueReferences) {
+	if node == nil {
+		return
+	}
+
+	// A resolvable field chain or index call is recorded as a whole
+	if path, ok := nodePath(node); ok {
+		recordValueReference(path, componentName, references)
+		return
+	}
+
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectValueReferences(child, componentName, references)
+		}
+	case *parse.ActionNode:
+		collectValueReferences(n.Pipe, componentName, references)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			collectValueReferences(cmd, componentName, references)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			collectValueReferences(arg, componentName, references)
+		}
+	case *parse.ChainNode:
+		collectValueReferences(n.Node, componentName, references)
+	case *parse.IfNode:
+		collectBranchReferences(&n.BranchNode, componentName, references)
+	case *parse.RangeNode:
+		collectBranchReferences(&n.BranchNode, componentName, references)
+	case *parse.WithNode:
+		collectBranchReferences(&n.BranchNode, componentName, references)
+	case *parse.TemplateNode:
+		collectValueReferences(n.Pipe, componentName, references)
+	}
+}
+
+// collectBranchReferences walks the pipeline and both lists of an if, range or with
+func collectBranchReferences(branch *parse.BranchNode, componentName string, references valueReferences) {
+	collectValueReferences(branch.Pipe, componentName, references)
+	collectValueReferences(branch.List, componentName, references)
+	collectValueReferences(branch.ElseList, componentName, references)
+}
+
+// nodePath returns the data path of a field (.a.b), a chain ((x).a.b) or an index call with constant keys
+func nodePath(node parse.Node) ([]string, bool) {
+	switch n := node.(type) {
+	case *parse.FieldNode:
+		return n.Ident, true
+	case *parse.ChainNode:
+		base, ok := nodePath(n.Node)
+		if !ok {
+			return nil, false
+		}
+		return append(append([]string{}, base...), n.Field...), true
+	case *parse.PipeNode:
+		if len(n.Cmds) != 1 || len(n.Decl) > 0 {
+			return nil, false
+		}
+		return nodePath(n.Cmds[0])
+	case *parse.CommandNode:
+		if len(n.Args) < 3 {
+			return nil, false
+		}
+		if ident, ok := n.Args[0].(*parse.IdentifierNode); !ok || ident.Ident != "index" {
+			return nil, false
+		}
+		base, ok := nodePath(n.Args[1])
+		if !ok {
+			return nil, false
+		}
+		path := append([]string{}, base...)
+		for _, arg := range n.Args[2:] {
+			key, ok := arg.(*parse.StringNode)
+			if !ok {
+				return nil, false
+			}
+			path = append(path, key.Text)
+		}
+		return path, true
+	}
+	return nil, false
+}
+
+// recordValueReference records a data path when it leads to component values
+// A path stopping above the values (e.g. .Component or .AllComponents) references all of them
+func recordValueReference(path []string, componentName string, references valueReferences) {
+	roots := append([][]string{{"Component", "Values"}}, valuesRoots...)
+	for _, root := range roots {
+		// A path stopping before the component name references every component
+		owner := componentName
+		if containsString(root, "*") {
+			owner = allComponents
+		}
+		matched := true
+		for i, segment := range root {
+			if i == len(path) {
+				references[owner] = append(references[owner], nil)
+				return
+			}
+			if segment == "*" {
+				owner = path[i]
+				continue
+			}
+			if path[i] != segment {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			references[owner] = append(references[owner], path[len(root):])
+			return
+		}
+	}
+}
+
+// findUnusedValues returns the paths of values not covered by any referenced path, sorted
+// secretRef values are consumed by the rendered ExternalSecrets and never reported
+func findUnusedValues(prefix string, values map[string]interface{}, references [][]string) []string {
+	for _, reference := range references {
+		if len(reference) == 0 {
+			return nil
+		}
+	}
+
+	var unused []string
+	for key, value := range values {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		if asSecretRef(value) != nil {
+			continue
+		}
+
+		var nested [][]string
+		referenced := false
+		for _, reference := range references {
+			if reference[0] == key {
+				referenced = true
+				nested = append(nested, reference[1:])
+			}
+		}
+		if !referenced {
+			unused = append(unused, path)
+			continue
+		}
+
+		if nestedValues, ok := value.(map[string]interface{}); ok {
+			unused = append(unused, findUnusedValues(path, nestedValues, nested)...)
+		}
+	}
+
+	sort.Strings(unused)
+	return unused
+}
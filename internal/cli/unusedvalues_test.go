@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWarnUnusedValues(t *testing.T) {
+	tests := []struct {
+		name      string
+		template  string
+		dnsValues map[string]interface{}
+		want      []string
+	}{
+		{
+			name:     "no references",
+			template: "{{- template \"base\" . }}\n",
+			want:     []string{"external-dns: value interval", "pihole: value host"},
+		},
+		{
+			name:     "own value",
+			template: "{{- template \"base\" . }}\n# {{ .Component.Values.interval }}\n",
+			want:     []string{"pihole: value host"},
+		},
+		{
+			name:     "value of another component",
+			template: "{{- template \"base\" . }}\n# {{ .AllComponents.pihole.Values.host }}\n",
+			want:     []string{"external-dns: value interval"},
+		},
+		{
+			name:     "index call",
+			template: "{{- template \"base\" . }}\n# {{ index .Site.Spec.Apps.Catalog \"pihole\" \"Values\" \"host\" }}\n",
+			want:     []string{"external-dns: value interval"},
+		},
+		{
+			name:     "all values of the component",
+			template: "{{- template \"base\" . }}\n# {{ toJson .Component.Values }}\n",
+			want:     []string{"pihole: value host"},
+		},
+		{
+			name:     "a with block covers the whole value",
+			template: "{{- template \"base\" . }}\n{{- with .AllComponents.pihole.Values }}\n# {{ .other }}\n{{- end }}\n",
+			want:     []string{"external-dns: value interval"},
+		},
+		{
+			name:     "every component",
+			template: "{{- template \"base\" . }}\n{{- range .AllComponents }}\n# {{ .Namespace }}\n{{- end }}\n",
+		},
+		{
+			name:      "nested value",
+			template:  "{{- template \"base\" . }}\n# {{ .Component.Values.dns.upstream }}\n",
+			dnsValues: map[string]interface{}{"dns": map[string]interface{}{"upstream": "1.1.1.1", "cache": true}, "token": map[string]interface{}{"secretRef": map[string]interface{}{"key": "dns"}}},
+			want:      []string{"external-dns: value dns.cache", "pihole: value host"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestStack(t, map[string]testApp{
+				"pihole":       testStackApps["pihole"],
+				"external-dns": {Template: tt.template},
+			})
+			site := parseTestSite(t, testSiteYaml)
+			if tt.dnsValues != nil {
+				component := site.Spec.Apps.Catalog["external-dns"]
+				component.Values = tt.dnsValues
+				site.Spec.Apps.Catalog["external-dns"] = component
+			}
+			warningCount, colorPolicy = 0, colorNever
+			t.Cleanup(func() { warningCount, colorPolicy = 0, colorAuto })
+
+			var err error
+			stderr := captureStderr(t, func() { err = warnUnusedValues(site, generateOptions{}, []string{"external-dns", "pihole"}) })
+			if err != nil {
+				t.Fatalf("warnUnusedValues: %v", err)
+			}
+
+			var got []string
+			for _, line := range strings.Split(stderr, "\n") {
+				if i := strings.Index(line, " is not referenced"); i >= 0 {
+					got = append(got, strings.TrimPrefix(line[:i], "[warn] "))
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unused values = %q, want %q\n%s", got, tt.want, stderr)
+			}
+		})
+	}
+}
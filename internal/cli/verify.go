@@ -0,0 +1,278 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bamaas/klabctl/internal/config"
+	"github.com/spf13/cobra"
+)
+
+func newVerifyCmd() *cobra.Command {
+	var opts generateOptions
+
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Verify the cluster directory matches a fresh render of site.yaml",
+		Long: `Render site.yaml into a temporary directory and compare the result byte-for-byte
+with clusters/<name>.
+
+User owned files (custom/ directories and the component root kustomization.yaml) are
+carried over and not compared. Files that differ, are missing, or exist in a generated
+directory without being rendered are reported and the command fails.
+
+Pass the render flags the cluster was generated with (--infra-module-source,
+--emit-kustomize-labels, --resolve-ref, --render-manifest-checksum-in-annotation),
+otherwise their output is reported as drift.
+
+Examples:
+  # Detect hand edits to generated files in CI
+  klabctl verify --site clusters/production/site.yaml
+
+  # Verify a cluster generated with labels and a git module source
+  klabctl verify --emit-kustomize-labels --infra-module-source git`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			site, err := loadSite(sitePath)
+			if err != nil {
+				return err
+			}
+
+			if err := validateRenderFlags(opts); err != nil {
+				return err
+			}
+
+			// Components whose renderIf is false aren't rendered by generate either
+			if err := applyRenderIf(site); err != nil {
+				return err
+			}
+
+			if site.Spec.Stack.Source == "" || site.Spec.Stack.Ref == "" {
+				return newValidationError("stack.source and stack.ref are required in site.yaml")
+			}
+			if err := EnsureStackAvailable(site.Spec.Stack.Source, site.Spec.Stack.Ref, site.Spec.Stack.Subdir, false); err != nil {
+				return fmt.Errorf("failed to ensure stack is available: %w", err)
+			}
+
+			if opts.resolveRef {
+				if _, err := pinStackRef(site, &opts); err != nil {
+					return err
+				}
+			}
+
+			drift, err := verifyCluster(site, opts)
+			if err != nil {
+				return err
+			}
+
+			if len(drift) > 0 {
+				for _, line := range drift {
+					fmt.Println(line)
+				}
+				return fmt.Errorf("%d files in clusters/%s differ from a fresh render", len(drift), site.Metadata.Name)
+			}
+
+			statusf(os.Stdout, "✓ clusters/%s matches site.yaml\n", site.Metadata.Name)
+			return nil
+		},
+	}
+
+	addRenderFlags(cmd, &opts)
+
+	return cmd
+}
+
+// verifyCluster renders the site into a temporary directory and compares it with the cluster directory
+// opts holds the render flags the cluster was generated with. Returns a line per drifted file
+func verifyCluster(site *config.Site, opts generateOptions) ([]string, error) {
+	clusterDir := filepath.Join("clusters", site.Metadata.Name)
+	if _, err := os.Stat(clusterDir); err != nil {
+		return nil, fmt.Errorf("cluster directory %s not found, run 'klabctl generate' first", clusterDir)
+	}
+
+	absClusterDir, err := filepath.Abs(clusterDir)
+	if err != nil {
+		return nil, err
+	}
+	absKlabctlDir, err := filepath.Abs(hiddenKlabctlDir)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "klabctl-verify-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// The render reads the stack cache relative to the working directory
+	if err := os.Symlink(absKlabctlDir, filepath.Join(tmpDir, hiddenKlabctlDir)); err != nil {
+		return nil, fmt.Errorf("failed to link stack cache: %w", err)
+	}
+
+	renderedClusterDir := filepath.Join(tmpDir, clusterDir)
+	if err := copyUserOwnedFiles(site, absClusterDir, renderedClusterDir); err != nil {
+		return nil, fmt.Errorf("failed to copy user owned files: %w", err)
+	}
+
+	if err := renderInDir(tmpDir, site, opts); err != nil {
+		return nil, err
+	}
+
+	return compareClusterTrees(site, renderedClusterDir, absClusterDir)
+}
+
+// renderInDir generates the site's infra and apps as kustomize with tmpDir as working directory
+func renderInDir(dir string, site *config.Site, opts generateOptions) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if err := os.Chdir(dir); err != nil {
+		return err
+	}
+	defer os.Chdir(wd)
+
+	opts.manifestFormat = "kustomize"
+	if err := generateInfraManifests(site, opts); err != nil {
+		return fmt.Errorf("failed to generate infrastructure manifests: %w", err)
+	}
+	if _, err := generateAppManifests(site, opts); err != nil {
+		return fmt.Errorf("generate apps: %w", err)
+	}
+
+	return nil
+}
+
+// copyUserOwnedFiles copies the custom/ directories and component root kustomization.yaml files
+// of the cluster apps tree, generate never overwrites these
+func copyUserOwnedFiles(site *config.Site, srcClusterDir, dstClusterDir string) error {
+	appsDir := filepath.Join(srcClusterDir, "apps")
+	if _, err := os.Stat(appsDir); os.IsNotExist(err) {
+		return nil
+	}
+
+	return filepath.WalkDir(appsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(srcClusterDir, path)
+		if err != nil {
+			return err
+		}
+		dstPath := filepath.Join(dstClusterDir, relPath)
+
+		if d.IsDir() {
+			if d.Name() == site.Spec.Layout.CustomDir {
+				if err := copyDir(path, dstPath); err != nil {
+					return err
+				}
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// apps/<project>/<namespace>/<app>/kustomization.yaml
+		if isComponentRootKustomization(relPath) {
+			if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+				return err
+			}
+			return copyFile(path, dstPath)
+		}
+
+		return nil
+	})
+}
+
+// isComponentRootKustomization reports whether relPath (relative to the cluster directory) is a component root kustomization
+func isComponentRootKustomization(relPath string) bool {
+	parts := strings.Split(filepath.ToSlash(relPath), "/")
+	return len(parts) == 5 && parts[0] == "apps" && parts[4] == "kustomization.yaml"
+}
+
+// compareClusterTrees compares a freshly rendered cluster directory with the on-disk one
+// custom/ directories are skipped, files in generated directories that weren't rendered are reported as unexpected
+func compareClusterTrees(site *config.Site, renderedDir, actualDir string) ([]string, error) {
+	var drift []string
+	rendered := make(map[string]bool)
+
+	err := filepath.WalkDir(renderedDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == site.Spec.Layout.CustomDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		relPath, err := filepath.Rel(renderedDir, path)
+		if err != nil {
+			return err
+		}
+		rendered[relPath] = true
+
+		want, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		got, err := os.ReadFile(filepath.Join(actualDir, relPath))
+		if os.IsNotExist(err) {
+			drift = append(drift, "missing:    "+relPath)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(want, got) {
+			drift = append(drift, "modified:   "+relPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = filepath.WalkDir(actualDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == site.Spec.Layout.CustomDir || d.Name() == ".terraform" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		relPath, err := filepath.Rel(actualDir, path)
+		if err != nil {
+			return err
+		}
+		if !rendered[relPath] && inGeneratedDir(site, relPath) {
+			drift = append(drift, "unexpected: "+relPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(drift)
+	return drift, nil
+}
+
+// inGeneratedDir reports whether relPath lies in a directory fully owned by generate
+func inGeneratedDir(site *config.Site, relPath string) bool {
+	parts := strings.Split(filepath.ToSlash(relPath), "/")
+	if len(parts) > 2 && parts[0] == "infra" && parts[1] == "generated" {
+		return true
+	}
+	// apps/<project>/<namespace>/<app>/<generated>/...
+	return len(parts) > 5 && parts[0] == "apps" && parts[4] == site.Spec.Layout.GeneratedDir
+}
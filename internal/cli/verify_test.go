@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyClusterRenderFlags(t *testing.T) {
+	tests := []struct {
+		name      string
+		generate  generateOptions
+		verify    generateOptions
+		wantDrift []string
+	}{
+		{
+			name:     "defaults",
+			generate: generateOptions{infraModuleSource: "local"},
+			verify:   generateOptions{infraModuleSource: "local"},
+		},
+		{
+			name:     "same render flags",
+			generate: generateOptions{infraModuleSource: "git", emitKustomizeLabels: true},
+			verify:   generateOptions{infraModuleSource: "git", emitKustomizeLabels: true},
+		},
+		{
+			name:      "labels not passed to verify",
+			generate:  generateOptions{infraModuleSource: "local", emitKustomizeLabels: true},
+			verify:    generateOptions{infraModuleSource: "local"},
+			wantDrift: []string{"modified:   apps/system/apps/pihole/generated/kustomization.yaml"},
+		},
+		{
+			name:      "other module source",
+			generate:  generateOptions{infraModuleSource: "git"},
+			verify:    generateOptions{infraModuleSource: "local"},
+			wantDrift: []string{"modified:   infra/generated/main.tf"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestStack(t, testStackApps)
+			site := parseTestSite(t, testSiteYaml)
+
+			tt.generate.manifestFormat = "kustomize"
+			if err := generateInfraManifests(site, tt.generate); err != nil {
+				t.Fatalf("generateInfraManifests: %v", err)
+			}
+			if _, err := generateAppManifests(site, tt.generate); err != nil {
+				t.Fatalf("generateAppManifests: %v", err)
+			}
+
+			drift, err := verifyCluster(site, tt.verify)
+			if err != nil {
+				t.Fatalf("verifyCluster: %v", err)
+			}
+
+			if len(tt.wantDrift) == 0 && len(drift) > 0 {
+				t.Errorf("unexpected drift:\n%s", strings.Join(drift, "\n"))
+			}
+			for _, want := range tt.wantDrift {
+				if !containsString(drift, want) {
+					t.Errorf("drift misses %q:\n%s", want, strings.Join(drift, "\n"))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bamaas/klabctl/internal/config"
+)
+
+// verifyComponentVersions checks the chart version of each enabled component with a pinned version
+// against the helm-chart.yaml of its app base, returning an error listing every mismatch
+func verifyComponentVersions(site *config.Site, opts generateOptions) error {
+	var componentNames []string
+	for componentName, component := range site.Spec.Apps.Catalog {
+		if component.Enabled && component.Version != "" {
+			componentNames = append(componentNames, componentName)
+		}
+	}
+	sort.Strings(componentNames)
+
+	var mismatches []string
+	for _, componentName := range componentNames {
+		pinned := site.Spec.Apps.Catalog[componentName].Version
+
+		chart, err := loadAppHelmChart(site, opts, componentName)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case chart == nil:
+			mismatches = append(mismatches, fmt.Sprintf("%s: pinned to %s but the app base has no helm-chart.yaml", componentName, pinned))
+		case chart.Version != pinned:
+			mismatches = append(mismatches, fmt.Sprintf("%s: pinned to %s but the app base renders %s", componentName, pinned, chart.Version))
+		default:
+			statusf(os.Stderr, "✓ %s version %s matches pin\n", componentName, pinned)
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return newValidationError("version mismatch:\n  %s", strings.Join(mismatches, "\n  "))
+	}
+
+	return nil
+}
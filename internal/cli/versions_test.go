@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyComponentVersions(t *testing.T) {
+	tests := []struct {
+		name      string
+		version   string
+		chart     string
+		disabled  bool
+		wantError string
+	}{
+		{name: "not pinned", chart: "name: pihole\nversion: 2.0.0\n"},
+		{name: "matching pin", version: "2.0.0", chart: "name: pihole\nversion: 2.0.0\n"},
+		{name: "other version", version: "1.0.0", chart: "name: pihole\nversion: 2.0.0\n", wantError: "pihole: pinned to 1.0.0 but the app base renders 2.0.0"},
+		{name: "no chart", version: "1.0.0", wantError: "pihole: pinned to 1.0.0 but the app base has no helm-chart.yaml"},
+		{name: "disabled app", version: "1.0.0", chart: "name: pihole\nversion: 2.0.0\n", disabled: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := useTestStack(t, testStackApps)
+			if tt.chart != "" {
+				writeTestFile(t, filepath.Join(cacheDir, "stack", "apps", "pihole", "base", "helm-chart.yaml"), tt.chart)
+			}
+			site := parseTestSite(t, testSiteYaml)
+			component := site.Spec.Apps.Catalog["pihole"]
+			component.Version = tt.version
+			component.Enabled = !tt.disabled
+			site.Spec.Apps.Catalog["pihole"] = component
+
+			err := verifyComponentVersions(site, generateOptions{})
+			if tt.wantError == "" {
+				if err != nil {
+					t.Errorf("verifyComponentVersions: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+			}
+			if exitCode(err) != exitCodeValidation {
+				t.Errorf("exit code = %d, want %d", exitCode(err), exitCodeValidation)
+			}
+		})
+	}
+}
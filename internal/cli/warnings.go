@@ -0,0 +1,22 @@
+package cli
+
+import (
+	"os"
+)
+
+// warningCount is the number of configuration warnings emitted by the current command
+var warningCount int
+
+// warnf prints a configuration warning to stderr and records it for --fail-on-warning
+func warnf(format string, args ...interface{}) {
+	warningCount++
+	statusf(os.Stderr, "⚠ "+format+"\n", args...)
+}
+
+// checkWarnings returns an error when warnings were emitted and failOnWarning is set
+func checkWarnings(failOnWarning bool) error {
+	if failOnWarning && warningCount > 0 {
+		return newValidationError("%d warning(s) emitted and --fail-on-warning is set", warningCount)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckWarnings(t *testing.T) {
+	tests := []struct {
+		name          string
+		warnings      int
+		failOnWarning bool
+		wantErr       bool
+	}{
+		{name: "no warnings", warnings: 0, failOnWarning: true, wantErr: false},
+		{name: "warnings allowed", warnings: 2, failOnWarning: false, wantErr: false},
+		{name: "warnings fail", warnings: 2, failOnWarning: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warningCount = tt.warnings
+			t.Cleanup(func() { warningCount = 0 })
+
+			err := checkWarnings(tt.failOnWarning)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkWarnings = %v, want an error: %t", err, tt.wantErr)
+			}
+			if err != nil && exitCode(err) != exitCodeValidation {
+				t.Errorf("exit code = %d, want %d", exitCode(err), exitCodeValidation)
+			}
+		})
+	}
+}
+
+func TestGenerateFailOnWarning(t *testing.T) {
+	// A catalog without enabled apps is a warning
+	noApps := strings.ReplaceAll(testSiteYaml, "enabled: true", "enabled: false")
+
+	tests := []struct {
+		name     string
+		siteYaml string
+		args     []string
+		wantErr  bool
+	}{
+		{name: "no warnings", siteYaml: testSiteYaml, args: []string{"--fail-on-warning"}},
+		{name: "warning without the flag", siteYaml: noApps},
+		{name: "warning with the flag", siteYaml: noApps, args: []string{"--fail-on-warning"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := useTestStack(t, testStackApps)
+			commitTestStack(t, cacheDir)
+			writeTestSite(t, tt.siteYaml)
+
+			_, err := runTestGenerate(t, tt.args...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("generate = %v, want an error: %t", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), "--fail-on-warning") {
+				t.Errorf("error = %v, want it to name --fail-on-warning", err)
+			}
+		})
+	}
+}
+
+func TestGenerateRequireApps(t *testing.T) {
+	noApps := strings.ReplaceAll(testSiteYaml, "enabled: true", "enabled: false")
+
+	tests := []struct {
+		name         string
+		siteYaml     string
+		args         []string
+		wantWarnings int
+		wantError    string
+	}{
+		{name: "enabled apps", siteYaml: testSiteYaml, args: []string{"--require-apps"}},
+		{name: "no apps warns", siteYaml: noApps, wantWarnings: 1},
+		{name: "no apps with require apps", siteYaml: noApps, args: []string{"--require-apps"}, wantError: "no apps are enabled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cacheDir := useTestStack(t, testStackApps)
+			commitTestStack(t, cacheDir)
+			writeTestSite(t, tt.siteYaml)
+
+			var err error
+			captureStderr(t, func() { _, err = runTestGenerate(t, tt.args...) })
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+				}
+				if exitCode(err) != exitCodeValidation {
+					t.Errorf("exit code = %d, want %d", exitCode(err), exitCodeValidation)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("generate: %v", err)
+			}
+			if warningCount != tt.wantWarnings {
+				t.Errorf("warnings = %d, want %d", warningCount, tt.wantWarnings)
+			}
+		})
+	}
+}
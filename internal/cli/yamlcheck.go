@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bamaas/klabctl/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// validateGeneratedYAML parses the rendered .yaml files of every enabled component
+// Returns a validation error listing each file that doesn't parse
+func validateGeneratedYAML(site *config.Site) error {
+	appsPath := filepath.Join("clusters", site.Metadata.Name, "apps")
+
+	var componentNames []string
+	for componentName, component := range site.Spec.Apps.Catalog {
+		if component.Enabled {
+			componentNames = append(componentNames, componentName)
+		}
+	}
+	sort.Strings(componentNames)
+
+	var failures []string
+	for _, componentName := range componentNames {
+		component := site.Spec.Apps.Catalog[componentName]
+		componentPath := filepath.Join(appsPath, component.Project, component.Namespace, componentName)
+
+		files := []string{filepath.Join(componentPath, "kustomization.yaml")}
+		generated, err := os.ReadDir(filepath.Join(componentPath, site.Spec.Layout.GeneratedDir))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for _, entry := range generated {
+			if !entry.IsDir() {
+				files = append(files, filepath.Join(componentPath, site.Spec.Layout.GeneratedDir, entry.Name()))
+			}
+		}
+
+		for _, file := range files {
+			if err := validateYAMLFile(file); err != nil {
+				failures = append(failures, fmt.Sprintf("  %s: %s: %v", componentName, file, err))
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		return newValidationError("%d generated files are not valid YAML:\n%s", len(failures), strings.Join(failures, "\n"))
+	}
+
+	return nil
+}
+
+// validateYAMLFile parses all documents of a .yaml/.yml file, other files are ignored
+func validateYAMLFile(path string) error {
+	ext := filepath.Ext(path)
+	if ext != ".yaml" && ext != ".yml" {
+		return nil
+	}
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	for {
+		var document yaml.Node
+		if err := decoder.Decode(&document); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
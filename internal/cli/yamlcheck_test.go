@@ -0,0 +1,72 @@
+package cli
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateYAMLFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr bool
+	}{
+		{name: "valid", file: "kustomization.yaml", content: "resources:\n  - base\n"},
+		{name: "multiple documents", file: "resources.yml", content: "kind: A\n---\nkind: B\n"},
+		{name: "empty", file: "empty.yaml", content: ""},
+		{name: "invalid", file: "kustomization.yaml", content: "resources:\n  - base\n bad: [\n", wantErr: true},
+		{name: "invalid second document", file: "resources.yaml", content: "kind: A\n---\nkind: [\n", wantErr: true},
+		{name: "not yaml", file: "values.patch.json", content: "{not json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			writeTestFile(t, path, tt.content)
+
+			if err := validateYAMLFile(path); (err != nil) != tt.wantErr {
+				t.Errorf("validateYAMLFile = %v, want an error: %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateGeneratedYAML(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		wantErr  string
+	}{
+		{name: "valid output", template: testStackApps["external-dns"].Template},
+		{name: "invalid output", template: "{{- template \"base\" . }}\nbad: [\n", wantErr: "external-dns: clusters/demo/apps/system/apps/external-dns/generated/kustomization.yaml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestStack(t, map[string]testApp{
+				"pihole":       testStackApps["pihole"],
+				"external-dns": {Template: tt.template},
+			})
+			site := parseTestSite(t, testSiteYaml)
+			if _, err := generateAppManifests(site, generateOptions{}); err != nil {
+				t.Fatalf("generateAppManifests: %v", err)
+			}
+
+			err := validateGeneratedYAML(site)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateGeneratedYAML: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if exitCode(err) != exitCodeValidation {
+				t.Errorf("exit code = %d, want %d", exitCode(err), exitCodeValidation)
+			}
+		})
+	}
+}
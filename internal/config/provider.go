@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProxmoxConfig is the typed configuration of the proxmox provider
+type ProxmoxConfig struct {
+	// Endpoint is the Proxmox API endpoint
+	Endpoint string `yaml:"endpoint" json:"endpoint"`
+	// TokenID is the API token ID, the secret is passed via TF_VAR_proxmox_token_secret
+	TokenID    string        `yaml:"tokenID" json:"token_id"`
+	TalosImage TalosImage    `yaml:"talosImage" json:"talos_image"`
+	NodeData   NodeData      `yaml:"nodeData" json:"node_data"`
+	Cluster    ClusterConfig `yaml:"cluster" json:"cluster"`
+}
+
+// TalosImage defines the Talos Linux image downloaded to the provider
+type TalosImage struct {
+	URL         string `yaml:"url" json:"url"`
+	FileName    string `yaml:"fileName" json:"file_name"`
+	NodeName    string `yaml:"nodeName" json:"node_name"`
+	DatastoreId string `yaml:"datastoreId" json:"datastore_id"`
+	Overwrite   bool   `yaml:"overwrite" json:"overwrite"`
+	ContentType string `yaml:"contentType" json:"content_type"`
+}
+
+// ClusterConfig defines the Kubernetes cluster network settings
+type ClusterConfig struct {
+	Endpoint        string `yaml:"endpoint" json:"endpoint"`
+	VirtualSharedIp string `yaml:"virtualSharedIp" json:"virtual_shared_ip"`
+	Domain          string `yaml:"domain" json:"domain"`
+	DefaultGateway  string `yaml:"defaultGateway" json:"default_gateway"`
+}
+
+// providerConfigTypes creates the typed configuration of each known provider
+var providerConfigTypes = map[string]func() interface{}{
+	"proxmox": func() interface{} { return &ProxmoxConfig{} },
+}
+
+// DecodeProviderConfig converts an untyped provider configuration into out (a pointer to a typed struct)
+// The configuration is round-tripped through YAML so the yaml tags of the typed structs apply
+func DecodeProviderConfig(raw map[string]interface{}, out interface{}) error {
+	data, err := yaml.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("failed to marshal provider config: %w", err)
+	}
+	if err := yaml.Unmarshal(data, out); err != nil {
+		return err
+	}
+	return nil
+}
+
+// DecodeNamedProviderConfig converts the configuration of the named provider into its typed struct
+// Returns nil for providers without a typed configuration
+func DecodeNamedProviderConfig(name string, raw map[string]interface{}) (interface{}, error) {
+	newConfig, ok := providerConfigTypes[name]
+	if !ok {
+		return nil, nil
+	}
+
+	typed := newConfig()
+	if err := DecodeProviderConfig(raw, typed); err != nil {
+		return nil, fmt.Errorf("invalid configuration of provider '%s': %w", name, err)
+	}
+	return typed, nil
+}
+
+// GetActiveTypedConfig returns the typed configuration of the active provider
+// Returns nil for providers without a typed configuration
+func (i *Infra) GetActiveTypedConfig() (interface{}, error) {
+	providerConfig, err := i.GetActiveProviderConfig()
+	if err != nil {
+		return nil, err
+	}
+	return DecodeNamedProviderConfig(i.Provider, providerConfig)
+}
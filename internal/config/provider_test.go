@@ -0,0 +1,73 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeNamedProviderConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		raw      map[string]interface{}
+		want     interface{}
+		wantErr  bool
+	}{
+		{
+			name:     "proxmox",
+			provider: "proxmox",
+			raw: map[string]interface{}{
+				"endpoint": "https://pve.lan:8006",
+				"tokenID":  "klab@pve!token",
+				"cluster":  map[string]interface{}{"endpoint": "https://10.0.0.1:6443", "domain": "lan"},
+				"nodeData": map[string]interface{}{
+					"controlPlanes": []interface{}{map[string]interface{}{"hostname": "cp-1", "pveId": 5000}},
+				},
+			},
+			want: &ProxmoxConfig{
+				Endpoint: "https://pve.lan:8006",
+				TokenID:  "klab@pve!token",
+				Cluster:  ClusterConfig{Endpoint: "https://10.0.0.1:6443", Domain: "lan"},
+				NodeData: NodeData{ControlPlanes: []NodeConfig{{Hostname: "cp-1", PveId: 5000}}},
+			},
+		},
+		{
+			name:     "unknown fields are ignored",
+			provider: "proxmox",
+			raw:      map[string]interface{}{"endpoint": "https://pve.lan:8006", "legacy": true},
+			want:     &ProxmoxConfig{Endpoint: "https://pve.lan:8006"},
+		},
+		{
+			name:     "wrong type",
+			provider: "proxmox",
+			raw:      map[string]interface{}{"nodeData": map[string]interface{}{"controlPlanes": []interface{}{map[string]interface{}{"pveId": "five"}}}},
+			wantErr:  true,
+		},
+		{
+			name:     "provider without typed configuration",
+			provider: "azure",
+			raw:      map[string]interface{}{"location": "westeurope"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeNamedProviderConfig(tt.provider, tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeNamedProviderConfig error = %v, want an error: %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("DecodeNamedProviderConfig = %+v, want nil", got)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeNamedProviderConfig = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
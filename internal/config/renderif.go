@@ -0,0 +1,315 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A renderIf expression is one or more comparisons joined by && and ||, && binding tighter:
+//
+//	spec.environment == "prod"
+//	spec.environment != "dev" && spec.apps.catalog.monitoring.enabled
+//	!spec.apps.catalog.longhorn.values.backups.enabled
+//
+// Operands are dotted paths into the site as written in site.yaml, double quoted strings, numbers,
+// true and false. A path that doesn't exist is null. == and != compare scalars by their string form,
+// null only equals null. An operand on its own is true unless it is null, false, "" or 0.
+// Parentheses are not supported.
+
+// renderIfNode is a parsed renderIf expression
+type renderIfNode interface {
+	eval(site map[string]interface{}) interface{}
+}
+
+type renderIfOr struct{ terms []renderIfNode }
+
+type renderIfAnd struct{ terms []renderIfNode }
+
+type renderIfNot struct{ term renderIfNode }
+
+type renderIfCompare struct {
+	left, right renderIfNode
+	negate      bool
+}
+
+type renderIfPath struct{ path []string }
+
+type renderIfLiteral struct{ value interface{} }
+
+func (n renderIfOr) eval(site map[string]interface{}) interface{} {
+	for _, term := range n.terms {
+		if renderIfTruthy(term.eval(site)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n renderIfAnd) eval(site map[string]interface{}) interface{} {
+	for _, term := range n.terms {
+		if !renderIfTruthy(term.eval(site)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n renderIfNot) eval(site map[string]interface{}) interface{} {
+	return !renderIfTruthy(n.term.eval(site))
+}
+
+func (n renderIfCompare) eval(site map[string]interface{}) interface{} {
+	return renderIfEqual(n.left.eval(site), n.right.eval(site)) != n.negate
+}
+
+func (n renderIfPath) eval(site map[string]interface{}) interface{} {
+	var current interface{} = site
+	for _, key := range n.path {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[key]
+	}
+	return current
+}
+
+func (n renderIfLiteral) eval(map[string]interface{}) interface{} {
+	return n.value
+}
+
+// renderIfTruthy reports whether a value counts as true
+func renderIfTruthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case int:
+		return v != 0
+	case float64:
+		return v != 0
+	default:
+		return true
+	}
+}
+
+// renderIfEqual compares two values by their string form, null only equals null
+func renderIfEqual(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+// parseRenderIf parses a renderIf expression
+func parseRenderIf(expr string) (renderIfNode, error) {
+	tokens, err := tokenizeRenderIf(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &renderIfParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected '%s'", p.tokens[p.pos])
+	}
+	return node, nil
+}
+
+// EvalRenderIf evaluates a renderIf expression against the site
+func EvalRenderIf(expr string, site *Site) (bool, error) {
+	node, err := parseRenderIf(expr)
+	if err != nil {
+		return false, err
+	}
+
+	// The site is evaluated in its site.yaml form so paths use the YAML field names
+	data, err := yaml.Marshal(site)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal site: %w", err)
+	}
+	var siteMap map[string]interface{}
+	if err := yaml.Unmarshal(data, &siteMap); err != nil {
+		return false, fmt.Errorf("failed to unmarshal site: %w", err)
+	}
+
+	return renderIfTruthy(node.eval(siteMap)), nil
+}
+
+// validateRenderIf checks the syntax of the renderIf expressions in the catalog
+func validateRenderIf(site *Site) error {
+	for name, component := range site.Spec.Apps.Catalog {
+		if component.RenderIf == "" {
+			continue
+		}
+		if _, err := parseRenderIf(component.RenderIf); err != nil {
+			return fmt.Errorf("invalid renderIf of app %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// tokenizeRenderIf splits an expression into operators, quoted strings and words
+func tokenizeRenderIf(expr string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(expr); {
+		switch c := expr[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case strings.HasPrefix(expr[i:], "==") || strings.HasPrefix(expr[i:], "!=") ||
+			strings.HasPrefix(expr[i:], "&&") || strings.HasPrefix(expr[i:], "||"):
+			tokens = append(tokens, expr[i:i+2])
+			i += 2
+		case c == '!':
+			tokens = append(tokens, "!")
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(expr) && expr[end] != '"' {
+				if expr[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(expr) {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			tokens = append(tokens, expr[i:end+1])
+			i = end + 1
+		default:
+			end := i
+			for end < len(expr) && !strings.ContainsRune(" \t=!&|\"", rune(expr[end])) {
+				end++
+			}
+			if end == i {
+				return nil, fmt.Errorf("unexpected '%c' at offset %d", c, i)
+			}
+			tokens = append(tokens, expr[i:end])
+			i = end
+		}
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+	return tokens, nil
+}
+
+// renderIfParser is a recursive descent parser over the tokens of an expression
+type renderIfParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *renderIfParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *renderIfParser) parseOr() (renderIfNode, error) {
+	node := renderIfOr{}
+	for {
+		term, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		node.terms = append(node.terms, term)
+		if p.peek() != "||" {
+			break
+		}
+		p.pos++
+	}
+	if len(node.terms) == 1 {
+		return node.terms[0], nil
+	}
+	return node, nil
+}
+
+func (p *renderIfParser) parseAnd() (renderIfNode, error) {
+	node := renderIfAnd{}
+	for {
+		term, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		node.terms = append(node.terms, term)
+		if p.peek() != "&&" {
+			break
+		}
+		p.pos++
+	}
+	if len(node.terms) == 1 {
+		return node.terms[0], nil
+	}
+	return node, nil
+}
+
+func (p *renderIfParser) parseUnary() (renderIfNode, error) {
+	if p.peek() == "!" {
+		p.pos++
+		term, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return renderIfNot{term: term}, nil
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if op := p.peek(); op == "==" || op == "!=" {
+		p.pos++
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return renderIfCompare{left: left, right: right, negate: op == "!="}, nil
+	}
+	return left, nil
+}
+
+func (p *renderIfParser) parseOperand() (renderIfNode, error) {
+	token := p.peek()
+	switch token {
+	case "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case "==", "!=", "&&", "||", "!":
+		return nil, fmt.Errorf("unexpected '%s'", token)
+	}
+	p.pos++
+
+	switch {
+	case strings.HasPrefix(token, `"`):
+		value, err := strconv.Unquote(token)
+		if err != nil {
+			return nil, fmt.Errorf("invalid string %s", token)
+		}
+		return renderIfLiteral{value: value}, nil
+	case token == "true" || token == "false":
+		return renderIfLiteral{value: token == "true"}, nil
+	}
+	if number, err := strconv.ParseFloat(token, 64); err == nil {
+		if number == float64(int(number)) {
+			return renderIfLiteral{value: int(number)}, nil
+		}
+		return renderIfLiteral{value: number}, nil
+	}
+
+	path := strings.Split(token, ".")
+	for _, key := range path {
+		if key == "" {
+			return nil, fmt.Errorf("invalid path '%s'", token)
+		}
+	}
+	return renderIfPath{path: path}, nil
+}
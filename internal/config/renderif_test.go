@@ -0,0 +1,91 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEvalRenderIf(t *testing.T) {
+	site, err := ParseSite([]byte(testSiteYaml + `      pihole:
+        enabled: true
+        values:
+          replicas: 2
+          dns:
+            upstream: "1.1.1.1"
+      longhorn:
+        enabled: false
+`))
+	if err != nil {
+		t.Fatalf("ParseSite: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		want bool
+	}{
+		{name: "string equal", expr: `metadata.name == "demo"`, want: true},
+		{name: "string not equal", expr: `metadata.name != "demo"`, want: false},
+		{name: "bool path", expr: "spec.apps.catalog.pihole.enabled", want: true},
+		{name: "false path", expr: "spec.apps.catalog.longhorn.enabled", want: false},
+		{name: "negation", expr: "!spec.apps.catalog.longhorn.enabled", want: true},
+		{name: "missing path is false", expr: "spec.apps.catalog.monitoring.enabled", want: false},
+		{name: "path through a scalar is null", expr: "metadata.name.first == null.value", want: true},
+		{name: "number compare", expr: "spec.apps.catalog.pihole.values.replicas == 2", want: true},
+		{name: "nested values", expr: `spec.apps.catalog.pihole.values.dns.upstream == "1.1.1.1"`, want: true},
+		{name: "null only equals null", expr: `spec.apps.catalog.monitoring.enabled == ""`, want: false},
+		{name: "and", expr: `metadata.name == "demo" && spec.apps.catalog.longhorn.enabled`, want: false},
+		{name: "or", expr: `metadata.name == "prod" || spec.apps.catalog.pihole.enabled`, want: true},
+		{name: "and binds tighter than or", expr: "true || false && false", want: true},
+		{name: "literal zero", expr: "0", want: false},
+		{name: "literal empty string", expr: `""`, want: false},
+		{name: "escaped quote", expr: `"a\"b" == "a\"b"`, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EvalRenderIf(tt.expr, site)
+			if err != nil {
+				t.Fatalf("EvalRenderIf: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("EvalRenderIf(%s) = %t, want %t", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRenderIfErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr string
+	}{
+		{name: "empty", expr: "  ", wantErr: "empty expression"},
+		{name: "unterminated string", expr: `metadata.name == "demo`, wantErr: "unterminated string"},
+		{name: "missing operand", expr: "metadata.name ==", wantErr: "unexpected end of expression"},
+		{name: "operator as operand", expr: "&& metadata.name", wantErr: "unexpected '&&'"},
+		{name: "trailing operand", expr: "metadata.name spec", wantErr: "unexpected 'spec'"},
+		{name: "empty path key", expr: "spec..apps", wantErr: "invalid path 'spec..apps'"},
+		{name: "single ampersand", expr: "true & false", wantErr: "unexpected '&'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseRenderIf(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseSiteValidatesRenderIf(t *testing.T) {
+	_, err := ParseSite([]byte(testSiteYaml + `      pihole:
+        enabled: true
+        renderIf: metadata.name ==
+`))
+	if err == nil || !strings.Contains(err.Error(), "invalid renderIf of app pihole") {
+		t.Errorf("error = %v, want an invalid renderIf error", err)
+	}
+}
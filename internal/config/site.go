@@ -3,6 +3,10 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -22,15 +26,86 @@ type Metadata struct {
 
 // Spec contains the main configuration specification
 type Spec struct {
-	Stack Stack `yaml:"stack"`
-	Infra Infra `yaml:"infra"`
-	Apps  Apps  `yaml:"apps"`
+	// Environment names the environment of the cluster (e.g. dev, staging, prod), available to templates.
+	// It is not part of the output paths, those stay clusters/<metadata.name>.
+	Environment string `yaml:"environment,omitempty"`
+
+	Stack   Stack   `yaml:"stack"`
+	Infra   Infra   `yaml:"infra"`
+	Apps    Apps    `yaml:"apps"`
+	Layout  Layout  `yaml:"layout,omitempty"`
+	Secrets Secrets `yaml:"secrets,omitempty"`
+	// Templating configures how the stack templates are parsed
+	Templating Templating `yaml:"templating,omitempty"`
+}
+
+// Layout defines the directory names used inside each app directory
+type Layout struct {
+	// GeneratedDir holds the CLI generated overlay (default: generated)
+	GeneratedDir string `yaml:"generatedDir,omitempty"`
+	// CustomDir holds the user additions (default: custom)
+	// The ../custom/ paths in the helm-chart.yaml of copied app bases are rewritten to this name
+	CustomDir string `yaml:"customDir,omitempty"`
+	// FileMode and DirMode are the octal permissions of generated files and directories (e.g. "0640")
+	FileMode string `yaml:"fileMode,omitempty"`
+	DirMode  string `yaml:"dirMode,omitempty"`
+}
+
+// Secrets configures the ExternalSecret resources rendered for component values marked as secretRef
+type Secrets struct {
+	// Store is the name of the External Secrets Operator store the secretRef keys are read from
+	Store string `yaml:"store,omitempty"`
+	// StoreKind is SecretStore or ClusterSecretStore (default: ClusterSecretStore)
+	StoreKind string `yaml:"storeKind,omitempty"`
+	// RefreshInterval of the rendered ExternalSecrets (default: 1h)
+	RefreshInterval string `yaml:"refreshInterval,omitempty"`
 }
 
 // Stack defines the stack source configuration
 type Stack struct {
 	Source string `yaml:"source"`
 	Ref    string `yaml:"ref"`
+
+	// Subdir is the directory of the repository holding the stack/ directory (default: the repository root)
+	Subdir string `yaml:"subdir,omitempty"`
+}
+
+// Templating configures the parsing of stack templates
+type Templating struct {
+	// Delimiters replaces the {{ and }} action delimiters, e.g. ["[[", "]]"] for stacks whose rendered files
+	// are processed by another templating tool
+	Delimiters []string `yaml:"delimiters,omitempty"`
+}
+
+// Delims returns the left and right action delimiters, {{ and }} unless configured
+func (t Templating) Delims() (string, string) {
+	if len(t.Delimiters) != 2 {
+		return "{{", "}}"
+	}
+	return t.Delimiters[0], t.Delimiters[1]
+}
+
+// ValidateDelimiters checks that delimiters is empty or a pair of distinct, non-empty delimiters
+func ValidateDelimiters(delimiters []string) error {
+	if len(delimiters) == 0 {
+		return nil
+	}
+	if len(delimiters) != 2 || delimiters[0] == "" || delimiters[1] == "" || delimiters[0] == delimiters[1] {
+		return fmt.Errorf("template delimiters must be a pair of distinct left and right delimiters, got %q", delimiters)
+	}
+	return nil
+}
+
+// ValidateStackSubdir checks that a stack subdir stays inside the stack repository
+func ValidateStackSubdir(subdir string) error {
+	if subdir == "" {
+		return nil
+	}
+	cleanPath := filepath.Clean(subdir)
+	if filepath.IsAbs(cleanPath) || cleanPath == ".." || strings.HasPrefix(cleanPath, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("stack subdir '%s' must be relative to the stack repository", subdir)
+	}
+	return nil
 }
 
 // Infra defines infrastructure configuration
@@ -41,6 +116,10 @@ type Infra struct {
 	// Providers contains all provider configurations
 	// Each provider has its own complete configuration including cluster, nodeData, etc.
 	Providers map[string]map[string]interface{} `yaml:"providers"`
+
+	// ProvidersFrom points to a YAML file with provider configurations, relative to the site.yaml directory.
+	// Inline provider configuration takes precedence over the file.
+	ProvidersFrom string `yaml:"providersFrom,omitempty"`
 }
 
 // GetActiveProviderConfig returns the configuration for the active provider
@@ -62,6 +141,7 @@ func (i *Infra) GetActiveProviderConfig() (map[string]interface{}, error) {
 }
 
 // NodeConfig defines configuration for a single node
+// StartOnBoot is a pointer so an explicit false reaches the tfvars while an unset value keeps the provider default
 type NodeConfig struct {
 	IP            string `yaml:"ip" json:"ip"`
 	Hostname      string `yaml:"hostname" json:"hostname"`
@@ -71,15 +151,120 @@ type NodeConfig struct {
 	Cores         int    `yaml:"cores" json:"cores"`
 	DiskSize      int    `yaml:"diskSize" json:"disk_size"`
 	InstallDisk   string `yaml:"installDisk,omitempty" json:"install_disk,omitempty"`
-	StartOnBoot   bool   `yaml:"startOnBoot,omitempty" json:"start_on_boot,omitempty"`
+	StartOnBoot   *bool  `yaml:"startOnBoot,omitempty" json:"start_on_boot,omitempty"`
 	NetworkBridge string `yaml:"networkBridge,omitempty" json:"network_bridge,omitempty"`
 	DatastoreId   string `yaml:"datastoreId,omitempty" json:"datastore_id,omitempty"`
 }
 
+// NodeData holds the typed nodes of a provider's nodeData
+type NodeData struct {
+	ControlPlanes []NodeConfig `yaml:"controlPlanes" json:"controlplanes"`
+	Workers       []NodeConfig `yaml:"workers" json:"workers"`
+}
+
+// GetActiveNodeData decodes the nodeData of the active provider into typed nodes
+// A provider without nodeData returns empty node lists
+func (i *Infra) GetActiveNodeData() (*NodeData, error) {
+	providerConfig, err := i.GetActiveProviderConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var typed struct {
+		NodeData NodeData `yaml:"nodeData"`
+	}
+	if err := DecodeProviderConfig(providerConfig, &typed); err != nil {
+		return nil, fmt.Errorf("invalid nodeData of provider '%s': %w", i.Provider, err)
+	}
+
+	return &typed.NodeData, nil
+}
+
+// ValidateNodes checks that node IPs, hostnames and pveIds are unique across the nodes of every
+// provider in providers, not just the active one. Each collision names the providers and nodes involved.
+func (i *Infra) ValidateNodes() error {
+	// Nodes are visited in provider name order so collisions are reported deterministically
+	providerNames := make([]string, 0, len(i.Providers))
+	for name := range i.Providers {
+		providerNames = append(providerNames, name)
+	}
+	sort.Strings(providerNames)
+
+	owners := make(map[string][]string)
+	var keys []string
+	claim := func(key, owner string) {
+		if len(owners[key]) == 0 {
+			keys = append(keys, key)
+		}
+		owners[key] = append(owners[key], owner)
+	}
+
+	for _, providerName := range providerNames {
+		var typed struct {
+			NodeData NodeData `yaml:"nodeData"`
+		}
+		if err := DecodeProviderConfig(i.Providers[providerName], &typed); err != nil {
+			return fmt.Errorf("invalid nodeData of provider '%s': %w", providerName, err)
+		}
+
+		groups := []struct {
+			name  string
+			nodes []NodeConfig
+		}{
+			{"controlPlanes", typed.NodeData.ControlPlanes},
+			{"workers", typed.NodeData.Workers},
+		}
+		for _, group := range groups {
+			for idx, node := range group.nodes {
+				owner := fmt.Sprintf("%s/%s[%d]", providerName, group.name, idx)
+				if node.Hostname != "" {
+					owner = fmt.Sprintf("%s/%s", providerName, node.Hostname)
+				}
+				if node.IP != "" {
+					claim("ip "+node.IP, owner)
+				}
+				if node.Hostname != "" {
+					claim("hostname "+node.Hostname, owner)
+				}
+				if node.PveId != 0 {
+					claim(fmt.Sprintf("pveId %d", node.PveId), owner)
+				}
+			}
+		}
+	}
+
+	var collisions []string
+	for _, key := range keys {
+		if len(owners[key]) > 1 {
+			collisions = append(collisions, fmt.Sprintf("%s is used by %s", key, strings.Join(owners[key], ", ")))
+		}
+	}
+	if len(collisions) > 0 {
+		return fmt.Errorf("duplicate node settings in infra.providers: %s", strings.Join(collisions, "; "))
+	}
+
+	return nil
+}
+
 // Apps defines application configuration
 type Apps struct {
-	Stack   Stack                `yaml:"stack,omitempty"`
-	Catalog map[string]Component `yaml:"catalog"`
+	Stack    Stack                `yaml:"stack,omitempty"`
+	Defaults AppDefaults          `yaml:"defaults,omitempty"`
+	Catalog  map[string]Component `yaml:"catalog"`
+
+	// CommonLabels are added to the resources of every app, merged over the labels of generate --emit-kustomize-labels.
+	// An empty value removes a default label.
+	CommonLabels map[string]string `yaml:"commonLabels,omitempty"`
+
+	// CatalogFrom points to a YAML file with catalog entries, relative to the site.yaml directory.
+	// Inline catalog entries are merged over the file, so a shared catalog can be overridden per cluster.
+	CatalogFrom string `yaml:"catalogFrom,omitempty"`
+}
+
+// AppDefaults defines settings used by catalog components that don't set them
+type AppDefaults struct {
+	Project   string `yaml:"project,omitempty"`
+	Namespace string `yaml:"namespace,omitempty"`
 }
 
 // Base defines the base application configuration
@@ -95,6 +280,28 @@ type Component struct {
 	Project   string                 `yaml:"project"`
 	Namespace string                 `yaml:"namespace"`
 	Values    map[string]interface{} `yaml:"values"`
+
+	// Version pins the chart version the app is expected to render with
+	Version string `yaml:"version,omitempty"`
+
+	// BasePath overrides the location of the app base, relative to the stack repository root.
+	// Defaults to stack/apps/<name>/base.
+	BasePath string `yaml:"basePath,omitempty"`
+
+	// DependsOn lists the components this component is rendered after with --components-order dependency
+	DependsOn []string `yaml:"dependsOn,omitempty"`
+
+	// ValuesFrom points to a YAML file holding the component values, relative to the site.yaml directory,
+	// or to an http(s) URL serving one. Inline values take precedence over values loaded from the file.
+	ValuesFrom string `yaml:"valuesFrom,omitempty"`
+
+	// ValuesJSON holds component values as a JSON object, e.g. a block copied from a chart's docs.
+	// It is merged into Values, inline values take precedence.
+	ValuesJSON string `yaml:"valuesJson,omitempty"`
+
+	// RenderIf is a condition on site values, e.g. spec.environment == "prod". An enabled component
+	// whose condition is false is skipped during render (see renderif.go for the expression syntax).
+	RenderIf string `yaml:"renderIf,omitempty"`
 }
 
 // ParseSite parses a YAML byte slice into a Site struct
@@ -106,9 +313,103 @@ func ParseSite(data []byte) (*Site, error) {
 
 	// TODO: validate site
 
+	applyAppDefaults(&site)
+
+	if err := resolveValuesJSON(&site); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateStackSubdir(site.Spec.Stack.Subdir); err != nil {
+		return nil, err
+	}
+
+	if err := validateRenderIf(&site); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateDelimiters(site.Spec.Templating.Delimiters); err != nil {
+		return nil, err
+	}
+
+	if err := applyLayoutDefaults(&site.Spec.Layout); err != nil {
+		return nil, err
+	}
+
+	if err := applySecretsDefaults(&site.Spec.Secrets); err != nil {
+		return nil, err
+	}
+
 	return &site, nil
 }
 
+// applyLayoutDefaults fills in the default directory names and validates configured ones
+func applyLayoutDefaults(layout *Layout) error {
+	if layout.GeneratedDir == "" {
+		layout.GeneratedDir = "generated"
+	}
+	if layout.CustomDir == "" {
+		layout.CustomDir = "custom"
+	}
+
+	for _, dir := range []string{layout.GeneratedDir, layout.CustomDir} {
+		if dir == "." || dir == ".." || dir == "base" || strings.ContainsAny(dir, `/\`) {
+			return fmt.Errorf("invalid layout directory name '%s'", dir)
+		}
+	}
+	if layout.GeneratedDir == layout.CustomDir {
+		return fmt.Errorf("layout generatedDir and customDir must differ")
+	}
+
+	for _, mode := range []string{layout.FileMode, layout.DirMode} {
+		if _, err := ParseFileMode(mode); err != nil {
+			return fmt.Errorf("invalid layout mode: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ParseFileMode parses octal permissions like "0640", an empty string yields 0
+func ParseFileMode(s string) (os.FileMode, error) {
+	if s == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode == 0 || mode > 0777 {
+		return 0, fmt.Errorf("'%s' is not an octal permission between 0001 and 0777", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// applySecretsDefaults fills in the default secret store kind and refresh interval
+func applySecretsDefaults(secrets *Secrets) error {
+	if secrets.StoreKind == "" {
+		secrets.StoreKind = "ClusterSecretStore"
+	}
+	if secrets.StoreKind != "ClusterSecretStore" && secrets.StoreKind != "SecretStore" {
+		return fmt.Errorf("invalid secrets storeKind '%s' (supported: ClusterSecretStore, SecretStore)", secrets.StoreKind)
+	}
+	if secrets.RefreshInterval == "" {
+		secrets.RefreshInterval = "1h"
+	}
+
+	return nil
+}
+
+// applyAppDefaults fills in the project and namespace of components that omit them from spec.apps.defaults
+func applyAppDefaults(site *Site) {
+	defaults := site.Spec.Apps.Defaults
+	for name, component := range site.Spec.Apps.Catalog {
+		if component.Project == "" {
+			component.Project = defaults.Project
+		}
+		if component.Namespace == "" {
+			component.Namespace = defaults.Namespace
+		}
+		site.Spec.Apps.Catalog[name] = component
+	}
+}
+
 // LoadSiteFromFile loads and parses a site configuration from a file
 func LoadSiteFromFile(filename string) (*Site, error) {
 	data, err := os.ReadFile(filename)
@@ -116,5 +417,24 @@ func LoadSiteFromFile(filename string) (*Site, error) {
 		return nil, fmt.Errorf("failed to read file %s: %w", filename, err)
 	}
 
-	return ParseSite(data)
+	// The catalog is merged before parsing so app defaults apply to entries from the file
+	data, err = resolveCatalogFrom(data, filepath.Dir(filename))
+	if err != nil {
+		return nil, err
+	}
+
+	site, err := ParseSite(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := resolveProvidersFrom(site, filepath.Dir(filename)); err != nil {
+		return nil, err
+	}
+
+	if err := resolveValuesFrom(site, filepath.Dir(filename)); err != nil {
+		return nil, err
+	}
+
+	return site, nil
 }
@@ -0,0 +1,334 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestNodeConfigStartOnBoot(t *testing.T) {
+	tests := []struct {
+		name    string
+		node    string
+		want    string
+		notWant string
+	}{
+		{name: "unset keeps the provider default", node: "hostname: cp-1", notWant: "start_on_boot"},
+		{name: "true", node: "hostname: cp-1\n            startOnBoot: true", want: `"start_on_boot":true`},
+		{name: "false", node: "hostname: cp-1\n            startOnBoot: false", want: `"start_on_boot":false`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			site, err := ParseSite([]byte(`apiVersion: klab/v1alpha1
+kind: Site
+metadata:
+  name: demo
+spec:
+  stack:
+    source: https://example.com/stack.git
+    ref: main
+  infra:
+    provider: proxmox
+    providers:
+      proxmox:
+        nodeData:
+          controlPlanes:
+          - ` + tt.node + `
+  apps:
+    catalog: {}
+`))
+			if err != nil {
+				t.Fatalf("ParseSite: %v", err)
+			}
+			nodeData, err := site.Spec.Infra.GetActiveNodeData()
+			if err != nil {
+				t.Fatalf("GetActiveNodeData: %v", err)
+			}
+
+			data, err := json.Marshal(nodeData)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != "" && !strings.Contains(string(data), tt.want) {
+				t.Errorf("node json misses %s: %s", tt.want, data)
+			}
+			if tt.notWant != "" && strings.Contains(string(data), tt.notWant) {
+				t.Errorf("node json contains %s: %s", tt.notWant, data)
+			}
+		})
+	}
+}
+
+func TestApplyAppDefaults(t *testing.T) {
+	tests := []struct {
+		name          string
+		defaults      string
+		component     string
+		wantProject   string
+		wantNamespace string
+	}{
+		{name: "no defaults", component: "enabled: true", wantProject: "", wantNamespace: ""},
+		{name: "defaults fill in", defaults: "project: system\n      namespace: apps", component: "enabled: true", wantProject: "system", wantNamespace: "apps"},
+		{name: "app settings win", defaults: "project: system\n      namespace: apps", component: "project: dns\n        namespace: pihole", wantProject: "dns", wantNamespace: "pihole"},
+		{name: "partial override", defaults: "project: system\n      namespace: apps", component: "namespace: pihole", wantProject: "system", wantNamespace: "pihole"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			siteYaml := strings.Replace(testSiteYaml, "  apps:\n", "  apps:\n    defaults:\n      "+tt.defaults+"\n", 1)
+			site, err := ParseSite([]byte(siteYaml + "      pihole:\n        " + tt.component + "\n"))
+			if err != nil {
+				t.Fatalf("ParseSite: %v", err)
+			}
+
+			component := site.Spec.Apps.Catalog["pihole"]
+			if component.Project != tt.wantProject || component.Namespace != tt.wantNamespace {
+				t.Errorf("project/namespace = %s/%s, want %s/%s", component.Project, component.Namespace, tt.wantProject, tt.wantNamespace)
+			}
+		})
+	}
+}
+
+func TestApplyLayoutDefaults(t *testing.T) {
+	tests := []struct {
+		name          string
+		layout        Layout
+		wantGenerated string
+		wantCustom    string
+		wantErr       bool
+	}{
+		{name: "defaults", wantGenerated: "generated", wantCustom: "custom"},
+		{name: "configured", layout: Layout{GeneratedDir: "rendered", CustomDir: "overrides"}, wantGenerated: "rendered", wantCustom: "overrides"},
+		{name: "generated dir equals the custom default", layout: Layout{GeneratedDir: "custom"}, wantErr: true},
+		{name: "reserved base", layout: Layout{CustomDir: "base"}, wantErr: true},
+		{name: "nested path", layout: Layout{GeneratedDir: "out/generated"}, wantErr: true},
+		{name: "parent directory", layout: Layout{CustomDir: ".."}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layout := tt.layout
+			err := applyLayoutDefaults(&layout)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyLayoutDefaults error = %v, want an error: %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if layout.GeneratedDir != tt.wantGenerated || layout.CustomDir != tt.wantCustom {
+				t.Errorf("layout = %s/%s, want %s/%s", layout.GeneratedDir, layout.CustomDir, tt.wantGenerated, tt.wantCustom)
+			}
+		})
+	}
+}
+
+func TestApplySecretsDefaults(t *testing.T) {
+	tests := []struct {
+		name         string
+		secrets      Secrets
+		wantKind     string
+		wantInterval string
+		wantErr      bool
+	}{
+		{name: "defaults", wantKind: "ClusterSecretStore", wantInterval: "1h"},
+		{name: "configured", secrets: Secrets{StoreKind: "SecretStore", RefreshInterval: "15m"}, wantKind: "SecretStore", wantInterval: "15m"},
+		{name: "unknown store kind", secrets: Secrets{StoreKind: "Vault"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secrets := tt.secrets
+			err := applySecretsDefaults(&secrets)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applySecretsDefaults error = %v, want an error: %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if secrets.StoreKind != tt.wantKind || secrets.RefreshInterval != tt.wantInterval {
+				t.Errorf("secrets = %s/%s, want %s/%s", secrets.StoreKind, secrets.RefreshInterval, tt.wantKind, tt.wantInterval)
+			}
+		})
+	}
+}
+
+func TestValidateStackSubdir(t *testing.T) {
+	tests := []struct {
+		subdir  string
+		wantErr bool
+	}{
+		{subdir: ""},
+		{subdir: "platform"},
+		{subdir: "platform/klab"},
+		{subdir: "platform/../klab"},
+		{subdir: "..", wantErr: true},
+		{subdir: "../stack", wantErr: true},
+		{subdir: "platform/../../stack", wantErr: true},
+		{subdir: "/opt/stack", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.subdir, func(t *testing.T) {
+			if err := ValidateStackSubdir(tt.subdir); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateStackSubdir(%q) = %v, want an error: %t", tt.subdir, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseFileMode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    os.FileMode
+		wantErr bool
+	}{
+		{in: "", want: 0},
+		{in: "0640", want: 0640},
+		{in: "750", want: 0750},
+		{in: "0", wantErr: true},
+		{in: "0888", wantErr: true},
+		{in: "01777", wantErr: true},
+		{in: "rw-r--r--", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseFileMode(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFileMode(%q) error = %v, want an error: %t", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseFileMode(%q) = %o, want %o", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplatingDelimiters(t *testing.T) {
+	tests := []struct {
+		name       string
+		delimiters []string
+		wantLeft   string
+		wantRight  string
+		wantErr    bool
+	}{
+		{name: "default", wantLeft: "{{", wantRight: "}}"},
+		{name: "configured", delimiters: []string{"[[", "]]"}, wantLeft: "[[", wantRight: "]]"},
+		{name: "single delimiter", delimiters: []string{"[["}, wantErr: true},
+		{name: "empty delimiter", delimiters: []string{"[[", ""}, wantErr: true},
+		{name: "equal delimiters", delimiters: []string{"%%", "%%"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateDelimiters(tt.delimiters)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateDelimiters error = %v, want an error: %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			left, right := Templating{Delimiters: tt.delimiters}.Delims()
+			if left != tt.wantLeft || right != tt.wantRight {
+				t.Errorf("Delims = %s %s, want %s %s", left, right, tt.wantLeft, tt.wantRight)
+			}
+		})
+	}
+}
+
+func TestInfraValidateNodes(t *testing.T) {
+	tests := []struct {
+		name      string
+		providers string
+		wantErr   string
+	}{
+		{
+			name: "unique nodes",
+			providers: `      proxmox:
+        nodeData:
+          controlPlanes:
+          - {ip: 192.168.1.10, hostname: cp-1, pveId: 5000}
+          workers:
+          - {ip: 192.168.1.20, hostname: worker-1, pveId: 5010}
+`,
+		},
+		{
+			name: "duplicate ip in one provider",
+			providers: `      proxmox:
+        nodeData:
+          controlPlanes:
+          - {ip: 192.168.1.10, hostname: cp-1}
+          workers:
+          - {ip: 192.168.1.10, hostname: worker-1}
+`,
+			wantErr: "ip 192.168.1.10 is used by proxmox/cp-1, proxmox/worker-1",
+		},
+		{
+			name: "duplicate hostname across providers",
+			providers: `      proxmox:
+        nodeData:
+          controlPlanes:
+          - {ip: 192.168.1.10, hostname: cp-1}
+      lab:
+        nodeData:
+          controlPlanes:
+          - {ip: 192.168.2.10, hostname: cp-1}
+`,
+			wantErr: "hostname cp-1 is used by lab/cp-1, proxmox/cp-1",
+		},
+		{
+			name: "duplicate pveId of unnamed nodes",
+			providers: `      proxmox:
+        nodeData:
+          workers:
+          - {pveId: 5010}
+          - {pveId: 5010}
+`,
+			wantErr: "pveId 5010 is used by proxmox/workers[0], proxmox/workers[1]",
+		},
+		{
+			name: "unset settings do not collide",
+			providers: `      proxmox:
+        nodeData:
+          workers:
+          - {}
+          - {}
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			site, err := ParseSite([]byte(`apiVersion: klab/v1alpha1
+kind: Site
+metadata:
+  name: demo
+spec:
+  stack:
+    source: https://example.com/stack.git
+    ref: main
+  infra:
+    provider: proxmox
+    providers:
+` + tt.providers + `  apps:
+    catalog: {}
+`))
+			if err != nil {
+				t.Fatalf("ParseSite: %v", err)
+			}
+
+			err = site.Spec.Infra.ValidateNodes()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateNodes: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
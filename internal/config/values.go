@@ -0,0 +1,320 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// remoteValuesTimeout bounds fetching a remote values document
+	remoteValuesTimeout = 10 * time.Second
+	// remoteValuesMaxSize is the largest remote values document accepted
+	remoteValuesMaxSize = 1 << 20
+	// remoteValuesTokenEnv optionally holds a bearer token sent when fetching remote values over https
+	remoteValuesTokenEnv = "KLABCTL_VALUES_TOKEN"
+	// remoteValuesTokenHostsEnv optionally limits the hosts the bearer token is sent to, comma separated
+	remoteValuesTokenHostsEnv = "KLABCTL_VALUES_TOKEN_HOSTS"
+)
+
+var (
+	// remoteValuesClient fetches remote values documents
+	remoteValuesClient = &http.Client{Timeout: remoteValuesTimeout}
+
+	// remoteValuesCache caches fetched remote values documents for the duration of the command
+	remoteValuesCache   = make(map[string]map[string]interface{})
+	remoteValuesCacheMu sync.Mutex
+)
+
+// resolveValuesFrom loads the values files referenced by catalog components and merges them
+// into the component values. Inline values win over values loaded from the file.
+func resolveValuesFrom(site *Site, baseDir string) error {
+	for name, component := range site.Spec.Apps.Catalog {
+		if component.ValuesFrom == "" {
+			continue
+		}
+
+		var fileValues map[string]interface{}
+		var err error
+		if isRemoteValues(component.ValuesFrom) {
+			fileValues, err = fetchRemoteValues(component.ValuesFrom)
+		} else {
+			fileValues, err = loadValuesFile(resolvePath(baseDir, component.ValuesFrom))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load valuesFrom for %s: %w", name, err)
+		}
+
+		component.Values = MergeValues(fileValues, component.Values)
+		site.Spec.Apps.Catalog[name] = component
+	}
+
+	return nil
+}
+
+// resolveValuesJSON parses the valuesJson of catalog components and merges it into the component
+// values. Inline values win over values parsed from the JSON.
+func resolveValuesJSON(site *Site) error {
+	for name, component := range site.Spec.Apps.Catalog {
+		if strings.TrimSpace(component.ValuesJSON) == "" {
+			continue
+		}
+
+		if !json.Valid([]byte(component.ValuesJSON)) {
+			return fmt.Errorf("invalid valuesJson for %s: not a valid JSON document", name)
+		}
+		// JSON is valid YAML, decoding it as YAML keeps numbers typed like inline values
+		var jsonValues map[string]interface{}
+		if err := yaml.Unmarshal([]byte(component.ValuesJSON), &jsonValues); err != nil {
+			return fmt.Errorf("invalid valuesJson for %s: must be a JSON object: %w", name, err)
+		}
+
+		component.Values = MergeValues(jsonValues, component.Values)
+		site.Spec.Apps.Catalog[name] = component
+	}
+
+	return nil
+}
+
+// isRemoteValues reports whether a valuesFrom reference is an http(s) URL
+func isRemoteValues(ref string) bool {
+	return strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://")
+}
+
+// fetchRemoteValues fetches a YAML values document over http(s)
+// Documents are cached per URL, requests time out and responses larger than remoteValuesMaxSize are rejected
+func fetchRemoteValues(url string) (map[string]interface{}, error) {
+	remoteValuesCacheMu.Lock()
+	defer remoteValuesCacheMu.Unlock()
+
+	if values, ok := remoteValuesCache[url]; ok {
+		return values, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %s: %w", url, err)
+	}
+	token, err := remoteValuesToken(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := remoteValuesClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: %s", url, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, remoteValuesMaxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", url, err)
+	}
+	if len(data) > remoteValuesMaxSize {
+		return nil, fmt.Errorf("values document %s exceeds %d bytes", url, remoteValuesMaxSize)
+	}
+
+	values := make(map[string]interface{})
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", url, err)
+	}
+
+	remoteValuesCache[url] = values
+	return values, nil
+}
+
+// remoteValuesToken returns the bearer token to send when fetching u, or "" when none applies
+// The token is only sent to the hosts of KLABCTL_VALUES_TOKEN_HOSTS when that is set, and never over plain http
+func remoteValuesToken(u *url.URL) (string, error) {
+	token := os.Getenv(remoteValuesTokenEnv)
+	if token == "" {
+		return "", nil
+	}
+
+	if hosts := os.Getenv(remoteValuesTokenHostsEnv); hosts != "" {
+		allowed := false
+		for _, host := range strings.Split(hosts, ",") {
+			if strings.EqualFold(strings.TrimSpace(host), u.Hostname()) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return "", nil
+		}
+	}
+
+	if u.Scheme != "https" {
+		return "", fmt.Errorf("refusing to send %s to %s over plain http, use an https URL", remoteValuesTokenEnv, u.Host)
+	}
+	return token, nil
+}
+
+// resolveProvidersFrom loads the provider configurations referenced by spec.infra.providersFrom
+// and merges them into spec.infra.providers. Inline provider settings win over the file.
+func resolveProvidersFrom(site *Site, baseDir string) error {
+	infra := &site.Spec.Infra
+	if infra.ProvidersFrom == "" {
+		return nil
+	}
+
+	fileProviders, err := loadValuesFile(resolvePath(baseDir, infra.ProvidersFrom))
+	if err != nil {
+		return fmt.Errorf("failed to load providersFrom: %w", err)
+	}
+
+	if infra.Providers == nil {
+		infra.Providers = make(map[string]map[string]interface{})
+	}
+
+	for name, value := range fileProviders {
+		providerConfig, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("provider '%s' in %s must be a mapping", name, infra.ProvidersFrom)
+		}
+		infra.Providers[name] = MergeValues(providerConfig, infra.Providers[name])
+	}
+
+	return nil
+}
+
+// resolveCatalogFrom merges the catalog file referenced by spec.apps.catalogFrom into the inline
+// spec.apps.catalog of the raw site document. Inline entries are deep-merged over the file entries.
+// The document is returned unchanged when catalogFrom is not set.
+func resolveCatalogFrom(data []byte, baseDir string) ([]byte, error) {
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse site YAML: %w", err)
+	}
+
+	spec, _ := raw["spec"].(map[string]interface{})
+	apps, _ := spec["apps"].(map[string]interface{})
+	catalogFrom, _ := apps["catalogFrom"].(string)
+	if catalogFrom == "" {
+		return data, nil
+	}
+
+	fileCatalog, err := loadValuesFile(resolvePath(baseDir, catalogFrom))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load catalogFrom: %w", err)
+	}
+	for name, entry := range fileCatalog {
+		if _, ok := entry.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("catalog entry '%s' in %s must be a mapping", name, catalogFrom)
+		}
+	}
+
+	inlineCatalog, _ := apps["catalog"].(map[string]interface{})
+	apps["catalog"] = MergeValues(fileCatalog, inlineCatalog)
+
+	merged, err := yaml.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to merge catalogFrom: %w", err)
+	}
+
+	return merged, nil
+}
+
+// resolvePath resolves a path relative to baseDir unless it is absolute
+func resolvePath(baseDir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(baseDir, path)
+}
+
+// loadValuesFile reads a YAML values file into a map
+// A multi-document file is deep-merged in document order, documents may not set a scalar key to different values
+func loadValuesFile(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+
+	values := make(map[string]interface{})
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for document := 1; ; document++ {
+		var documentValues map[string]interface{}
+		if err := decoder.Decode(&documentValues); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse %s (document %d): %w", path, document, err)
+		}
+
+		if conflicts := valueConflicts("", values, documentValues); len(conflicts) > 0 {
+			return nil, fmt.Errorf("document %d of %s conflicts with a previous document on %s", document, path, strings.Join(conflicts, ", "))
+		}
+		values = MergeValues(values, documentValues)
+	}
+
+	return values, nil
+}
+
+// valueConflicts returns the paths of keys that base and override both set to different non-map values
+func valueConflicts(prefix string, base, override map[string]interface{}) []string {
+	var conflicts []string
+	for key, value := range override {
+		baseValue, ok := base[key]
+		if !ok {
+			continue
+		}
+
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		baseMap, baseIsMap := baseValue.(map[string]interface{})
+		overrideMap, overrideIsMap := value.(map[string]interface{})
+		if baseIsMap && overrideIsMap {
+			conflicts = append(conflicts, valueConflicts(path, baseMap, overrideMap)...)
+			continue
+		}
+		if !reflect.DeepEqual(baseValue, value) {
+			conflicts = append(conflicts, path)
+		}
+	}
+
+	sort.Strings(conflicts)
+	return conflicts
+}
+
+// MergeValues deep-merges override into base and returns the result.
+// Nested maps are merged recursively, any other value in override replaces the one in base.
+func MergeValues(base, override map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(base)+len(override))
+	for key, value := range base {
+		result[key] = value
+	}
+
+	for key, value := range override {
+		baseMap, baseIsMap := result[key].(map[string]interface{})
+		overrideMap, overrideIsMap := value.(map[string]interface{})
+		if baseIsMap && overrideIsMap {
+			result[key] = MergeValues(baseMap, overrideMap)
+			continue
+		}
+		result[key] = value
+	}
+
+	return result
+}
@@ -0,0 +1,427 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testSiteYaml is a minimal site, tests append to its catalog
+const testSiteYaml = `apiVersion: klab/v1alpha1
+kind: Site
+metadata:
+  name: demo
+spec:
+  stack:
+    source: https://example.com/stack.git
+    ref: main
+  infra:
+    provider: proxmox
+    providers:
+      proxmox: {}
+  apps:
+    catalog:
+`
+
+// writeTestFile writes content to dir/name and returns the path
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestResolveValuesFrom(t *testing.T) {
+	tests := []struct {
+		name       string
+		component  string
+		valuesFile string
+		want       map[string]interface{}
+		wantErr    bool
+	}{
+		{
+			name:       "file values",
+			component:  "        valuesFrom: values/pihole.yaml\n",
+			valuesFile: "host: pihole.lan\nreplicas: 2\n",
+			want:       map[string]interface{}{"host": "pihole.lan", "replicas": 2},
+		},
+		{
+			name:       "inline values win",
+			component:  "        valuesFrom: values/pihole.yaml\n        values:\n          host: dns.lan\n          dns:\n            port: 53\n",
+			valuesFile: "host: pihole.lan\ndns:\n  upstream: 1.1.1.1\n",
+			want:       map[string]interface{}{"host": "dns.lan", "dns": map[string]interface{}{"upstream": "1.1.1.1", "port": 53}},
+		},
+		{
+			name:      "missing file",
+			component: "        valuesFrom: values/missing.yaml\n",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.valuesFile != "" {
+				writeTestFile(t, dir, filepath.Join("values", "pihole.yaml"), tt.valuesFile)
+			}
+			sitePath := writeTestFile(t, dir, "site.yaml", testSiteYaml+"      pihole:\n        enabled: true\n"+tt.component)
+
+			site, err := LoadSiteFromFile(sitePath)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("LoadSiteFromFile succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadSiteFromFile: %v", err)
+			}
+			if got := site.Spec.Apps.Catalog["pihole"].Values; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("values = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveProvidersFrom(t *testing.T) {
+	tests := []struct {
+		name          string
+		inline        string
+		providersFile string
+		want          map[string]map[string]interface{}
+		wantErr       bool
+	}{
+		{
+			name:          "file providers",
+			inline:        "{}",
+			providersFile: "proxmox:\n  endpoint: https://pve.lan:8006\n",
+			want:          map[string]map[string]interface{}{"proxmox": {"endpoint": "https://pve.lan:8006"}},
+		},
+		{
+			name:          "inline settings win",
+			inline:        "\n        endpoint: https://pve.example.com:8006\n        cluster:\n          name: demo",
+			providersFile: "proxmox:\n  endpoint: https://pve.lan:8006\n  cluster:\n    endpoint: https://10.0.0.1:6443\n",
+			want: map[string]map[string]interface{}{"proxmox": {
+				"endpoint": "https://pve.example.com:8006",
+				"cluster":  map[string]interface{}{"name": "demo", "endpoint": "https://10.0.0.1:6443"},
+			}},
+		},
+		{
+			name:          "provider that isn't a mapping",
+			inline:        "{}",
+			providersFile: "proxmox: enabled\n",
+			wantErr:       true,
+		},
+		{
+			name:    "missing file",
+			inline:  "{}",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.providersFile != "" {
+				writeTestFile(t, dir, "providers.yaml", tt.providersFile)
+			}
+			siteYaml := strings.Replace(testSiteYaml, "      proxmox: {}\n", "      proxmox: "+tt.inline+"\n    providersFrom: providers.yaml\n", 1)
+			sitePath := writeTestFile(t, dir, "site.yaml", siteYaml)
+
+			site, err := LoadSiteFromFile(sitePath)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("LoadSiteFromFile succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadSiteFromFile: %v", err)
+			}
+			if !reflect.DeepEqual(site.Spec.Infra.Providers, tt.want) {
+				t.Errorf("providers = %v, want %v", site.Spec.Infra.Providers, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchRemoteValues(t *testing.T) {
+	tests := []struct {
+		name       string
+		tls        bool
+		status     int
+		body       string
+		token      string
+		tokenHosts string
+		wantAuth   string
+		want       map[string]interface{}
+		wantError  string
+	}{
+		{name: "values", status: http.StatusOK, body: "host: pihole.lan\n", want: map[string]interface{}{"host": "pihole.lan"}},
+		{name: "bearer token over https", tls: true, status: http.StatusOK, body: "host: pihole.lan\n", token: "secret", wantAuth: "Bearer secret", want: map[string]interface{}{"host": "pihole.lan"}},
+		{name: "bearer token to a configured host", tls: true, status: http.StatusOK, body: "host: pihole.lan\n", token: "secret", tokenHosts: "example.com, 127.0.0.1", wantAuth: "Bearer secret", want: map[string]interface{}{"host": "pihole.lan"}},
+		{name: "no token to other hosts", tls: true, status: http.StatusOK, body: "host: pihole.lan\n", token: "secret", tokenHosts: "example.com", want: map[string]interface{}{"host": "pihole.lan"}},
+		{name: "no token over http", status: http.StatusOK, body: "host: pihole.lan\n", token: "secret", tokenHosts: "example.com", want: map[string]interface{}{"host": "pihole.lan"}},
+		{name: "token host over http", status: http.StatusOK, token: "secret", wantError: "refusing to send KLABCTL_VALUES_TOKEN"},
+		{name: "not found", status: http.StatusNotFound, wantError: "404"},
+		{name: "too large", status: http.StatusOK, body: "host: " + strings.Repeat("x", remoteValuesMaxSize) + "\n", wantError: "exceeds"},
+		{name: "invalid yaml", status: http.StatusOK, body: "host: [\n", wantError: "failed to parse"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			var gotAuth string
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				gotAuth = r.Header.Get("Authorization")
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			})
+			server := httptest.NewUnstartedServer(handler)
+			if tt.tls {
+				server.StartTLS()
+			} else {
+				server.Start()
+			}
+			defer server.Close()
+			previousClient := remoteValuesClient
+			remoteValuesClient = server.Client()
+			t.Cleanup(func() {
+				remoteValuesClient = previousClient
+				remoteValuesCache = make(map[string]map[string]interface{})
+			})
+			t.Setenv(remoteValuesTokenEnv, tt.token)
+			t.Setenv(remoteValuesTokenHostsEnv, tt.tokenHosts)
+
+			url := server.URL + "/pihole.yaml"
+			got, err := fetchRemoteValues(url)
+			if gotAuth != tt.wantAuth {
+				t.Errorf("Authorization = %q, want %q", gotAuth, tt.wantAuth)
+			}
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("fetchRemoteValues: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("values = %v, want %v", got, tt.want)
+			}
+
+			// Documents are fetched once per command
+			if _, err := fetchRemoteValues(url); err != nil {
+				t.Fatal(err)
+			}
+			if requests != 1 {
+				t.Errorf("fetched %d times, want 1", requests)
+			}
+		})
+	}
+}
+
+func TestResolveCatalogFrom(t *testing.T) {
+	tests := []struct {
+		name        string
+		inline      string
+		catalogFile string
+		wantEnabled map[string]bool
+		wantValues  map[string]map[string]interface{}
+		wantErr     bool
+	}{
+		{
+			name:        "file entries",
+			catalogFile: "pihole:\n  enabled: true\n  values:\n    host: pihole.lan\n",
+			wantEnabled: map[string]bool{"pihole": true},
+			wantValues:  map[string]map[string]interface{}{"pihole": {"host": "pihole.lan"}},
+		},
+		{
+			name:        "inline entries are merged over the file",
+			inline:      "      pihole:\n        values:\n          replicas: 2\n      external-dns:\n        enabled: true\n",
+			catalogFile: "pihole:\n  enabled: true\n  values:\n    host: pihole.lan\n",
+			wantEnabled: map[string]bool{"pihole": true, "external-dns": true},
+			wantValues: map[string]map[string]interface{}{
+				"pihole":       {"host": "pihole.lan", "replicas": 2},
+				"external-dns": nil,
+			},
+		},
+		{
+			name:        "entry that isn't a mapping",
+			catalogFile: "pihole: enabled\n",
+			wantErr:     true,
+		},
+		{
+			name:    "missing file",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.catalogFile != "" {
+				writeTestFile(t, dir, "catalog.yaml", tt.catalogFile)
+			}
+			siteYaml := strings.Replace(testSiteYaml, "    catalog:\n", "    catalogFrom: catalog.yaml\n    catalog:\n", 1) + tt.inline
+			sitePath := writeTestFile(t, dir, "site.yaml", siteYaml)
+
+			site, err := LoadSiteFromFile(sitePath)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("LoadSiteFromFile succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadSiteFromFile: %v", err)
+			}
+			if len(site.Spec.Apps.Catalog) != len(tt.wantEnabled) {
+				t.Errorf("catalog has %d entries, want %d", len(site.Spec.Apps.Catalog), len(tt.wantEnabled))
+			}
+			for name, enabled := range tt.wantEnabled {
+				component := site.Spec.Apps.Catalog[name]
+				if component.Enabled != enabled {
+					t.Errorf("%s enabled = %t, want %t", name, component.Enabled, enabled)
+				}
+				if !reflect.DeepEqual(component.Values, tt.wantValues[name]) {
+					t.Errorf("%s values = %v, want %v", name, component.Values, tt.wantValues[name])
+				}
+			}
+		})
+	}
+}
+
+func TestLoadValuesFileDocuments(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		want      map[string]interface{}
+		wantError string
+	}{
+		{
+			name:    "single document",
+			content: "host: pihole.lan\n",
+			want:    map[string]interface{}{"host": "pihole.lan"},
+		},
+		{
+			name:    "documents are deep-merged",
+			content: "dns:\n  upstream: 1.1.1.1\n---\ndns:\n  cache: true\nhost: pihole.lan\n",
+			want:    map[string]interface{}{"dns": map[string]interface{}{"upstream": "1.1.1.1", "cache": true}, "host": "pihole.lan"},
+		},
+		{
+			name:    "equal values don't conflict",
+			content: "host: pihole.lan\n---\nhost: pihole.lan\n",
+			want:    map[string]interface{}{"host": "pihole.lan"},
+		},
+		{
+			name:    "empty documents",
+			content: "---\nhost: pihole.lan\n---\n",
+			want:    map[string]interface{}{"host": "pihole.lan"},
+		},
+		{
+			name:      "conflicting values",
+			content:   "dns:\n  upstream: 1.1.1.1\nhost: a\n---\ndns:\n  upstream: 9.9.9.9\nhost: b\n",
+			wantError: "document 2 of",
+		},
+		{
+			name:      "invalid document",
+			content:   "host: a\n---\nhost: [\n",
+			wantError: "(document 2)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestFile(t, t.TempDir(), "values.yaml", tt.content)
+
+			got, err := loadValuesFile(path)
+			if tt.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantError) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("loadValuesFile: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadValuesFile = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValueConflicts(t *testing.T) {
+	base := map[string]interface{}{"dns": map[string]interface{}{"upstream": "1.1.1.1", "port": 53}, "host": "a", "list": []interface{}{"x"}}
+	override := map[string]interface{}{"dns": map[string]interface{}{"upstream": "9.9.9.9", "port": 53}, "host": "b", "list": []interface{}{"x"}, "new": true}
+
+	want := []string{"dns.upstream", "host"}
+	if got := valueConflicts("", base, override); !reflect.DeepEqual(got, want) {
+		t.Errorf("valueConflicts = %v, want %v", got, want)
+	}
+}
+
+func TestResolveValuesJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		component string
+		want      map[string]interface{}
+		wantErr   bool
+	}{
+		{
+			name:      "json values",
+			component: "        valuesJson: '{\"host\": \"pihole.lan\", \"replicas\": 2, \"dns\": [\"1.1.1.1\"]}'\n",
+			want:      map[string]interface{}{"host": "pihole.lan", "replicas": 2, "dns": []interface{}{"1.1.1.1"}},
+		},
+		{
+			name:      "inline values win",
+			component: "        valuesJson: '{\"host\": \"pihole.lan\", \"dns\": {\"upstream\": \"1.1.1.1\"}}'\n        values:\n          host: dns.lan\n          dns:\n            port: 53\n",
+			want:      map[string]interface{}{"host": "dns.lan", "dns": map[string]interface{}{"upstream": "1.1.1.1", "port": 53}},
+		},
+		{
+			name:      "blank json",
+			component: "        valuesJson: ' '\n        values:\n          host: dns.lan\n",
+			want:      map[string]interface{}{"host": "dns.lan"},
+		},
+		{
+			name:      "invalid json",
+			component: "        valuesJson: '{host: pihole.lan}'\n",
+			wantErr:   true,
+		},
+		{
+			name:      "not an object",
+			component: "        valuesJson: '[1, 2]'\n",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			site, err := ParseSite([]byte(testSiteYaml + "      pihole:\n        enabled: true\n" + tt.component))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("ParseSite succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSite: %v", err)
+			}
+			if got := site.Spec.Apps.Catalog["pihole"].Values; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("values = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}